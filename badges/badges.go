@@ -0,0 +1,136 @@
+// Package badges awards achievements for milestones reached through transfers
+package badges
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// Badge is an achievement earned once a metric reaches a threshold
+type Badge struct {
+	ID          string
+	Emoji       string
+	Name        string
+	Description string
+	Metric      string
+	Threshold   int
+}
+
+// metrics reads each metric from a user's wallet
+// Transfer metrics come from counters kept up to date by every transfer and undo, so they exclude
+// undone transfers and self-sends
+var metrics = map[string]func(*models.User) int{
+	MetricTransfersSent:      func(u *models.User) int { return u.TransfersSent },
+	MetricDistinctRecipients: func(u *models.User) int { return u.DistinctRecipients },
+	MetricDistinctSenders:    func(u *models.User) int { return u.DistinctSenders },
+	MetricBalance:            func(u *models.User) int { return u.Coins },
+	MetricWeeklyPodiums:      func(u *models.User) int { return u.WeeklyPodiums },
+}
+
+// Check evaluates every badge for the given users after their balance changed,
+// awards the ones they just earned and announces them
+// Errors are logged rather than returned, as badges never block the change that triggered them
+func Check(ctx context.Context, userIDs ...string) {
+	for _, userID := range userIDs {
+		earned, err := evaluate(ctx, userID)
+		if err != nil {
+			log.Printf("Error evaluating badges for %s: %v", userID, err)
+			continue
+		}
+		if len(earned) == 0 {
+			continue
+		}
+
+		awarded, err := database.AwardBadges(ctx, userID, earned)
+		if err != nil {
+			continue
+		}
+		for _, badgeID := range awarded {
+			if badge, ok := Find(badgeID); ok {
+				announce(ctx, userID, badge)
+			}
+		}
+	}
+}
+
+// evaluate returns the IDs of the badges the user qualifies for but doesn't hold yet
+func evaluate(ctx context.Context, userID string) ([]string, error) {
+	user, err := database.GetUser(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	if user.System {
+		return nil, nil
+	}
+
+	var pending []Badge
+	for _, badge := range Definitions {
+		if !user.HasBadge(badge.ID) {
+			pending = append(pending, badge)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	// Counters start from the transfer history the first time a user's badges are checked
+	if !user.ActivityCounted {
+		if user, err = database.CountActivity(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	var earned []string
+	for _, badge := range pending {
+		metric, ok := metrics[badge.Metric]
+		if !ok {
+			log.Printf("Badge %s uses unknown metric %s", badge.ID, badge.Metric)
+			continue
+		}
+		if metric(user) >= badge.Threshold {
+			earned = append(earned, badge.ID)
+		}
+	}
+	return earned, nil
+}
+
+// announce tells the user they earned a badge and mirrors it to the announcement channel
+func announce(ctx context.Context, userID string, badge Badge) {
+	if err := slack.SendDirectMessage(userID, fmt.Sprintf("%s You earned the *%s* badge: %s!", badge.Emoji, badge.Name, badge.Description)); err != nil {
+		log.Printf("Error notifying %s of badge %s: %v", userID, badge.ID, err)
+	}
+
+	if channel := database.GetSettings(ctx).AnnouncementChannel; channel != "" {
+		message := fmt.Sprintf("%s <@%s> earned the *%s* badge: %s!", badge.Emoji, userID, badge.Name, badge.Description)
+		if err := slack.SendMessage(channel, message, ""); err != nil {
+			log.Printf("Error announcing badge %s of %s: %v", badge.ID, userID, err)
+		}
+	}
+}
+
+// Find returns the definition of the badge with the given ID
+func Find(id string) (Badge, bool) {
+	for _, badge := range Definitions {
+		if badge.ID == id {
+			return badge, true
+		}
+	}
+	return Badge{}, false
+}
+
+// Summary returns the emojis of the badges a user holds, in definition order
+func Summary(user *models.User) string {
+	var emojis []string
+	for _, badge := range Definitions {
+		if user.HasBadge(badge.ID) {
+			emojis = append(emojis, badge.Emoji)
+		}
+	}
+	return strings.Join(emojis, " ")
+}
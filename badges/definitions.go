@@ -0,0 +1,64 @@
+package badges
+
+// Metrics a badge can be awarded on, read from a user's wallet and transfer counters
+const (
+	// MetricTransfersSent is the number of transfers the user sent
+	MetricTransfersSent = "transfers_sent"
+
+	// MetricDistinctRecipients is the number of different people the user sent coins to
+	MetricDistinctRecipients = "distinct_recipients"
+
+	// MetricDistinctSenders is the number of different people the user received coins from
+	MetricDistinctSenders = "distinct_senders"
+
+	// MetricBalance is the user's current balance
+	MetricBalance = "balance"
+
+	// MetricWeeklyPodiums is the number of weeks the user was among the top receivers of the weekly digest
+	MetricWeeklyPodiums = "weekly_podiums"
+)
+
+// Definitions lists every badge; a badge is earned once its metric reaches the threshold
+// Badges are identified by ID once awarded, so IDs must never change
+var Definitions = []Badge{
+	{
+		ID:          "first-send",
+		Emoji:       "🚀",
+		Name:        "First Send",
+		Description: "Sent coins for the first time",
+		Metric:      MetricTransfersSent,
+		Threshold:   1,
+	},
+	{
+		ID:          "grateful",
+		Emoji:       "🙏",
+		Name:        "Grateful",
+		Description: "Thanked 10 different people",
+		Metric:      MetricDistinctRecipients,
+		Threshold:   10,
+	},
+	{
+		ID:          "appreciated",
+		Emoji:       "🌟",
+		Name:        "Appreciated",
+		Description: "Received coins from 25 different people",
+		Metric:      MetricDistinctSenders,
+		Threshold:   25,
+	},
+	{
+		ID:          "podium",
+		Emoji:       "🥉",
+		Name:        "Podium",
+		Description: "Finished in the top 3 receivers of a week",
+		Metric:      MetricWeeklyPodiums,
+		Threshold:   1,
+	},
+	{
+		ID:          "centurion",
+		Emoji:       "💯",
+		Name:        "Centurion",
+		Description: "Held 100 coins at once",
+		Metric:      MetricBalance,
+		Threshold:   100,
+	},
+}
@@ -2,21 +2,35 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	
 	// Import corbacoin package to trigger init() and register functions
 	_ "github.com/unacorbatanegra/corbacoin-bot"
+	"github.com/unacorbatanegra/corbacoin-bot/handlers"
 )
 
+// defaultLocalJobs are the scheduled jobs run locally when LOCAL_JOBS is not set
+const defaultLocalJobs = "weekly-digest=168h"
+
 func main() {
 	// Use PORT environment variable, or default to 8080
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
+
+	// Run scheduled jobs on local tickers instead of Cloud Scheduler
+	localJobs := os.Getenv("LOCAL_JOBS")
+	if localJobs == "" {
+		localJobs = defaultLocalJobs
+	}
+	startLocalJobs(localJobs)
 	
 	log.Printf("Starting Functions Framework server on port %s", port)
 	
@@ -26,3 +40,37 @@ func main() {
 	}
 }
 
+// startLocalJobs starts a ticker for each job in a comma-separated list of name=interval pairs,
+// e.g. "weekly-digest=168h,notification-summary=24h"
+func startLocalJobs(spec string) {
+	for _, entry := range strings.Split(spec, ",") {
+		name, rawInterval, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found {
+			log.Printf("Ignoring local job %q: expected name=interval", entry)
+			continue
+		}
+
+		job, ok := handlers.ScheduledJobs[name]
+		if !ok {
+			log.Printf("Ignoring unknown local job %q", name)
+			continue
+		}
+
+		interval, err := time.ParseDuration(rawInterval)
+		if err != nil || interval <= 0 {
+			log.Printf("Ignoring local job %q: invalid interval %q", name, rawInterval)
+			continue
+		}
+
+		log.Printf("Running job %s locally every %s", name, interval)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := job(context.Background()); err != nil {
+					log.Printf("Local job %s failed: %v", name, err)
+				}
+			}
+		}()
+	}
+}
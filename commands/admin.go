@@ -0,0 +1,229 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// userMentionPattern matches a Slack user mention such as <@U12345678> or <@U12345678|name>
+var userMentionPattern = regexp.MustCompile(`^<@([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// IsAdmin reports whether the user is allowed to run admin commands
+func IsAdmin(userID string) bool {
+	for _, adminID := range config.AdminUserIDs {
+		if adminID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAdminHelpMessage returns the help message for admin commands
+func GetAdminHelpMessage() string {
+	return `*Corbacoin Admin Commands*
+
+• ` + "`/corbacoin admin mint @user amount reason`" + ` - Create coins for a user
+• ` + "`/corbacoin admin burn @user amount reason`" + ` - Destroy coins from a user's balance
+• ` + "`/corbacoin admin set-balance @user amount reason`" + ` - Override a user's balance
+• ` + "`/corbacoin admin freeze @user reason`" + ` - Stop a user from sending or receiving coins
+• ` + "`/corbacoin admin unfreeze @user reason`" + ` - Restore a frozen wallet
+• ` + "`/corbacoin admin settings [history]`" + ` - View settings or their change history
+• ` + "`/corbacoin admin set setting value`" + ` - Change a setting
+• ` + "`/corbacoin admin channels`" + ` - View where the bot is allowed, quiet channels and the announcement channel
+• ` + "`/corbacoin admin channels allow|remove #channel`" + ` - Add or remove a channel from the allowlist
+• ` + "`/corbacoin admin channels quiet|unquiet #channel`" + ` - Only answer privately or in threads in a channel
+• ` + "`/corbacoin admin channels announce #channel|off`" + ` - Mirror public transfer announcements to a channel
+• ` + "`/corbacoin admin channels intro #channel|off`" + ` - Introduce new members of the workspace in a channel
+• ` + "`/corbacoin admin season`" + ` - View the current season and its prizes
+• ` + "`/corbacoin admin season prizes amount... | off`" + ` - Set the prizes of the top of the ranking, best first
+• ` + "`/corbacoin admin season close`" + ` - Archive the ranking, award the prizes and reset every balance
+• ` + "`/corbacoin admin shop add id price stock [@approver] name [| description]`" + ` - Put an item on sale
+• ` + "`/corbacoin admin shop stock id amount`" + ` - Change how many units of an item are left
+• ` + "`/corbacoin admin shop remove id`" + ` - Take an item off the shop
+• ` + "`/corbacoin admin streaks [days:bonus... | off]`" + ` - View or set the bonuses paid at giving streak milestones
+• ` + "`/corbacoin admin payroll`" + ` - View payrolls and whether they were paid this month
+• ` + "`/corbacoin admin payroll add amount [#channel...] [@group...]`" + ` - Mint a monthly stipend for every active member, or the members of channels and user groups
+• ` + "`/corbacoin admin payroll remove|run id`" + ` - Remove a payroll, or pay whoever it missed this month now
+• ` + "`/corbacoin admin payroll report id [YYYY-MM]`" + ` - View the report of a payroll's run`
+}
+
+// HandleAdmin runs an admin subcommand such as `mint @user 50 "hackathon prize"`
+func HandleAdmin(ctx context.Context, adminID, text string) models.CommandResult {
+	if !IsAdmin(adminID) {
+		log.Printf("Rejected admin command from non-admin %s: %s", adminID, text)
+		return models.CommandResult{
+			Success: false,
+			Message: "Only Corbacoin admins can use this command.",
+		}
+	}
+
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return models.CommandResult{Success: true, Message: GetAdminHelpMessage()}
+	}
+
+	action := strings.ToLower(args[0])
+	switch action {
+	case models.AdminActionMint, models.AdminActionBurn, models.AdminActionSetBalance:
+		return handleBalanceAdjustment(ctx, adminID, action, args[1:])
+	case models.AdminActionFreeze, models.AdminActionUnfreeze:
+		return handleStatusChange(ctx, adminID, action, args[1:])
+	case "settings":
+		return handleSettings(ctx, args[1:])
+	case "set":
+		return handleSetSetting(ctx, adminID, args[1:])
+	case "channels":
+		return handleChannels(ctx, adminID, args[1:])
+	case "season":
+		return handleSeason(ctx, adminID, args[1:])
+	case "shop":
+		return handleShopAdmin(ctx, adminID, args[1:])
+	case "streaks":
+		return handleStreaks(ctx, adminID, args[1:])
+	case "payroll":
+		return handlePayroll(ctx, adminID, args[1:])
+	default:
+		return models.CommandResult{
+			Success: false,
+			Message: "Unknown admin command.\n" + GetAdminHelpMessage(),
+		}
+	}
+}
+
+// handleBalanceAdjustment parses and applies a mint, burn or set-balance command
+func handleBalanceAdjustment(ctx context.Context, adminID, action string, args []string) models.CommandResult {
+	usage := fmt.Sprintf("Usage: `/corbacoin admin %s @user amount reason`", action)
+	if len(args) < 3 {
+		return models.CommandResult{Success: false, Message: usage}
+	}
+
+	amount, err := strconv.Atoi(args[1])
+	if err != nil || amount < 0 || (amount == 0 && action != models.AdminActionSetBalance) {
+		return models.CommandResult{Success: false, Message: usage}
+	}
+
+	reason := strings.Trim(strings.Join(args[2:], " "), `"“”'`)
+	if reason == "" {
+		return models.CommandResult{Success: false, Message: usage}
+	}
+
+	return applyAdminAction(ctx, &models.AdminAction{
+		Action:  action,
+		AdminID: adminID,
+		Amount:  amount,
+		Reason:  reason,
+	}, args[0])
+}
+
+// handleStatusChange parses and applies a freeze or unfreeze command
+func handleStatusChange(ctx context.Context, adminID, action string, args []string) models.CommandResult {
+	usage := fmt.Sprintf("Usage: `/corbacoin admin %s @user reason`", action)
+	if len(args) < 2 {
+		return models.CommandResult{Success: false, Message: usage}
+	}
+
+	reason := strings.Trim(strings.Join(args[1:], " "), `"“”'`)
+	if reason == "" {
+		return models.CommandResult{Success: false, Message: usage}
+	}
+
+	return applyAdminAction(ctx, &models.AdminAction{
+		Action:  action,
+		AdminID: adminID,
+		Reason:  reason,
+	}, args[0])
+}
+
+// applyAdminAction resolves the target user, applies the action and announces it
+func applyAdminAction(ctx context.Context, adminAction *models.AdminAction, target string) models.CommandResult {
+	identifier := parseUserReference(target)
+	userInfo, err := slack.GetOrFindUser(identifier)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Could not find user '%s'. %v", identifier, err),
+		}
+	}
+
+	// Make sure the wallet exists before adjusting it
+	if _, err := database.GetUser(ctx, userInfo.ID, userInfo.Name); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error loading user. Please try again.",
+		}
+	}
+
+	adminAction.UserID = userInfo.ID
+	adminAction.CreatedAt = time.Now()
+	if err := database.ApplyAdminAction(ctx, adminAction); err != nil {
+		if errors.Is(err, database.ErrInsufficientFunds) {
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("<@%s> only has %d :corbacoin:.", userInfo.ID, adminAction.PreviousBalance),
+			}
+		}
+		return models.CommandResult{
+			Success: false,
+			Message: "Error applying admin action. Please try again.",
+		}
+	}
+
+	message := describeAdminAction(adminAction)
+	announceAdminAction(message)
+	badges.Check(ctx, adminAction.UserID)
+
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// describeAdminAction returns a human readable summary of an applied admin action
+func describeAdminAction(action *models.AdminAction) string {
+	switch action.Action {
+	case models.AdminActionFreeze:
+		return fmt.Sprintf("❄️ <@%s> froze the wallet of <@%s>: _%s_", action.AdminID, action.UserID, action.Reason)
+	case models.AdminActionUnfreeze:
+		return fmt.Sprintf("🔥 <@%s> unfroze the wallet of <@%s>: _%s_", action.AdminID, action.UserID, action.Reason)
+	}
+
+	var verb string
+	switch action.Action {
+	case models.AdminActionMint:
+		verb = fmt.Sprintf("minted %d :corbacoin: for", action.Amount)
+	case models.AdminActionBurn:
+		verb = fmt.Sprintf("burned %d :corbacoin: from", action.Amount)
+	default:
+		verb = "set the balance of"
+	}
+
+	return fmt.Sprintf("🛠️ <@%s> %s <@%s> (%d → %d :corbacoin:): _%s_",
+		action.AdminID, verb, action.UserID, action.PreviousBalance, action.NewBalance, action.Reason)
+}
+
+// announceAdminAction posts a message to the admin log channel, if one is configured
+func announceAdminAction(message string) {
+	if config.AdminLogChannel == "" {
+		return
+	}
+	if err := slack.SendMessage(config.AdminLogChannel, message, ""); err != nil {
+		log.Printf("Error announcing admin action: %v", err)
+	}
+}
+
+// parseUserReference extracts the user ID from a mention, or the bare username from "@name"
+func parseUserReference(token string) string {
+	if matches := userMentionPattern.FindStringSubmatch(token); matches != nil {
+		return matches[1]
+	}
+	return strings.TrimPrefix(token, "@")
+}
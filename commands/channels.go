@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// channelReferencePattern matches a Slack channel reference such as <#C12345678|general> or a bare channel ID
+var channelReferencePattern = regexp.MustCompile(`^(?:<#([A-Z0-9]+)(?:\|[^>]*)?>|([CG][A-Z0-9]+))$`)
+
+// channelsUsage is the help text for the channel admin commands
+const channelsUsage = "Usage: `/corbacoin admin channels [allow|remove|quiet|unquiet|announce|intro] #channel` or `/corbacoin admin channels announce|intro off`"
+
+// MirrorAnnouncement copies a public transfer announcement to the workspace's announcement channel
+func MirrorAnnouncement(ctx context.Context, sourceChannel, message string) {
+	announcementChannel := database.GetSettings(ctx).AnnouncementChannel
+	if announcementChannel == "" || announcementChannel == sourceChannel {
+		return
+	}
+
+	mirrored := fmt.Sprintf("%s\n_in <#%s>_", message, sourceChannel)
+	if err := slack.SendMessage(announcementChannel, mirrored, ""); err != nil {
+		log.Printf("Error mirroring announcement to %s: %v", announcementChannel, err)
+	}
+}
+
+// handleChannels shows or changes where the bot may be used and how it behaves there
+func handleChannels(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) == 0 {
+		return describeChannels(ctx)
+	}
+	if len(args) != 2 {
+		return models.CommandResult{Success: false, Message: channelsUsage}
+	}
+
+	action := strings.ToLower(args[0])
+	if action == "announce" && strings.ToLower(args[1]) == "off" {
+		return applyChannelChange(ctx, adminID, "stopped mirroring transfer announcements", func(settings *models.Settings) {
+			settings.AnnouncementChannel = ""
+		})
+	}
+
+	if action == "intro" && strings.ToLower(args[1]) == "off" {
+		return applyChannelChange(ctx, adminID, "stopped introducing new members", func(settings *models.Settings) {
+			settings.IntroChannel = ""
+		})
+	}
+
+	channelID := parseChannelReference(args[1])
+	if channelID == "" {
+		return models.CommandResult{
+			Success: false,
+			Message: "Please mention the channel, e.g. `#general`.\n" + channelsUsage,
+		}
+	}
+
+	switch action {
+	case "allow":
+		return applyChannelChange(ctx, adminID, fmt.Sprintf("allowed the bot in <#%s>", channelID), func(settings *models.Settings) {
+			if !slices.Contains(settings.AllowedChannels, channelID) {
+				settings.AllowedChannels = append(settings.AllowedChannels, channelID)
+			}
+		})
+	case "remove":
+		return applyChannelChange(ctx, adminID, fmt.Sprintf("removed <#%s> from the allowed channels", channelID), func(settings *models.Settings) {
+			settings.AllowedChannels = slices.DeleteFunc(settings.AllowedChannels, func(id string) bool { return id == channelID })
+		})
+	case "quiet":
+		return applyChannelChange(ctx, adminID, fmt.Sprintf("made <#%s> quiet", channelID), func(settings *models.Settings) {
+			if !slices.Contains(settings.QuietChannels, channelID) {
+				settings.QuietChannels = append(settings.QuietChannels, channelID)
+			}
+		})
+	case "unquiet":
+		return applyChannelChange(ctx, adminID, fmt.Sprintf("made <#%s> no longer quiet", channelID), func(settings *models.Settings) {
+			settings.QuietChannels = slices.DeleteFunc(settings.QuietChannels, func(id string) bool { return id == channelID })
+		})
+	case "announce":
+		return applyChannelChange(ctx, adminID, fmt.Sprintf("set <#%s> as the announcement channel", channelID), func(settings *models.Settings) {
+			settings.AnnouncementChannel = channelID
+		})
+	case "intro":
+		return applyChannelChange(ctx, adminID, fmt.Sprintf("set <#%s> as the channel introducing new members", channelID), func(settings *models.Settings) {
+			settings.IntroChannel = channelID
+		})
+	default:
+		return models.CommandResult{Success: false, Message: channelsUsage}
+	}
+}
+
+// applyChannelChange saves a channel settings change and announces it to the admin log
+func applyChannelChange(ctx context.Context, adminID, detail string, mutate func(*models.Settings)) models.CommandResult {
+	if _, err := database.UpdateChannelSettings(ctx, adminID, detail, mutate); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error saving channel settings. Please try again.",
+		}
+	}
+
+	message := fmt.Sprintf("📣 <@%s> %s", adminID, detail)
+	announceAdminAction(message)
+
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// describeChannels lists the allowed and quiet channels, the announcement channel and the intro channel
+func describeChannels(ctx context.Context) models.CommandResult {
+	settings := database.GetSettings(ctx)
+
+	var sb strings.Builder
+	sb.WriteString("*Corbacoin Channels* 📣\n")
+	if len(settings.AllowedChannels) == 0 {
+		sb.WriteString("• Allowed: every channel\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("• Allowed: %s\n", formatChannels(settings.AllowedChannels)))
+	}
+	if len(settings.QuietChannels) == 0 {
+		sb.WriteString("• Quiet: none\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("• Quiet: %s\n", formatChannels(settings.QuietChannels)))
+	}
+	if settings.AnnouncementChannel == "" {
+		sb.WriteString("• Announcements: not mirrored\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("• Announcements: mirrored to <#%s>\n", settings.AnnouncementChannel))
+	}
+	if settings.IntroChannel == "" {
+		sb.WriteString("• New members: not introduced\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("• New members: introduced in <#%s>\n", settings.IntroChannel))
+	}
+
+	return models.CommandResult{Success: true, Message: sb.String()}
+}
+
+// formatChannels renders channel IDs as Slack channel links
+func formatChannels(channelIDs []string) string {
+	links := make([]string, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		links = append(links, fmt.Sprintf("<#%s>", channelID))
+	}
+	return strings.Join(links, ", ")
+}
+
+// parseChannelReference extracts the channel ID from a channel mention or bare ID
+func parseChannelReference(token string) string {
+	matches := channelReferencePattern.FindStringSubmatch(token)
+	if matches == nil {
+		return ""
+	}
+	if matches[1] != "" {
+		return matches[1]
+	}
+	return matches[2]
+}
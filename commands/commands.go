@@ -2,133 +2,274 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
 	"github.com/unacorbatanegra/corbacoin-bot/database"
 	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/policy"
 )
 
-// HandleBalance returns the balance for a user
+// HandleBalance returns the balance for a user, followed by their giving streak and badges
 func HandleBalance(ctx context.Context, userID, username string) (string, error) {
 	user, err := database.GetUser(ctx, userID, username)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("<@%s> has %d :corbacoin:", userID, user.Coins), nil
+	message := fmt.Sprintf("<@%s> has %d :corbacoin:", userID, user.Coins)
+	if streak := formatStreak(user); streak != "" {
+		message += " · " + streak
+	}
+	if summary := badges.Summary(user); summary != "" {
+		message += " " + summary
+	}
+	return message, nil
 }
 
-// ParseSendCommand parses a send command to extract recipient userID and amount
+// ParseSendCommand parses a send command to extract recipient userID, amount and an optional memo
 // Accepts both Slack mention format <@U12345678> and plain userID/username
-func ParseSendCommand(text string) (recipientID string, amount int, ok bool) {
+func ParseSendCommand(text string) (recipientID string, amount int, memo string, ok bool) {
 	log.Printf("ParseSendCommand input: '%s'", text)
 	
-	// Try to match Slack mention format first: <@U12345678> 100
-	re := regexp.MustCompile(`<@([A-Z0-9]+)>\s+(\d+)`)
+	// Try to match Slack mention format first: <@U12345678> 100 for the pizza
+	re := regexp.MustCompile(`<@([A-Z0-9]+)>\s+(\d+)(?:\s+(.+))?`)
 	matches := re.FindStringSubmatch(strings.TrimSpace(text))
 
 	if len(matches) >= 3 {
 		recipientID = matches[1]
 		amount, err := strconv.Atoi(matches[2])
 		if err != nil {
-			return "", 0, false
+			return "", 0, "", false
 		}
-		log.Printf("ParseSendCommand matched mention format: recipientID=%s, amount=%d", recipientID, amount)
-		return recipientID, amount, true
+		memo = strings.TrimSpace(matches[3])
+		log.Printf("ParseSendCommand matched mention format: recipientID=%s, amount=%d, memo=%s", recipientID, amount, memo)
+		return recipientID, amount, memo, true
 	}
 
 	// Fallback to simple format: @username 100 or username 100
-	re = regexp.MustCompile(`@?(\w+)\s+(\d+)`)
+	re = regexp.MustCompile(`@?(\w+)\s+(\d+)(?:\s+(.+))?`)
 	matches = re.FindStringSubmatch(strings.TrimSpace(text))
 
 	if len(matches) < 3 {
 		log.Printf("ParseSendCommand: no match found")
-		return "", 0, false
+		return "", 0, "", false
 	}
 
 	recipientID = matches[1]
 	amount, err := strconv.Atoi(matches[2])
 	if err != nil {
-		return "", 0, false
+		return "", 0, "", false
+	}
+	memo = strings.TrimSpace(matches[3])
+
+	log.Printf("ParseSendCommand matched fallback format: recipientID=%s, amount=%d, memo=%s", recipientID, amount, memo)
+	return recipientID, amount, memo, true
+}
+
+// ParseVisibility strips a trailing --public or --private flag from a command's text
+// and reports whether the result should be posted to the channel
+// A bare "public" or "private" also counts when nothing but a user and a number comes before it,
+// as in "@alice 5 private" or "3 private", so it is never taken out of a memo
+func ParseVisibility(text string, defaultPublic bool) (rest string, public bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", defaultPublic
+	}
+
+	last := strings.ToLower(fields[len(fields)-1])
+	if bareVisibilityAllowed(fields) {
+		last = "--" + strings.TrimPrefix(last, "--")
 	}
+	switch last {
+	case "--public":
+		return strings.Join(fields[:len(fields)-1], " "), true
+	case "--private":
+		return strings.Join(fields[:len(fields)-1], " "), false
+	}
+
+	return strings.TrimSpace(text), defaultPublic
+}
 
-	log.Printf("ParseSendCommand matched fallback format: recipientID=%s, amount=%d", recipientID, amount)
-	return recipientID, amount, true
+// bareVisibilityAllowed reports whether the last field can only be a visibility word: it is the whole
+// text, or it follows an amount or count with at most a recipient before it, leaving no memo to belong to
+func bareVisibilityAllowed(fields []string) bool {
+	if len(fields) == 1 {
+		return true
+	}
+	if len(fields) > 3 {
+		return false
+	}
+	_, err := strconv.Atoi(fields[len(fields)-2])
+	return err == nil
 }
 
 // HandleSend processes a send command to transfer coins between users
-func HandleSend(ctx context.Context, senderID, senderName, recipientID, recipientName string, amount int) models.CommandResult {
-	if amount <= 0 {
+// Transfers above the workspace's large transfer threshold are held until the sender confirms them
+func HandleSend(ctx context.Context, req models.TransferRequest) models.CommandResult {
+	if req.Amount <= 0 {
 		return models.CommandResult{
 			Success: false,
 			Message: "Amount must be positive!",
 		}
 	}
 
-	sender, err := database.GetUser(ctx, senderID, senderName)
+	if req.Amount > database.GetSettings(ctx).LargeTransferThreshold {
+		return requestConfirmation(ctx, req)
+	}
+
+	return ExecuteTransfer(ctx, req)
+}
+
+// ExecuteTransfer moves coins from the sender to the recipient after checking the sender's balance
+func ExecuteTransfer(ctx context.Context, req models.TransferRequest) models.CommandResult {
+	if result, ok := validateTransfer(ctx, req); !ok {
+		return result
+	}
+
+	// Perform transfer
+	transfer := &models.Transfer{
+		Type:        models.TransferTypeTransfer,
+		SenderID:    req.SenderID,
+		RecipientID: req.RecipientID,
+		Amount:      req.Amount,
+		Memo:        req.Memo,
+		CreatedAt:   time.Now(),
+	}
+	if err := database.Transfer(ctx, transfer); err != nil {
+		switch {
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return models.CommandResult{
+				Success: false,
+				Message: "Insufficient funds! Your balance changed before the transfer went through.",
+			}
+		case errors.Is(err, database.ErrSenderFrozen):
+			return frozenSenderResult()
+		case errors.Is(err, database.ErrRecipientFrozen):
+			return frozenRecipientResult(req.RecipientID)
+		}
+		return models.CommandResult{
+			Success: false,
+			Message: "Error processing transfer. Please try again.",
+		}
+	}
+
+	notifyRecipient(ctx, transfer)
+	recordGivingStreak(ctx, transfer)
+	badges.Check(ctx, req.SenderID, req.RecipientID)
+
+	message := fmt.Sprintf("<@%s> sent %d :corbacoin: to <@%s> :corbacoin:", req.SenderID, req.Amount, req.RecipientID)
+	if req.Memo != "" {
+		message += fmt.Sprintf(" — _%s_", req.Memo)
+	}
+	return models.CommandResult{
+		Success: true,
+		Message: message,
+		Blocks:  undoableTransferBlocks(ctx, message, transfer.ID),
+	}
+}
+
+// validateTransfer makes sure both wallets exist and are active, the sender can afford the transfer
+// and no transfer policy blocks it
+func validateTransfer(ctx context.Context, req models.TransferRequest) (models.CommandResult, bool) {
+	sender, err := database.GetUser(ctx, req.SenderID, req.SenderName)
 	if err != nil {
 		return models.CommandResult{
 			Success: false,
 			Message: "Error checking balance. Please try again.",
-		}
+		}, false
+	}
+
+	if sender.IsFrozen() {
+		return frozenSenderResult(), false
 	}
 
-	if sender.Coins < amount {
+	if sender.Coins < req.Amount {
 		return models.CommandResult{
 			Success: false,
 			Message: fmt.Sprintf("Insufficient funds! You have %d :corbacoin:.", sender.Coins),
-		}
+		}, false
 	}
 
 	// Get or create recipient user
-	_, err = database.GetUser(ctx, recipientID, recipientName)
+	recipient, err := database.GetUser(ctx, req.RecipientID, req.RecipientName)
 	if err != nil {
 		return models.CommandResult{
 			Success: false,
 			Message: "Error finding recipient. Please try again.",
-		}
+		}, false
 	}
 
-	// Perform transfer
-	if _, err := database.UpdateCoins(ctx, senderID, -amount); err != nil {
+	if recipient.IsFrozen() {
+		return frozenRecipientResult(req.RecipientID), false
+	}
+
+	reason, err := policy.Evaluate(ctx, req)
+	if err != nil {
 		return models.CommandResult{
 			Success: false,
-			Message: "Error processing transfer. Please try again.",
-		}
+			Message: "Error checking transfer limits. Please try again.",
+		}, false
 	}
-
-	if _, err := database.UpdateCoins(ctx, recipientID, amount); err != nil {
-		// Try to rollback
-		database.UpdateCoins(ctx, senderID, amount)
+	if reason != "" {
 		return models.CommandResult{
 			Success: false,
-			Message: "Error processing transfer. Please try again.",
-		}
+			Message: "🚫 " + reason,
+		}, false
 	}
 
+	return models.CommandResult{}, true
+}
+
+// frozenSenderResult is the result returned when the sender's wallet is frozen
+func frozenSenderResult() models.CommandResult {
 	return models.CommandResult{
-		Success: true,
-		Message: fmt.Sprintf("<@%s> sent %d :corbacoin: to <@%s> :corbacoin:", senderID, amount, recipientID),
+		Success: false,
+		Message: "❄️ Your wallet is frozen, so you can't send coins. Please contact an admin.",
 	}
 }
 
-// HandleLeaderboard returns the leaderboard of top users
-func HandleLeaderboard(ctx context.Context) (string, error) {
-	users, err := database.GetLeaderboard(ctx, config.LeaderboardLimit)
+// frozenRecipientResult is the result returned when the recipient's wallet is frozen
+func frozenRecipientResult(recipientID string) models.CommandResult {
+	return models.CommandResult{
+		Success: false,
+		Message: fmt.Sprintf("❄️ <@%s>'s wallet is frozen, so they can't receive coins.", recipientID),
+	}
+}
+
+// HandleLeaderboard returns the leaderboard of top users for the current season,
+// or the archived ranking of a past season when text is "season N"
+func HandleLeaderboard(ctx context.Context, text string) (string, error) {
+	args := strings.Fields(text)
+	if len(args) > 0 && strings.ToLower(args[0]) == "season" {
+		if len(args) != 2 {
+			return "Usage: `leaderboard season number`", nil
+		}
+		number, err := strconv.Atoi(args[1])
+		if err != nil || number <= 0 {
+			return "Usage: `leaderboard season number`", nil
+		}
+		return HandleSeasonLeaderboard(ctx, number)
+	}
+
+	settings := database.GetSettings(ctx)
+	users, err := database.GetLeaderboard(ctx, settings.LeaderboardLimit)
 	if err != nil {
 		return "", err
 	}
 
+	header := fmt.Sprintf("*Corbacoin Leaderboard — Season %d* 🏆\n", settings.CurrentSeason)
 	if len(users) == 0 {
-		return "*Corbacoin Leaderboard* 🏆\nNo users found.", nil
+		return header + "No users found.", nil
 	}
 
 	var sb strings.Builder
-	sb.WriteString("*Corbacoin Leaderboard* 🏆\n")
+	sb.WriteString(header)
 	for i, user := range users {
 		sb.WriteString(fmt.Sprintf("%d. @%s: %d :corbacoin:\n", i+1, user.Username, user.Coins))
 	}
@@ -142,8 +283,18 @@ func GetHelpMessage(isAppMention bool) string {
 		return `*Corbacoin Bot Commands*
 
 • ` + "`@CorbacoinBot balance`" + ` - Check your balance
-• ` + "`@CorbacoinBot send @user amount`" + ` - Send corbacoins
-• ` + "`@CorbacoinBot leaderboard`" + ` - View top 10 users
+• ` + "`@CorbacoinBot send @user|@group amount [memo]`" + ` - Send corbacoins to a user, or to each member of a user group
+• ` + "`@CorbacoinBot leaderboard [season number]`" + ` - View top 10 users, or the final ranking of a past season
+• ` + "`@CorbacoinBot notifications [instant|daily|mute]`" + ` - Choose how you hear about received coins
+• ` + "`@CorbacoinBot stats`" + ` - View economy statistics
+• ` + "`@CorbacoinBot profile [@user]`" + ` - View a balance and badges
+• ` + "`@CorbacoinBot shop`" + ` - Browse items you can buy with your coins
+• ` + "`@CorbacoinBot buy id`" + ` - Buy an item from the shop
+• ` + "`@CorbacoinBot bet create \"question\" yes no`" + ` - Open a prediction market, then ` + "`bet stake id option amount`" + `
+• ` + "`@CorbacoinBot raffle start price --ends 17:00`" + ` - Start a raffle, then ` + "`raffle buy id [count]`" + `
+• ` + "`@CorbacoinBot pot create \"title\" goal [@beneficiary]`" + ` - Crowdfund a shared goal, then ` + "`pot give id amount`" + `
+• ` + "`@CorbacoinBot rain amount [memo]`" + ` - Split coins among the people who posted here recently
+• ` + "`@CorbacoinBot lend @user amount due 2026-11-30 [interest 5%]`" + ` - Offer a loan, then ` + "`repay id [amount]`" + ` and ` + "`loans`" + `
 • ` + "`@CorbacoinBot help`" + ` - Show this message
 
 You can use these in any channel or thread!`
@@ -152,7 +303,21 @@ You can use these in any channel or thread!`
 	return `*Corbacoin Slash Commands*
 
 • ` + "`/balance`" + ` - Check your balance
-• ` + "`/send @user amount`" + ` - Send corbacoins
-• ` + "`/leaderboard`" + ` - View top 10 users`
+• ` + "`/send @user|@group amount [memo]`" + ` - Send corbacoins to a user, or to each member of a user group
+• ` + "`/leaderboard [season number]`" + ` - View top 10 users, or the final ranking of a past season
+• ` + "`/corbacoin notifications [instant|daily|mute]`" + ` - Choose how you hear about received coins
+• ` + "`/corbacoin stats [--public]`" + ` - View economy statistics
+• ` + "`/corbacoin profile [@user]`" + ` - View a balance and badges
+• ` + "`/shop`" + ` - Browse items you can buy with your coins
+• ` + "`/buy id`" + ` - Buy an item from the shop
+• ` + "`/bet create \"question\" yes no [--closes 17:00]`" + ` - Open a prediction market, then ` + "`/bet stake id option amount`" + `
+• ` + "`/raffle start price --ends 17:00`" + ` - Start a raffle, then ` + "`/raffle buy id [count]`" + `
+• ` + "`/pot create \"title\" goal [@beneficiary] [--deadline 3d]`" + ` - Crowdfund a shared goal, then ` + "`/pot give id amount`" + `
+• ` + "`/rain amount [memo]`" + ` - Split coins evenly among the people who posted in the channel recently
+• ` + "`/lend @user amount due 2026-11-30 [interest 5%]`" + ` - Offer a loan the borrower accepts with a button
+• ` + "`/repay id [amount]`" + ` - Repay part or all of a loan
+• ` + "`/loans`" + ` - View the loans you made and took, including defaulted ones
+
+Add ` + "`--private`" + ` to ` + "`/balance`" + `, ` + "`/send`" + ` or ` + "`/leaderboard`" + ` to keep the result to yourself.`
 }
 
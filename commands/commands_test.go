@@ -0,0 +1,88 @@
+package commands
+
+import "testing"
+
+func TestParseSendCommand(t *testing.T) {
+	tests := []struct {
+		name            string
+		text            string
+		wantRecipientID string
+		wantAmount      int
+		wantMemo        string
+		wantOK          bool
+	}{
+		{
+			name:            "mention with memo",
+			text:            "<@U12345678> 100 for the pizza",
+			wantRecipientID: "U12345678",
+			wantAmount:      100,
+			wantMemo:        "for the pizza",
+			wantOK:          true,
+		},
+		{
+			name:            "mention without memo",
+			text:            "  <@U12345678> 5  ",
+			wantRecipientID: "U12345678",
+			wantAmount:      5,
+			wantOK:          true,
+		},
+		{
+			name:            "plain username",
+			text:            "@alice 20 thanks",
+			wantRecipientID: "alice",
+			wantAmount:      20,
+			wantMemo:        "thanks",
+			wantOK:          true,
+		},
+		{
+			name: "missing amount",
+			text: "<@U12345678> lots",
+		},
+		{
+			name: "empty text",
+			text: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipientID, amount, memo, ok := ParseSendCommand(tt.text)
+			if recipientID != tt.wantRecipientID || amount != tt.wantAmount || memo != tt.wantMemo || ok != tt.wantOK {
+				t.Errorf("ParseSendCommand(%q) = (%q, %d, %q, %v), want (%q, %d, %q, %v)",
+					tt.text, recipientID, amount, memo, ok, tt.wantRecipientID, tt.wantAmount, tt.wantMemo, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseVisibility(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		defaultPublic bool
+		wantRest      string
+		wantPublic    bool
+	}{
+		{name: "empty text keeps the default", text: "", defaultPublic: true, wantRest: "", wantPublic: true},
+		{name: "no flag keeps the default", text: "<@U1> 10 lunch", defaultPublic: false, wantRest: "<@U1> 10 lunch", wantPublic: false},
+		{name: "private flag", text: "<@U1> 10 lunch --private", defaultPublic: true, wantRest: "<@U1> 10 lunch", wantPublic: false},
+		{name: "public flag", text: "<@U1> 10 lunch --PUBLIC", defaultPublic: false, wantRest: "<@U1> 10 lunch", wantPublic: true},
+		{name: "word at the end of a memo is kept", text: "<@U1> 10 thanks for going public", defaultPublic: false, wantRest: "<@U1> 10 thanks for going public", wantPublic: false},
+		{name: "bare word as the whole text", text: "private", defaultPublic: true, wantRest: "", wantPublic: false},
+		{name: "flag as the whole text", text: "--public", defaultPublic: false, wantRest: "", wantPublic: true},
+		{name: "bare word after the amount", text: "<@U1> 5 private", defaultPublic: true, wantRest: "<@U1> 5", wantPublic: false},
+		{name: "bare word after a count", text: "3 private", defaultPublic: true, wantRest: "3", wantPublic: false},
+		{name: "bare word after a one-word memo is kept", text: "<@U1> 5 lunch private", defaultPublic: true, wantRest: "<@U1> 5 lunch private", wantPublic: true},
+		{name: "number inside a memo is not an amount", text: "<@U1> 5 for 2 public", defaultPublic: false, wantRest: "<@U1> 5 for 2 public", wantPublic: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, public := ParseVisibility(tt.text, tt.defaultPublic)
+			if rest != tt.wantRest || public != tt.wantPublic {
+				t.Errorf("ParseVisibility(%q, %v) = (%q, %v), want (%q, %v)",
+					tt.text, tt.defaultPublic, rest, public, tt.wantRest, tt.wantPublic)
+			}
+		})
+	}
+}
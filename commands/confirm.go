@@ -0,0 +1,137 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+const (
+	// ActionConfirmTransfer is the action ID of the button confirming a large transfer
+	ActionConfirmTransfer = "confirm_transfer"
+
+	// ActionCancelTransfer is the action ID of the button cancelling a large transfer
+	ActionCancelTransfer = "cancel_transfer"
+)
+
+// requestConfirmation stores a large transfer as pending and returns a prompt with Confirm/Cancel buttons
+func requestConfirmation(ctx context.Context, req models.TransferRequest) models.CommandResult {
+	// Fail early when the transfer could not go through anyway
+	if result, ok := validateTransfer(ctx, req); !ok {
+		return result
+	}
+
+	message := fmt.Sprintf("You are about to send %d :corbacoin: to <@%s>. Are you sure?", req.Amount, req.RecipientID)
+	return confirmationPrompt(ctx, &models.PendingTransfer{Transfer: req}, message)
+}
+
+// confirmationPrompt stores a transfer as pending and returns the message with Confirm/Cancel buttons
+func confirmationPrompt(ctx context.Context, pending *models.PendingTransfer, message string) models.CommandResult {
+	now := time.Now()
+	pending.CreatedAt = now
+	pending.ExpiresAt = now.Add(config.PendingTransferExpiry * time.Second)
+
+	id, err := database.CreatePendingTransfer(ctx, pending)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error processing transfer. Please try again.",
+		}
+	}
+
+	return models.CommandResult{
+		Success:   true,
+		Message:   message,
+		Ephemeral: true,
+		Blocks: []models.Block{
+			slack.SectionBlock(message + fmt.Sprintf("\n_This request expires in %d minutes._", config.PendingTransferExpiry/60)),
+			slack.ActionsBlock("pending_transfer",
+				slack.Button("Confirm", ActionConfirmTransfer, id, "primary"),
+				slack.Button("Cancel", ActionCancelTransfer, id, "danger"),
+			),
+		},
+	}
+}
+
+// ConfirmTransfer executes a pending transfer on behalf of the user who requested it
+// The sender's balance is checked again at confirmation time
+func ConfirmTransfer(ctx context.Context, pendingID, userID string) (models.CommandResult, *models.TransferRequest) {
+	pending, result, ok := claimPendingTransfer(ctx, pendingID, userID)
+	if !ok {
+		return result, nil
+	}
+
+	if time.Now().After(pending.ExpiresAt) {
+		log.Printf("Pending transfer %s expired at %v", pendingID, pending.ExpiresAt)
+		return models.CommandResult{
+			Success: false,
+			Message: "This transfer request has expired. Please send it again.",
+		}, nil
+	}
+
+	switch {
+	case pending.GroupID != "":
+		return executeGroupTransfer(ctx, pending.GroupID, pending.Batch, nil), &pending.Transfer
+	case len(pending.Batch) > 0:
+		return executeRain(ctx, pending.Transfer, pending.Batch, nil), &pending.Transfer
+	}
+	return ExecuteTransfer(ctx, pending.Transfer), &pending.Transfer
+}
+
+// CancelTransfer discards a pending transfer on behalf of the user who requested it
+func CancelTransfer(ctx context.Context, pendingID, userID string) models.CommandResult {
+	pending, result, ok := claimPendingTransfer(ctx, pendingID, userID)
+	if !ok {
+		return result
+	}
+
+	switch {
+	case pending.GroupID != "":
+		return models.CommandResult{
+			Success: true,
+			Message: fmt.Sprintf("Transfer of %d :corbacoin: to each member of <!subteam^%s> cancelled.", pending.Transfer.Amount, pending.GroupID),
+		}
+	case len(pending.Batch) > 0:
+		return models.CommandResult{
+			Success: true,
+			Message: fmt.Sprintf("Rain of %d :corbacoin: cancelled.", pending.Transfer.Amount),
+		}
+	}
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("Transfer of %d :corbacoin: to <@%s> cancelled.", pending.Transfer.Amount, pending.Transfer.RecipientID),
+	}
+}
+
+// claimPendingTransfer loads a pending transfer and removes it so it can only be handled once
+func claimPendingTransfer(ctx context.Context, pendingID, userID string) (*models.PendingTransfer, models.CommandResult, bool) {
+	pending, err := database.GetPendingTransfer(ctx, pendingID)
+	if err != nil {
+		return nil, models.CommandResult{
+			Success: false,
+			Message: "This transfer request was already handled or has expired.",
+		}, false
+	}
+
+	if pending.Transfer.SenderID != userID {
+		return nil, models.CommandResult{
+			Success: false,
+			Message: "Only the sender can confirm or cancel this transfer.",
+		}, false
+	}
+
+	if err := database.DeletePendingTransfer(ctx, pendingID); err != nil {
+		return nil, models.CommandResult{
+			Success: false,
+			Message: "This transfer request was already handled or has expired.",
+		}, false
+	}
+
+	return pending, models.CommandResult{}, true
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// ApplyDemurrage decays the part of idle balances above the workspace's threshold into the treasury
+// It does nothing unless demurrage is enabled in the workspace settings
+func ApplyDemurrage(ctx context.Context) error {
+	settings := database.GetSettings(ctx)
+	if settings.DemurrageEnabled == 0 {
+		log.Println("Demurrage is disabled, skipping")
+		return nil
+	}
+
+	users, err := database.GetAllUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	decay := func(user models.User) int {
+		return demurrageDue(settings, user, now)
+	}
+
+	var candidates, unknown []string
+	for _, user := range users {
+		if decay(user) > 0 {
+			candidates = append(candidates, user.UserID)
+		} else if !user.System && lastActive(user).IsZero() {
+			unknown = append(unknown, user.UserID)
+		}
+	}
+
+	// Older wallets don't record when they were created; their idle time starts counting now
+	if len(unknown) > 0 {
+		if err := database.MarkIdleSince(ctx, unknown, now); err != nil {
+			return err
+		}
+		log.Printf("Demurrage started the idle clock of %d wallets without recorded activity", len(unknown))
+	}
+
+	// The amount is computed again inside each transaction, against fresh balances
+	decayed := 0
+	for start := 0; start < len(candidates); start += config.WalletBatchSize {
+		end := min(start+config.WalletBatchSize, len(candidates))
+		entries, err := database.ApplyDemurrage(ctx, candidates[start:end], config.TreasuryAccountID, decay)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			decayed += entry.Amount
+			message := fmt.Sprintf("⏳ %d :corbacoin: of your balance decayed to the treasury because you haven't sent coins in %d days. Balances above %d :corbacoin: lose %d%% every %d days while idle.",
+				entry.Amount, settings.DemurrageIdleDays, settings.DemurrageThreshold, settings.DemurrageRatePercent, settings.DemurragePeriodDays)
+			if err := slack.SendDirectMessage(entry.SenderID, message); err != nil {
+				log.Printf("Error notifying %s of demurrage: %v", entry.SenderID, err)
+			}
+		}
+	}
+
+	log.Printf("Demurrage applied: %d :corbacoin: collected from %d candidate wallets", decayed, len(candidates))
+	return nil
+}
+
+// demurrageDue returns how many coins a wallet loses now, or 0 if it is exempt or not due yet
+func demurrageDue(settings models.Settings, user models.User, now time.Time) int {
+	if user.System || user.IsFrozen() || user.Coins <= settings.DemurrageThreshold {
+		return 0
+	}
+
+	// Wallets whose activity is unknown are not idle until MarkIdleSince starts their clock
+	active := lastActive(user)
+	if active.IsZero() || now.Sub(active) < time.Duration(settings.DemurrageIdleDays)*24*time.Hour {
+		return 0
+	}
+	if now.Sub(user.LastDemurrageAt) < time.Duration(settings.DemurragePeriodDays)*24*time.Hour {
+		return 0
+	}
+
+	return (user.Coins - settings.DemurrageThreshold) * settings.DemurrageRatePercent / 100
+}
+
+// lastActive returns when a wallet last sent coins, falling back to when it was created and then to when
+// demurrage first saw it, or the zero time if none is known
+func lastActive(user models.User) time.Time {
+	switch {
+	case !user.LastSentAt.IsZero():
+		return user.LastSentAt
+	case !user.CreatedAt.IsZero():
+		return user.CreatedAt
+	default:
+		return user.IdleSince
+	}
+}
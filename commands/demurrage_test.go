@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+func TestDemurrageDue(t *testing.T) {
+	now := time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC)
+	settings := models.Settings{
+		DemurrageThreshold:   50,
+		DemurrageRatePercent: 10,
+		DemurragePeriodDays:  7,
+		DemurrageIdleDays:    14,
+	}
+	daysAgo := func(days int) time.Time { return now.AddDate(0, 0, -days) }
+
+	tests := []struct {
+		name string
+		user models.User
+		want int
+	}{
+		{name: "idle sender", user: models.User{Coins: 150, LastSentAt: daysAgo(20)}, want: 10},
+		{name: "recent sender", user: models.User{Coins: 150, LastSentAt: daysAgo(3)}, want: 0},
+		{name: "never sent, created long ago", user: models.User{Coins: 150, CreatedAt: daysAgo(30)}, want: 10},
+		{name: "never sent, created recently", user: models.User{Coins: 150, CreatedAt: daysAgo(3)}, want: 0},
+		{name: "no recorded activity", user: models.User{Coins: 150}, want: 0},
+		{name: "idle since the first run", user: models.User{Coins: 150, IdleSince: daysAgo(15)}, want: 10},
+		{name: "decayed within the period", user: models.User{Coins: 150, LastSentAt: daysAgo(20), LastDemurrageAt: daysAgo(2)}, want: 0},
+		{name: "at the threshold", user: models.User{Coins: 50, LastSentAt: daysAgo(20)}, want: 0},
+		{name: "frozen wallet", user: models.User{Coins: 150, LastSentAt: daysAgo(20), Status: models.UserStatusFrozen}, want: 0},
+		{name: "system wallet", user: models.User{Coins: 150, System: true}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := demurrageDue(settings, tt.user, now); got != tt.want {
+				t.Errorf("demurrageDue() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// userTotal is the amount of coins associated with a user over a period
+type userTotal struct {
+	UserID string
+	Amount int
+}
+
+// PostWeeklyDigest posts a recap of the last seven days of transfers to config.DigestChannel
+func PostWeeklyDigest(ctx context.Context) error {
+	if config.DigestChannel == "" {
+		return fmt.Errorf("DIGEST_CHANNEL is not set")
+	}
+
+	since := time.Now().AddDate(0, 0, -7)
+	transfers, err := database.GetTransfersSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	newcomers, err := database.GetUsersCreatedSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	message, podium := buildWeeklyDigest(transfers, newcomers)
+	if err := slack.SendMessage(config.DigestChannel, message, ""); err != nil {
+		return err
+	}
+
+	// The week's top receivers count towards the podium badge, once even when the digest is retried
+	year, week := time.Now().ISOWeek()
+	counted, err := database.IncrementWeeklyPodiums(ctx, fmt.Sprintf("%d-W%02d", year, week), podium)
+	if err != nil {
+		return err
+	}
+	if counted {
+		badges.Check(ctx, podium...)
+	}
+
+	log.Printf("Weekly digest posted to %s (%d transfers, %d newcomers)", config.DigestChannel, len(transfers), len(newcomers))
+	return nil
+}
+
+// buildWeeklyDigest formats the weekly recap from the week's transfers and newly created users
+// It also returns the IDs of the week's top receivers
+func buildWeeklyDigest(transfers []models.Transfer, newcomers []models.User) (string, []string) {
+	received := make(map[string]int)
+	given := make(map[string]int)
+	total := 0
+	count := 0
+	var biggest *models.Transfer
+	var podium []string
+
+	for i := range transfers {
+		transfer := &transfers[i]
+		// Undone transfers and self-sends did not actually move coins
+		if transfer.Type != models.TransferTypeTransfer || transfer.ReversedBy != "" || transfer.SenderID == transfer.RecipientID {
+			continue
+		}
+
+		received[transfer.RecipientID] += transfer.Amount
+		given[transfer.SenderID] += transfer.Amount
+		total += transfer.Amount
+		count++
+		if biggest == nil || transfer.Amount > biggest.Amount {
+			biggest = transfer
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*Corbacoin Weekly Digest* 📰\n")
+
+	if count == 0 {
+		sb.WriteString("No coins changed hands this week.\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("%d :corbacoin: moved in %d transfers.\n", total, count))
+
+		sb.WriteString("\n*Top receivers*\n")
+		for i, entry := range topTotals(received, config.DigestTopCount) {
+			podium = append(podium, entry.UserID)
+			sb.WriteString(fmt.Sprintf("%d. <@%s>: %d :corbacoin:\n", i+1, entry.UserID, entry.Amount))
+		}
+
+		sb.WriteString("\n*Top givers*\n")
+		for i, entry := range topTotals(given, config.DigestTopCount) {
+			sb.WriteString(fmt.Sprintf("%d. <@%s>: %d :corbacoin:\n", i+1, entry.UserID, entry.Amount))
+		}
+
+		sb.WriteString(fmt.Sprintf("\n*Biggest transfer*\n<@%s> → <@%s>: %d :corbacoin:", biggest.SenderID, biggest.RecipientID, biggest.Amount))
+		if biggest.Memo != "" {
+			sb.WriteString(fmt.Sprintf(" — _%s_", biggest.Memo))
+		}
+		sb.WriteString("\n")
+	}
+
+	// System wallets are not people to welcome
+	mentions := make([]string, 0, len(newcomers))
+	for _, user := range newcomers {
+		if !user.System {
+			mentions = append(mentions, fmt.Sprintf("<@%s>", user.UserID))
+		}
+	}
+	if len(mentions) > 0 {
+		sb.WriteString(fmt.Sprintf("\n*Welcome to our newcomers* 👋\n%s\n", strings.Join(mentions, ", ")))
+	}
+
+	return sb.String(), podium
+}
+
+// topTotals returns the limit highest totals, largest first
+func topTotals(totals map[string]int, limit int) []userTotal {
+	entries := make([]userTotal, 0, len(totals))
+	for userID, amount := range totals {
+		entries = append(entries, userTotal{UserID: userID, Amount: amount})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Amount != entries[j].Amount {
+			return entries[i].Amount > entries[j].Amount
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries
+}
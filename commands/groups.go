@@ -0,0 +1,280 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/policy"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+var (
+	// ErrSendUsage is returned when a send command can't be parsed
+	ErrSendUsage = errors.New("invalid send command")
+
+	// groupMentionPattern matches a user group mention such as <!subteam^S123|@backend-team> 2 for the release
+	groupMentionPattern = regexp.MustCompile(`^<!subteam\^([A-Z0-9]+)(?:\|[^>]*)?>\s+(\d+)(?:\s+(.+))?$`)
+
+	// groupHandlePattern matches an unescaped user group handle such as @backend-team 2
+	groupHandlePattern = regexp.MustCompile(`^@?([\w.-]+)\s+(\d+)(?:\s+(.+))?$`)
+)
+
+// SendTarget is who a send command pays: a single user, or every member of a user group
+type SendTarget struct {
+	User    *models.SlackUserInfo
+	GroupID string
+}
+
+// ResolveSendTarget parses a send command and looks up who it pays
+// Users are tried before user groups, so a plain @handle only names a group when no user matches it
+func ResolveSendTarget(text string) (target SendTarget, amount int, memo string, err error) {
+	text = strings.TrimSpace(text)
+	if matches := groupMentionPattern.FindStringSubmatch(text); matches != nil {
+		amount, err := strconv.Atoi(matches[2])
+		if err != nil {
+			return SendTarget{}, 0, "", ErrSendUsage
+		}
+		return SendTarget{GroupID: matches[1]}, amount, strings.TrimSpace(matches[3]), nil
+	}
+
+	recipientIdentifier, amount, memo, ok := ParseSendCommand(text)
+	if !ok {
+		return SendTarget{}, 0, "", ErrSendUsage
+	}
+
+	// Get recipient user info from Slack (works with both user_id and username)
+	recipientInfo, err := slack.GetOrFindUser(recipientIdentifier)
+	if err == nil {
+		return SendTarget{User: recipientInfo}, amount, memo, nil
+	}
+
+	// Without escaping, a group mention arrives as its plain handle
+	if matches := groupHandlePattern.FindStringSubmatch(text); matches != nil {
+		group, groupErr := slack.FindUserGroupByHandle(matches[1])
+		if groupErr == nil {
+			amount, _ := strconv.Atoi(matches[2])
+			return SendTarget{GroupID: group.ID}, amount, strings.TrimSpace(matches[3]), nil
+		}
+		log.Printf("No user group found for %s: %v", matches[1], groupErr)
+	}
+
+	return SendTarget{}, 0, "", fmt.Errorf("Could not find user '%s'. %v", recipientIdentifier, err)
+}
+
+// HandleGroupSend sends the requested amount to every member of a user group, except the sender,
+// bots and deactivated users
+// The transfers go through together or not at all, and are held for confirmation when their total
+// is above the workspace's large transfer threshold
+func HandleGroupSend(ctx context.Context, req models.TransferRequest, groupID string) models.CommandResult {
+	if req.Amount <= 0 {
+		return models.CommandResult{
+			Success: false,
+			Message: "Amount must be positive!",
+		}
+	}
+
+	members, err := slack.GetUserGroupMembers(groupID)
+	if err != nil {
+		log.Printf("Error listing members of user group %s: %v", groupID, err)
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Error listing the members of <!subteam^%s>. Please try again.", groupID),
+		}
+	}
+
+	// Check the size before looking up every member
+	if len(members) > config.MaxGroupSendMembers {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("<!subteam^%s> has %d members; you can send coins to groups of up to %d.", groupID, len(members), config.MaxGroupSendMembers),
+		}
+	}
+
+	batch, recipients := groupTransferRequests(req, members)
+	if len(batch) == 0 {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("<!subteam^%s> has no members you can send coins to.", groupID),
+		}
+	}
+
+	total := req.Amount * len(batch)
+	if total > database.GetSettings(ctx).LargeTransferThreshold {
+		// Fail early when the transfers could not go through anyway
+		if result, ok := validateBatch(ctx, batch, recipients); !ok {
+			return result
+		}
+
+		message := fmt.Sprintf("You are about to send %d :corbacoin: to each of the %d members of <!subteam^%s>, %d :corbacoin: in total. Are you sure?",
+			req.Amount, len(batch), groupID, total)
+		return confirmationPrompt(ctx, &models.PendingTransfer{Transfer: req, GroupID: groupID, Batch: batch}, message)
+	}
+
+	return executeGroupTransfer(ctx, groupID, batch, recipients)
+}
+
+// groupTransferRequests builds one transfer request per member who can be paid, and returns the
+// Slack profiles of the members it looked up by user ID
+func groupTransferRequests(req models.TransferRequest, members []string) ([]models.TransferRequest, map[string]*models.SlackUserInfo) {
+	seen := make(map[string]bool)
+	recipients := make(map[string]*models.SlackUserInfo)
+	var batch []models.TransferRequest
+	for _, memberID := range members {
+		if memberID == req.SenderID || seen[memberID] {
+			continue
+		}
+		seen[memberID] = true
+
+		member, err := slack.GetUserInfo(memberID)
+		if err != nil {
+			log.Printf("Error fetching user group member %s: %v", memberID, err)
+			continue
+		}
+		if member.IsBot || member.Deleted {
+			continue
+		}
+		recipients[member.ID] = member
+
+		memberReq := req
+		memberReq.RecipientID = member.ID
+		memberReq.RecipientName = member.Name
+		batch = append(batch, memberReq)
+	}
+	return batch, recipients
+}
+
+// validateBatch makes sure every wallet of a batch of transfers exists and is active, the
+// sender can afford the total and no transfer policy blocks any of the transfers
+// recipients holds the Slack profiles already fetched, by user ID, which policies reuse; it may be nil
+func validateBatch(ctx context.Context, batch []models.TransferRequest, recipients map[string]*models.SlackUserInfo) (models.CommandResult, bool) {
+	req := batch[0]
+	total := req.Amount * len(batch)
+
+	sender, err := database.GetUser(ctx, req.SenderID, req.SenderName)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error checking balance. Please try again.",
+		}, false
+	}
+
+	if sender.IsFrozen() {
+		return frozenSenderResult(), false
+	}
+
+	if sender.Coins < total {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Insufficient funds! Sending %d :corbacoin: to %d people costs %d :corbacoin: and you have %d.",
+				req.Amount, len(batch), total, sender.Coins),
+		}, false
+	}
+
+	for _, memberReq := range batch {
+		recipient, err := database.GetUser(ctx, memberReq.RecipientID, memberReq.RecipientName)
+		if err != nil {
+			return models.CommandResult{
+				Success: false,
+				Message: "Error finding recipient. Please try again.",
+			}, false
+		}
+		if recipient.IsFrozen() {
+			return frozenRecipientResult(memberReq.RecipientID), false
+		}
+	}
+
+	reason, err := policy.EvaluateBatch(ctx, batch, recipients)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error checking transfer limits. Please try again.",
+		}, false
+	}
+	if reason != "" {
+		return models.CommandResult{
+			Success: false,
+			Message: "🚫 " + reason,
+		}, false
+	}
+
+	return models.CommandResult{}, true
+}
+
+// executeGroupTransfer atomically pays every member of a user group after checking the sender's balance
+func executeGroupTransfer(ctx context.Context, groupID string, batch []models.TransferRequest, recipients map[string]*models.SlackUserInfo) models.CommandResult {
+	if _, result, ok := executeBatch(ctx, batch, recipients); !ok {
+		return result
+	}
+
+	req := batch[0]
+	message := fmt.Sprintf("<@%s> sent %d :corbacoin: to each of the %d members of <!subteam^%s>, %d :corbacoin: in total :corbacoin:",
+		req.SenderID, req.Amount, len(batch), groupID, req.Amount*len(batch))
+	if req.Memo != "" {
+		message += fmt.Sprintf(" — _%s_", req.Memo)
+	}
+	return models.CommandResult{
+		Success: true,
+		Message: message,
+	}
+}
+
+// executeBatch validates and atomically executes transfers from one sender to several recipients,
+// then notifies the recipients and updates the sender's streak and everyone's badges
+func executeBatch(ctx context.Context, batch []models.TransferRequest, recipients map[string]*models.SlackUserInfo) ([]*models.Transfer, models.CommandResult, bool) {
+	if result, ok := validateBatch(ctx, batch, recipients); !ok {
+		return nil, result, false
+	}
+
+	now := time.Now()
+	transfers := make([]*models.Transfer, len(batch))
+	for i, req := range batch {
+		transfers[i] = &models.Transfer{
+			Type:        models.TransferTypeTransfer,
+			SenderID:    req.SenderID,
+			RecipientID: req.RecipientID,
+			Amount:      req.Amount,
+			Memo:        req.Memo,
+			CreatedAt:   now,
+		}
+	}
+	if err := database.TransferToMany(ctx, transfers); err != nil {
+		switch {
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return nil, models.CommandResult{
+				Success: false,
+				Message: "Insufficient funds! Your balance changed before the transfer went through.",
+			}, false
+		case errors.Is(err, database.ErrSenderFrozen):
+			return nil, frozenSenderResult(), false
+		case errors.Is(err, database.ErrRecipientFrozen):
+			return nil, models.CommandResult{
+				Success: false,
+				Message: "❄️ A recipient's wallet was frozen in the meantime, so no coins were sent.",
+			}, false
+		}
+		return nil, models.CommandResult{
+			Success: false,
+			Message: "Error processing transfer. Please try again.",
+		}, false
+	}
+
+	userIDs := []string{batch[0].SenderID}
+	for _, transfer := range transfers {
+		notifyRecipient(ctx, transfer)
+		userIDs = append(userIDs, transfer.RecipientID)
+	}
+	recordGivingStreak(ctx, transfers[0])
+	badges.Check(ctx, userIDs...)
+
+	return transfers, models.CommandResult{}, true
+}
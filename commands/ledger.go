@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+// OpenLedger records the balances that predate the ledger, so they can be checked from then on
+// It only needs to run once, and refuses to run again
+func OpenLedger(ctx context.Context) error {
+	opened, err := database.OpenLedger(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Ledger opened with %d opening postings", opened)
+	return nil
+}
+
+// CheckLedger verifies the ledger invariants and reports violations in the admin log channel
+func CheckLedger(ctx context.Context) error {
+	report, err := database.CheckLedger(ctx)
+	if err != nil {
+		return err
+	}
+
+	if report.OK() {
+		log.Printf("Ledger check passed: %d entries, %d :corbacoin: in circulation", report.Entries, report.TotalSupply)
+		return nil
+	}
+
+	message := formatLedgerReport(report)
+	announceAdminAction(message)
+	return fmt.Errorf("ledger check failed: %d unbalanced entries, %d mismatched accounts", len(report.Unbalanced), len(report.Mismatches))
+}
+
+// formatLedgerReport describes the violations found by a ledger check
+func formatLedgerReport(report *models.LedgerReport) string {
+	var sb strings.Builder
+	sb.WriteString("🧾 *Ledger check failed*\n")
+	if !report.Opened {
+		sb.WriteString("• The ledger has no opening balances. Run the `ledger-open` job once.\n")
+	}
+	for _, entryID := range report.Unbalanced {
+		sb.WriteString(fmt.Sprintf("• Entry `%s` doesn't sum to zero\n", entryID))
+	}
+	for _, mismatch := range report.Mismatches {
+		sb.WriteString(fmt.Sprintf("• `%s` holds %d :corbacoin: but its postings sum to %d\n", mismatch.AccountID, mismatch.Balance, mismatch.Posted))
+	}
+	return sb.String()
+}
@@ -0,0 +1,377 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/policy"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+const (
+	// ActionAcceptLoan is the action ID of the button accepting a loan offer
+	ActionAcceptLoan = "accept_loan"
+
+	// ActionDeclineLoan is the action ID of the button declining a loan offer
+	ActionDeclineLoan = "decline_loan"
+)
+
+// lendUsage is the help text for the lend command
+const lendUsage = "Usage: `/lend @user amount due 2026-11-30|30d [interest 5%]`"
+
+// repayUsage is the help text for the repay command
+const repayUsage = "Usage: `/repay id [amount]`. Use `/loans` to see what you owe."
+
+// HandleLend parses `@user amount due date [interest N%]` and offers a loan to the user,
+// who accepts or declines it with the buttons of a direct message
+func HandleLend(ctx context.Context, lenderID, lenderName, text string) models.CommandResult {
+	args := strings.Fields(text)
+	if len(args) != 4 && len(args) != 6 {
+		return privateResult(false, lendUsage)
+	}
+	if strings.ToLower(args[2]) != "due" {
+		return privateResult(false, lendUsage)
+	}
+
+	amount, err := strconv.Atoi(args[1])
+	if err != nil || amount <= 0 {
+		return privateResult(false, "The amount must be a positive whole number.")
+	}
+	dueAt, err := parseDueDate(args[3], time.Now())
+	if err != nil {
+		return privateResult(false, fmt.Sprintf("Could not understand `%s`. Use a future date such as `2026-11-30` or a number of days such as `30d`.", args[3]))
+	}
+	interest := 0
+	if len(args) == 6 {
+		if strings.ToLower(args[4]) != "interest" {
+			return privateResult(false, lendUsage)
+		}
+		interest, err = strconv.Atoi(strings.TrimSuffix(args[5], "%"))
+		if err != nil || interest < 0 || interest > config.MaxLoanInterestPercent {
+			return privateResult(false, fmt.Sprintf("The interest must be a percentage between 0%% and %d%%.", config.MaxLoanInterestPercent))
+		}
+	}
+
+	userInfo, err := slack.GetOrFindUser(parseUserReference(args[0]))
+	if err != nil {
+		return privateResult(false, fmt.Sprintf("Could not find user '%s'. %v", args[0], err))
+	}
+	if userInfo.ID == lenderID {
+		return privateResult(false, "You can't lend coins to yourself.")
+	}
+	if userInfo.IsBot {
+		return privateResult(false, "Bots can't borrow coins.")
+	}
+
+	// Check the lender can afford the loan now; the balance is checked again when it is accepted
+	lender, err := database.GetUser(ctx, lenderID, lenderName)
+	if err != nil {
+		return privateResult(false, "Error checking balance. Please try again.")
+	}
+	if lender.IsFrozen() {
+		return frozenSenderResult()
+	}
+	if lender.Coins < amount {
+		return privateResult(false, fmt.Sprintf("Insufficient funds! You have %d :corbacoin:.", lender.Coins))
+	}
+	borrower, err := database.GetUser(ctx, userInfo.ID, userInfo.Name)
+	if err != nil {
+		return privateResult(false, "Error finding the borrower. Please try again.")
+	}
+	if borrower.IsFrozen() {
+		return frozenRecipientResult(userInfo.ID)
+	}
+
+	loan := &models.Loan{
+		LenderID:        lenderID,
+		BorrowerID:      userInfo.ID,
+		Principal:       amount,
+		InterestPercent: interest,
+		Owed:            models.LoanOwed(amount, interest),
+		Status:          models.LoanStatusOffered,
+		DueAt:           dueAt,
+		CreatedAt:       time.Now(),
+	}
+	if _, err := database.CreateLoan(ctx, loan); err != nil {
+		return privateResult(false, "Error offering the loan. Please try again.")
+	}
+
+	message := fmt.Sprintf("🤝 <@%s> offers to lend you %d :corbacoin:. You would repay %s by %s.",
+		lenderID, loan.Principal, describeOwed(loan), loan.DueAt.Format("2006-01-02"))
+	blocks := []models.Block{
+		slack.SectionBlock(message),
+		slack.ActionsBlock("loan_"+loan.ID,
+			slack.Button("Accept", ActionAcceptLoan, loan.ID, "primary"),
+			slack.Button("Decline", ActionDeclineLoan, loan.ID, "danger"),
+		),
+	}
+	if err := slack.SendDirectBlocksMessage(loan.BorrowerID, message, blocks); err != nil {
+		log.Printf("Error sending loan offer %s: %v", loan.ID, err)
+		return privateResult(false, "Error sending the loan offer. Please try again.")
+	}
+
+	return privateResult(true, fmt.Sprintf("🤝 Offered <@%s> a loan of %d :corbacoin: (`%s`), to be repaid as %s by %s. The coins move once they accept.",
+		loan.BorrowerID, loan.Principal, loan.ID, describeOwed(loan), loan.DueAt.Format("2006-01-02")))
+}
+
+// AcceptLoan accepts a loan offer on behalf of its borrower and moves the coins
+// The principal is checked against the lender's transfer policies like any transfer
+func AcceptLoan(ctx context.Context, loanID, userID string) models.CommandResult {
+	if offer, err := database.GetLoan(ctx, loanID); err == nil && offer.BorrowerID == userID && offer.Status == models.LoanStatusOffered {
+		reason, err := policy.Evaluate(ctx, models.TransferRequest{
+			SenderID:    offer.LenderID,
+			RecipientID: offer.BorrowerID,
+			Amount:      offer.Principal,
+		})
+		if err != nil {
+			return models.CommandResult{Success: false, Message: "Error checking transfer limits. Please try again."}
+		}
+		if reason != "" {
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("🚫 The loan can't go through because of <@%s>'s transfer limits: %s", offer.LenderID, reason),
+			}
+		}
+	}
+
+	loan, err := database.AcceptLoan(ctx, loanID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrLoanNotFound):
+			return models.CommandResult{Success: false, Message: "This loan offer could not be found."}
+		case errors.Is(err, database.ErrLoanHandled):
+			return models.CommandResult{Success: false, Message: "This loan offer was already answered."}
+		case errors.Is(err, database.ErrLoanExpired):
+			return models.CommandResult{Success: false, Message: "This loan offer expired, as its due date passed."}
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return models.CommandResult{Success: false, Message: "The lender no longer has enough coins for this loan."}
+		case errors.Is(err, database.ErrSenderFrozen), errors.Is(err, database.ErrRecipientFrozen):
+			return models.CommandResult{Success: false, Message: "❄️ One of the wallets is frozen, so the loan can't go through."}
+		}
+		return models.CommandResult{Success: false, Message: "Error accepting the loan. Please try again."}
+	}
+
+	notifyParticipant(loan.LenderID, fmt.Sprintf("🤝 <@%s> accepted your loan `%s` of %d :corbacoin:. They owe you %d :corbacoin: by %s.",
+		loan.BorrowerID, loan.ID, loan.Principal, loan.Owed, loan.DueAt.Format("2006-01-02")))
+	badges.Check(ctx, loan.BorrowerID)
+
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("🤝 You borrowed %d :corbacoin: from <@%s> (`%s`). Repay %d :corbacoin: by %s with `/repay %s`.",
+			loan.Principal, loan.LenderID, loan.ID, loan.Owed, loan.DueAt.Format("2006-01-02"), loan.ID),
+	}
+}
+
+// DeclineLoan declines a loan offer on behalf of its borrower
+func DeclineLoan(ctx context.Context, loanID, userID string) models.CommandResult {
+	loan, err := database.DeclineLoan(ctx, loanID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrLoanNotFound):
+			return models.CommandResult{Success: false, Message: "This loan offer could not be found."}
+		case errors.Is(err, database.ErrLoanHandled):
+			return models.CommandResult{Success: false, Message: "This loan offer was already answered."}
+		}
+		return models.CommandResult{Success: false, Message: "Error declining the loan. Please try again."}
+	}
+
+	notifyParticipant(loan.LenderID, fmt.Sprintf("🙅 <@%s> declined your loan offer `%s` of %d :corbacoin:.", loan.BorrowerID, loan.ID, loan.Principal))
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("🙅 You declined the loan of %d :corbacoin: from <@%s>.", loan.Principal, loan.LenderID),
+	}
+}
+
+// HandleRepay repays part or all of a loan, repaying everything outstanding when no amount is given
+// Repayments are checked against the borrower's transfer policies like any transfer
+func HandleRepay(ctx context.Context, userID, username, text string) models.CommandResult {
+	args := strings.Fields(text)
+	if len(args) < 1 || len(args) > 2 {
+		return privateResult(false, repayUsage)
+	}
+
+	loan, err := database.GetLoan(ctx, strings.ToLower(args[0]))
+	if err != nil && !errors.Is(err, database.ErrLoanNotFound) {
+		return privateResult(false, "Error loading the loan. Please try again.")
+	}
+	if err != nil || loan.BorrowerID != userID {
+		return privateResult(false, fmt.Sprintf("You have no loan `%s`. Use `/loans` to see what you owe.", args[0]))
+	}
+
+	amount := loan.Outstanding()
+	if len(args) == 2 {
+		amount, err = strconv.Atoi(args[1])
+		if err != nil || amount <= 0 {
+			return privateResult(false, "The amount must be a positive whole number.")
+		}
+	}
+
+	// Make sure the wallet exists before charging it
+	if _, err := database.GetUser(ctx, userID, username); err != nil {
+		return privateResult(false, "Error checking balance. Please try again.")
+	}
+
+	reason, err := policy.Evaluate(ctx, models.TransferRequest{
+		SenderID:    userID,
+		SenderName:  username,
+		RecipientID: loan.LenderID,
+		Amount:      min(amount, loan.Outstanding()),
+	})
+	if err != nil {
+		return privateResult(false, "Error checking transfer limits. Please try again.")
+	}
+	if reason != "" {
+		return privateResult(false, "🚫 "+reason)
+	}
+
+	lenderID := loan.LenderID
+	loan, repaid, err := database.RepayLoan(ctx, loan.ID, userID, amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrLoanClosed):
+			return privateResult(false, "This loan is not open, so there is nothing to repay.")
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return privateResult(false, "Insufficient funds! Check your balance with `/balance`.")
+		case errors.Is(err, database.ErrSenderFrozen):
+			return frozenSenderResult()
+		case errors.Is(err, database.ErrRecipientFrozen):
+			return frozenRecipientResult(lenderID)
+		}
+		return privateResult(false, "Error repaying the loan. Please try again.")
+	}
+
+	badges.Check(ctx, loan.LenderID)
+	if loan.Status == models.LoanStatusRepaid {
+		notifyParticipant(loan.LenderID, fmt.Sprintf("✅ <@%s> repaid %d :corbacoin: and settled loan `%s` in full.", userID, repaid, loan.ID))
+		return privateResult(true, fmt.Sprintf("✅ You repaid %d :corbacoin: to <@%s>. Loan `%s` is settled!", repaid, loan.LenderID, loan.ID))
+	}
+
+	notifyParticipant(loan.LenderID, fmt.Sprintf("💸 <@%s> repaid %d :corbacoin: of loan `%s`. %d :corbacoin: are still outstanding.",
+		userID, repaid, loan.ID, loan.Outstanding()))
+	return privateResult(true, fmt.Sprintf("💸 You repaid %d :corbacoin: to <@%s>. %d :corbacoin: are still outstanding on loan `%s`, due %s.",
+		repaid, loan.LenderID, loan.Outstanding(), loan.ID, loan.DueAt.Format("2006-01-02")))
+}
+
+// HandleLoans gives an overview of the loans the user made and took, including defaulted ones
+func HandleLoans(ctx context.Context, userID string) models.CommandResult {
+	loans, err := database.GetLoansOf(ctx, userID)
+	if err != nil {
+		return privateResult(false, "Error loading your loans. Please try again.")
+	}
+
+	var lent, borrowed strings.Builder
+	for _, loan := range loans {
+		if loan.Status == models.LoanStatusDeclined {
+			continue
+		}
+		if loan.LenderID == userID {
+			lent.WriteString(describeLoan(&loan, loan.BorrowerID))
+		} else {
+			borrowed.WriteString(describeLoan(&loan, loan.LenderID))
+		}
+	}
+	if lent.Len() == 0 && borrowed.Len() == 0 {
+		return privateResult(true, "You have no loans. Lend coins with `/lend @user 20 due 2026-11-30`.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*Your Loans* 🤝\n")
+	if lent.Len() > 0 {
+		sb.WriteString("\n*Lent*\n" + lent.String())
+	}
+	if borrowed.Len() > 0 {
+		sb.WriteString("\n*Borrowed*\n" + borrowed.String())
+	}
+	return privateResult(true, sb.String())
+}
+
+// SendLoanReminders reminds borrowers of loans due within config.LoanReminderDays, and flags the loans that
+// passed their due date with coins outstanding as defaulted, telling both the lender and the borrower
+func SendLoanReminders(ctx context.Context) error {
+	loans, err := database.GetActiveLoans(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reminded, defaulted := 0, 0
+	var failed error
+	for _, loan := range loans {
+		switch {
+		case now.After(loan.DueAt):
+			ok, err := database.MarkLoanDefaulted(ctx, loan.ID)
+			if err != nil {
+				failed = err
+				continue
+			}
+			if !ok {
+				continue
+			}
+			notifyParticipant(loan.LenderID, fmt.Sprintf("⚠️ <@%s> defaulted on loan `%s`: %d :corbacoin: of %d were not repaid by %s.",
+				loan.BorrowerID, loan.ID, loan.Outstanding(), loan.Owed, loan.DueAt.Format("2006-01-02")))
+			notifyParticipant(loan.BorrowerID, fmt.Sprintf("⚠️ Loan `%s` from <@%s> is overdue and marked as defaulted. You still owe %d :corbacoin:; repay with `/repay %s`.",
+				loan.ID, loan.LenderID, loan.Outstanding(), loan.ID))
+			defaulted++
+
+		case loan.RemindedAt.IsZero() && now.After(loan.DueAt.AddDate(0, 0, -config.LoanReminderDays)):
+			notifyParticipant(loan.BorrowerID, fmt.Sprintf("⏰ Loan `%s` from <@%s> is due on %s: you still owe %d :corbacoin:. Repay with `/repay %s`.",
+				loan.ID, loan.LenderID, loan.DueAt.Format("2006-01-02"), loan.Outstanding(), loan.ID))
+			if err := database.MarkLoanReminded(ctx, loan.ID); err != nil {
+				failed = err
+				continue
+			}
+			reminded++
+		}
+	}
+
+	log.Printf("Sent %d loan reminders and flagged %d defaulted loans", reminded, defaulted)
+	return failed
+}
+
+// describeLoan summarizes a loan on one line, from the point of view of the other party
+func describeLoan(loan *models.Loan, otherID string) string {
+	due := loan.DueAt.Format("2006-01-02")
+	switch loan.Status {
+	case models.LoanStatusOffered:
+		return fmt.Sprintf("• `%s` <@%s> — %d :corbacoin: offered, waiting for an answer\n", loan.ID, otherID, loan.Principal)
+	case models.LoanStatusRepaid:
+		return fmt.Sprintf("• `%s` <@%s> — %d :corbacoin: repaid in full ✅\n", loan.ID, otherID, loan.Owed)
+	case models.LoanStatusDefaulted:
+		return fmt.Sprintf("• `%s` <@%s> — ⚠️ *defaulted*: %d of %d :corbacoin: outstanding, was due %s\n", loan.ID, otherID, loan.Outstanding(), loan.Owed, due)
+	default:
+		return fmt.Sprintf("• `%s` <@%s> — %d of %d :corbacoin: outstanding, due %s\n", loan.ID, otherID, loan.Outstanding(), loan.Owed, due)
+	}
+}
+
+// describeOwed describes what a borrower owes, spelling out the interest
+func describeOwed(loan *models.Loan) string {
+	if loan.InterestPercent == 0 {
+		return fmt.Sprintf("%d :corbacoin: without interest", loan.Owed)
+	}
+	return fmt.Sprintf("%d :corbacoin: (%d%% interest)", loan.Owed, loan.InterestPercent)
+}
+
+// parseDueDate parses a due date such as "2026-11-30", due at the end of that day in UTC,
+// or a number of days such as "30d"
+func parseDueDate(text string, now time.Time) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", text); err == nil {
+		dueAt := date.AddDate(0, 0, 1).Add(-time.Second)
+		if !dueAt.After(now) {
+			return time.Time{}, fmt.Errorf("due date %q already passed", text)
+		}
+		return dueAt, nil
+	}
+	if !strings.HasSuffix(text, "d") {
+		return time.Time{}, fmt.Errorf("invalid due date %q", text)
+	}
+	return parseDeadline(text, now)
+}
@@ -0,0 +1,398 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// maxMarketOptions is the largest number of options a prediction market can have
+const maxMarketOptions = 10
+
+// betUsage is the help text for the prediction market commands
+const betUsage = "Usage: `/bet create \"question\" option option... [--closes 17:00|2h]`, `/bet [list]`, `/bet show id`, " +
+	"`/bet stake id option amount`, `/bet resolve id option` or `/bet cancel id`"
+
+// marketQuestionPattern matches the quoted question and the rest of a `bet create` command
+var marketQuestionPattern = regexp.MustCompile(`^["“]([^"”]+)["”]\s*(.*)$`)
+
+// HandleBet runs a prediction market subcommand
+// Results meant for the channel, such as a new market or its outcome, are not ephemeral
+func HandleBet(ctx context.Context, userID, username, channelID, text string) models.CommandResult {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return listMarkets(ctx)
+	}
+
+	rest := strings.TrimSpace(text[strings.Index(text, args[0])+len(args[0]):])
+	switch strings.ToLower(args[0]) {
+	case "create":
+		return createMarket(ctx, userID, channelID, rest)
+	case "list":
+		return listMarkets(ctx)
+	case "show":
+		if len(args) != 2 {
+			return privateResult(false, betUsage)
+		}
+		return showMarket(ctx, args[1])
+	case "stake":
+		if len(args) != 4 {
+			return privateResult(false, betUsage)
+		}
+		return placeStake(ctx, userID, username, args[1], args[2], args[3])
+	case "resolve":
+		if len(args) != 3 {
+			return privateResult(false, betUsage)
+		}
+		return resolveMarket(ctx, userID, args[1], args[2])
+	case "cancel":
+		if len(args) != 2 {
+			return privateResult(false, betUsage)
+		}
+		return cancelMarket(ctx, userID, args[1])
+	default:
+		return privateResult(false, betUsage)
+	}
+}
+
+// privateResult returns a result only shown to the user who ran the command
+func privateResult(success bool, message string) models.CommandResult {
+	return models.CommandResult{Success: success, Message: message, Ephemeral: true}
+}
+
+// createMarket parses `"question" option option... [--closes when]` and opens the market
+func createMarket(ctx context.Context, userID, channelID, text string) models.CommandResult {
+	matches := marketQuestionPattern.FindStringSubmatch(text)
+	if matches == nil {
+		return privateResult(false, "Please put the question in quotes.\n"+betUsage)
+	}
+
+	question := strings.TrimSpace(matches[1])
+	var options []string
+	var closesAt time.Time
+	fields := strings.Fields(matches[2])
+	for i := 0; i < len(fields); i++ {
+		if strings.ToLower(fields[i]) == "--closes" && i+1 < len(fields) {
+			deadline, err := parseDeadline(fields[i+1], localNow(ctx, userID))
+			if err != nil {
+				return privateResult(false, fmt.Sprintf("Could not understand `%s`. Use a time such as `17:00` or a duration such as `2h`.", fields[i+1]))
+			}
+			closesAt = deadline
+			i++
+			continue
+		}
+		options = append(options, fields[i])
+	}
+
+	if len(options) < 2 || len(options) > maxMarketOptions {
+		return privateResult(false, fmt.Sprintf("A market needs between 2 and %d options.", maxMarketOptions))
+	}
+	for i, option := range options {
+		if _, err := strconv.Atoi(option); err == nil {
+			return privateResult(false, "Options can't be numbers, as numbers pick an option by position.")
+		}
+		for _, other := range options[:i] {
+			if strings.EqualFold(option, other) {
+				return privateResult(false, fmt.Sprintf("The option `%s` is listed twice.", option))
+			}
+		}
+	}
+
+	market := &models.Market{
+		Question:      question,
+		Options:       options,
+		Pools:         make([]int, len(options)),
+		CreatorID:     userID,
+		Channel:       channelID,
+		Status:        models.MarketStatusOpen,
+		WinningOption: -1,
+		ClosesAt:      closesAt,
+		CreatedAt:     time.Now(),
+	}
+	if _, err := database.CreateMarket(ctx, market); err != nil {
+		return privateResult(false, "Error creating the market. Please try again.")
+	}
+
+	message := fmt.Sprintf("🎲 <@%s> opened a market: *%s*", userID, question)
+	return models.CommandResult{
+		Success: true,
+		Message: message,
+		Blocks:  append([]models.Block{slack.SectionBlock(message)}, marketBlocks(market)...),
+	}
+}
+
+// listMarkets lists the markets that are not settled yet
+func listMarkets(ctx context.Context) models.CommandResult {
+	markets, err := database.GetOpenMarkets(ctx)
+	if err != nil {
+		return privateResult(false, "Error loading markets. Please try again.")
+	}
+	if len(markets) == 0 {
+		return privateResult(true, "No open markets. Create one with `/bet create \"question\" yes no`.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*Open Markets* 🎲\n")
+	now := time.Now()
+	for _, market := range markets {
+		sb.WriteString(fmt.Sprintf("• `%s` *%s* — %d :corbacoin: staked", market.ID, market.Question, market.Total()))
+		if market.IsClosed(now) {
+			sb.WriteString(" · _closed, awaiting resolution_")
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("Use `/bet show id` to see the odds.")
+	return privateResult(true, sb.String())
+}
+
+// showMarket returns the Block Kit summary of a market's current odds
+func showMarket(ctx context.Context, marketID string) models.CommandResult {
+	market, result, ok := loadMarket(ctx, marketID)
+	if !ok {
+		return result
+	}
+
+	return models.CommandResult{
+		Success:   true,
+		Message:   fmt.Sprintf("*%s*\n%d :corbacoin: staked", market.Question, market.Total()),
+		Blocks:    marketBlocks(market),
+		Ephemeral: true,
+	}
+}
+
+// placeStake puts a user's coins on an option of a market
+func placeStake(ctx context.Context, userID, username, marketID, optionText, amountText string) models.CommandResult {
+	amount, err := strconv.Atoi(amountText)
+	if err != nil || amount <= 0 {
+		return privateResult(false, "Amount must be positive!")
+	}
+
+	market, result, ok := loadMarket(ctx, marketID)
+	if !ok {
+		return result
+	}
+	option, ok := findMarketOption(market, optionText)
+	if !ok {
+		return privateResult(false, fmt.Sprintf("Unknown option. Pick one of %s.", formatMarketOptions(market)))
+	}
+
+	// Make sure the wallet exists before charging it
+	if _, err := database.GetUser(ctx, userID, username); err != nil {
+		return privateResult(false, "Error checking balance. Please try again.")
+	}
+
+	market, err = database.PlaceStake(ctx, market.ID, userID, option, amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrMarketClosed):
+			return privateResult(false, "This market no longer accepts stakes.")
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return privateResult(false, "Insufficient funds! Check your balance with `/balance`.")
+		case errors.Is(err, database.ErrSenderFrozen):
+			return privateResult(false, "❄️ Your wallet is frozen, so you can't stake coins. Please contact an admin.")
+		}
+		return privateResult(false, "Error placing your stake. Please try again.")
+	}
+
+	message := fmt.Sprintf("🎲 You staked %d :corbacoin: on *%s* for _%s_. The coins are held in escrow until the market is settled.",
+		amount, market.Options[option], market.Question)
+	return models.CommandResult{
+		Success:   true,
+		Message:   message,
+		Blocks:    append([]models.Block{slack.SectionBlock(message)}, marketBlocks(market)...),
+		Ephemeral: true,
+	}
+}
+
+// resolveMarket pays out a market on behalf of its creator or an admin
+func resolveMarket(ctx context.Context, userID, marketID, optionText string) models.CommandResult {
+	market, result, ok := loadSettleableMarket(ctx, userID, marketID)
+	if !ok {
+		return result
+	}
+	option, ok := findMarketOption(market, optionText)
+	if !ok {
+		return privateResult(false, fmt.Sprintf("Unknown option. Pick one of %s.", formatMarketOptions(market)))
+	}
+
+	market, payouts, err := database.ResolveMarket(ctx, market.ID, userID, option, IsAdmin(userID))
+	if err != nil {
+		return settleErrorResult(err)
+	}
+
+	winner := market.Options[option]
+	message := fmt.Sprintf("🏁 <@%s> resolved *%s*: the answer is *%s*.", userID, market.Question, winner)
+	if market.Pools[option] == 0 {
+		message += " Nobody backed it, so every stake was refunded."
+	} else {
+		message += fmt.Sprintf(" %d winners share the %d :corbacoin: pot.", len(payouts), market.Total())
+	}
+	for stakerID, payout := range payouts {
+		dm := fmt.Sprintf("🎉 _%s_ resolved as *%s*: you won %d :corbacoin:!", market.Question, winner, payout)
+		if market.Pools[option] == 0 {
+			dm = fmt.Sprintf("↩️ _%s_ resolved as *%s*, which nobody backed: your %d :corbacoin: were refunded.", market.Question, winner, payout)
+		}
+		notifyParticipant(stakerID, dm)
+		badges.Check(ctx, stakerID)
+	}
+
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// cancelMarket refunds every stake of a market on behalf of its creator or an admin
+func cancelMarket(ctx context.Context, userID, marketID string) models.CommandResult {
+	market, result, ok := loadSettleableMarket(ctx, userID, marketID)
+	if !ok {
+		return result
+	}
+
+	market, refunds, err := database.CancelMarket(ctx, market.ID, userID)
+	if err != nil {
+		return settleErrorResult(err)
+	}
+
+	for stakerID, refund := range refunds {
+		notifyParticipant(stakerID, fmt.Sprintf("↩️ _%s_ was cancelled: your %d :corbacoin: were refunded.", market.Question, refund))
+	}
+
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("🚫 <@%s> cancelled *%s* and refunded %d :corbacoin: to %d users.", userID, market.Question, market.Total(), len(refunds)),
+	}
+}
+
+// loadMarket retrieves a market, returning an error result when it doesn't exist
+func loadMarket(ctx context.Context, marketID string) (*models.Market, models.CommandResult, bool) {
+	market, err := database.GetMarket(ctx, strings.ToLower(marketID))
+	if errors.Is(err, database.ErrMarketNotFound) {
+		return nil, privateResult(false, fmt.Sprintf("There is no market `%s`. Use `/bet list` to see open markets.", marketID)), false
+	}
+	if err != nil {
+		return nil, privateResult(false, "Error loading the market. Please try again."), false
+	}
+	return market, models.CommandResult{}, true
+}
+
+// loadSettleableMarket retrieves a market the user is allowed to resolve or cancel
+func loadSettleableMarket(ctx context.Context, userID, marketID string) (*models.Market, models.CommandResult, bool) {
+	market, result, ok := loadMarket(ctx, marketID)
+	if !ok {
+		return nil, result, false
+	}
+	if market.CreatorID != userID && !IsAdmin(userID) {
+		return nil, privateResult(false, "Only the market's creator or an admin can resolve or cancel it."), false
+	}
+	if market.Status != models.MarketStatusOpen {
+		return nil, privateResult(false, "This market was already settled."), false
+	}
+	return market, models.CommandResult{}, true
+}
+
+// settleErrorResult is the result returned when resolving or cancelling a market fails
+func settleErrorResult(err error) models.CommandResult {
+	switch {
+	case errors.Is(err, database.ErrMarketSettled):
+		return privateResult(false, "This market was already settled.")
+	case errors.Is(err, database.ErrMarketNotClosed):
+		return privateResult(false, "This market still accepts stakes. You can resolve it once it closes, or cancel it.")
+	case errors.Is(err, database.ErrResolverStaked):
+		return privateResult(false, "You have a stake in this market, so an admin has to resolve it. You can still cancel it.")
+	}
+	return privateResult(false, "Error settling the market. Please try again.")
+}
+
+// notifyParticipant sends a market or raffle participant a direct message about its outcome
+func notifyParticipant(userID, message string) {
+	if err := slack.SendDirectMessage(userID, message); err != nil {
+		log.Printf("Error notifying %s: %v", userID, err)
+	}
+}
+
+// findMarketOption returns the index of an option given its name or its position starting at 1
+func findMarketOption(market *models.Market, text string) (int, bool) {
+	if position, err := strconv.Atoi(text); err == nil {
+		return position - 1, position >= 1 && position <= len(market.Options)
+	}
+	for i, option := range market.Options {
+		if strings.EqualFold(option, text) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// formatMarketOptions lists the options of a market for error messages
+func formatMarketOptions(market *models.Market) string {
+	options := make([]string, 0, len(market.Options))
+	for _, option := range market.Options {
+		options = append(options, "`"+option+"`")
+	}
+	return strings.Join(options, ", ")
+}
+
+// marketBlocks returns the Block Kit summary of a market: each option's pool, share and payout multiplier
+func marketBlocks(market *models.Market) []models.Block {
+	total := market.Total()
+	fields := make([]string, 0, len(market.Options))
+	for i, option := range market.Options {
+		field := fmt.Sprintf("*%d. %s*\n%d :corbacoin:", i+1, option, market.Pools[i])
+		if total > 0 && market.Pools[i] > 0 {
+			field += fmt.Sprintf(" · %.0f%% · pays %.2fx", 100*float64(market.Pools[i])/float64(total), float64(total)/float64(market.Pools[i]))
+		}
+		fields = append(fields, field)
+	}
+
+	footer := fmt.Sprintf("_`%s` · %d :corbacoin: staked", market.ID, total)
+	if !market.ClosesAt.IsZero() {
+		footer += " · closes " + market.ClosesAt.Format("2006-01-02 15:04 MST")
+	}
+	footer += fmt.Sprintf("_\nStake with `/bet stake %s option amount`", market.ID)
+
+	// Slack limits a section to 10 fields
+	blocks := []models.Block{slack.SectionBlock(fmt.Sprintf("*%s*", market.Question))}
+	for start := 0; start < len(fields); start += 10 {
+		blocks = append(blocks, slack.FieldsBlock(fields[start:min(start+10, len(fields))]...))
+	}
+	return append(blocks, slack.SectionBlock(footer))
+}
+
+// localNow returns the current time in the user's Slack time zone, or in UTC when it is unknown
+func localNow(ctx context.Context, userID string) time.Time {
+	user, err := database.GetUser(ctx, userID, "")
+	if err != nil {
+		return time.Now().UTC()
+	}
+	return time.Now().In(user.Location())
+}
+
+// parseDeadline parses a deadline given as a time of day such as "17:00", a duration such as "2h" or "90m",
+// or a number of days such as "3d"
+// A time of day is read in now's location, and one that already passed today refers to tomorrow
+func parseDeadline(text string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(text); err == nil && duration > 0 {
+		return now.Add(duration), nil
+	}
+	if days, err := strconv.Atoi(strings.TrimSuffix(text, "d")); err == nil && strings.HasSuffix(text, "d") && days > 0 {
+		return now.AddDate(0, 0, days), nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", text, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid deadline %q", text)
+	}
+	deadline := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !deadline.After(now) {
+		deadline = deadline.AddDate(0, 0, 1)
+	}
+	return deadline, nil
+}
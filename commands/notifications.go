@@ -0,0 +1,151 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// HandleNotifications shows or changes how a user is notified about received transfers
+func HandleNotifications(ctx context.Context, userID, username, mode string) models.CommandResult {
+	user, err := database.GetUser(ctx, userID, username)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error loading your preferences. Please try again.",
+		}
+	}
+
+	if mode == "" {
+		current := user.NotificationMode
+		if current == "" {
+			current = models.NotificationModeInstant
+		}
+		return models.CommandResult{
+			Success: true,
+			Message: fmt.Sprintf("Your transfer notifications are set to *%s*. Options: `instant`, `daily`, `mute`.", current),
+		}
+	}
+
+	mode = strings.ToLower(mode)
+	if mode != models.NotificationModeInstant && mode != models.NotificationModeDaily && mode != models.NotificationModeMute {
+		return models.CommandResult{
+			Success: false,
+			Message: "Unknown notification mode. Use `instant`, `daily` or `mute`.",
+		}
+	}
+
+	if err := database.SetNotificationMode(ctx, userID, mode); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error saving your preferences. Please try again.",
+		}
+	}
+
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("Transfer notifications set to *%s*.", mode),
+	}
+}
+
+// notifyRecipient tells the recipient of a transfer about it according to their notification mode
+func notifyRecipient(ctx context.Context, transfer *models.Transfer) {
+	// Nothing to announce when sending to yourself
+	if transfer.SenderID == transfer.RecipientID {
+		return
+	}
+
+	recipient, err := database.GetUser(ctx, transfer.RecipientID, "")
+	if err != nil {
+		log.Printf("Error loading recipient %s for notification: %v", transfer.RecipientID, err)
+		return
+	}
+
+	switch recipient.NotificationMode {
+	case models.NotificationModeMute:
+		return
+
+	case models.NotificationModeDaily:
+		database.QueueNotification(ctx, &models.QueuedNotification{
+			RecipientID: transfer.RecipientID,
+			SenderID:    transfer.SenderID,
+			Amount:      transfer.Amount,
+			Memo:        transfer.Memo,
+			CreatedAt:   transfer.CreatedAt,
+		})
+
+	default:
+		message := fmt.Sprintf("💰 <@%s> sent you %d :corbacoin:", transfer.SenderID, transfer.Amount)
+		if transfer.Memo != "" {
+			message += fmt.Sprintf(" — _%s_", transfer.Memo)
+		}
+		message += fmt.Sprintf("\nYour balance is now %d :corbacoin:.", recipient.Coins)
+
+		if err := slack.SendDirectMessage(transfer.RecipientID, message); err != nil {
+			log.Printf("Error sending transfer notification to %s: %v", transfer.RecipientID, err)
+		}
+	}
+}
+
+// SendNotificationSummaries sends each user with queued notifications a summary of what they received
+func SendNotificationSummaries(ctx context.Context) error {
+	notifications, err := database.GetQueuedNotifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	byRecipient := make(map[string][]models.QueuedNotification)
+	var recipients []string
+	for _, notification := range notifications {
+		if _, ok := byRecipient[notification.RecipientID]; !ok {
+			recipients = append(recipients, notification.RecipientID)
+		}
+		byRecipient[notification.RecipientID] = append(byRecipient[notification.RecipientID], notification)
+	}
+
+	for _, recipientID := range recipients {
+		received := byRecipient[recipientID]
+		if err := sendSummary(ctx, recipientID, received); err != nil {
+			// Keep the queue so the next run retries this user
+			log.Printf("Error sending notification summary to %s: %v", recipientID, err)
+			continue
+		}
+
+		if err := database.DeleteQueuedNotifications(ctx, received); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Sent notification summaries to %d users", len(recipients))
+	return nil
+}
+
+// sendSummary sends a single user the summary of their queued notifications
+func sendSummary(ctx context.Context, recipientID string, received []models.QueuedNotification) error {
+	total := 0
+	var lines strings.Builder
+	for _, notification := range received {
+		total += notification.Amount
+		lines.WriteString(fmt.Sprintf("• %d :corbacoin: from <@%s>", notification.Amount, notification.SenderID))
+		if notification.Memo != "" {
+			lines.WriteString(fmt.Sprintf(" — _%s_", notification.Memo))
+		}
+		lines.WriteString(fmt.Sprintf(" (%s)\n", notification.CreatedAt.Format(time.Kitchen)))
+	}
+
+	recipient, err := database.GetUser(ctx, recipientID, "")
+	if err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("*Your daily Corbacoin summary* 📬\nYou received %d :corbacoin: in %d transfers:\n%sYour balance is now %d :corbacoin:.",
+		total, len(received), lines.String(), recipient.Coins)
+
+	return slack.SendDirectMessage(recipientID, message)
+}
@@ -0,0 +1,406 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// payrollUsage lists the payroll admin subcommands
+const payrollUsage = "Usage: `/corbacoin admin payroll [add amount [#channel...] [@group...] | remove id | run id | report id [YYYY-MM]]`"
+
+// userGroupReferencePattern matches a Slack user group mention such as <!subteam^S12345678|@backend-team>
+var userGroupReferencePattern = regexp.MustCompile(`^<!subteam\^([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// RunPayrolls pays every payroll of every workspace for the current month
+// Payrolls whose run for the month already completed are skipped, and a run that failed part way
+// only pays the members it missed. Runs of earlier months that left members unpaid are finished first
+func RunPayrolls(ctx context.Context) error {
+	payrolls, err := database.GetPayrolls(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	period := time.Now().UTC().Format(models.PayrollPeriodLayout)
+	ran := 0
+	failed := retryPayrollRuns(ctx, payrolls, period)
+	for _, payroll := range payrolls {
+		payrollCtx := config.WithWorkspace(ctx, payroll.WorkspaceID)
+		run, err := database.GetPayrollRun(payrollCtx, payroll.ID, period)
+		if err == nil && run.Complete() {
+			continue
+		}
+		if err != nil && !errors.Is(err, database.ErrPayrollRunNotFound) {
+			failed = err
+			continue
+		}
+
+		run, err = runPayroll(payrollCtx, &payroll, period)
+		if err != nil {
+			// Keep paying the other payrolls
+			failed = err
+			continue
+		}
+		announceAdminAction(formatPayrollRun(run))
+		ran++
+	}
+
+	log.Printf("Ran %d payrolls for %s", ran, period)
+	return failed
+}
+
+// retryPayrollRuns pays the members that runs of months before period missed, and returns the last error
+// Runs of payrolls that were removed since are left as they are
+func retryPayrollRuns(ctx context.Context, payrolls []models.Payroll, period string) error {
+	runs, err := database.GetIncompletePayrollRuns(ctx)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*models.Payroll, len(payrolls))
+	for i := range payrolls {
+		byID[payrolls[i].ID] = &payrolls[i]
+	}
+
+	var failed error
+	for _, previous := range runs {
+		payroll := byID[previous.PayrollID]
+		if payroll == nil || previous.Period >= period {
+			continue
+		}
+
+		payrollCtx := config.WithWorkspace(ctx, payroll.WorkspaceID)
+		var run *models.PayrollRun
+		if len(previous.Unpaid) > 0 {
+			run, err = payPayrollMembers(payrollCtx, payroll, previous.Period, previous.Unpaid)
+		} else {
+			// Reports saved before unpaid members were kept only have the count
+			run, err = runPayroll(payrollCtx, payroll, previous.Period)
+		}
+		if err != nil {
+			failed = err
+			continue
+		}
+		announceAdminAction(formatPayrollRun(run))
+	}
+	return failed
+}
+
+// runPayroll mints a payroll's stipend for every member who wasn't paid for the period yet,
+// and adds the run to the period's report
+func runPayroll(ctx context.Context, payroll *models.Payroll, period string) (*models.PayrollRun, error) {
+	members, err := payrollMembers(payroll)
+	if err != nil {
+		log.Printf("Error listing members of payroll %s: %v", payroll.ID, err)
+		return nil, err
+	}
+
+	// Members who never used the bot get their wallet first
+	users, err := database.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wallets := make(map[string]bool, len(users))
+	for _, user := range users {
+		wallets[user.UserID] = true
+	}
+
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		if !wallets[member.ID] {
+			if _, err := database.GetUser(ctx, member.ID, member.Name); err != nil {
+				return nil, err
+			}
+		}
+		userIDs = append(userIDs, member.ID)
+	}
+
+	return payPayrollMembers(ctx, payroll, period, userIDs)
+}
+
+// payPayrollMembers mints a payroll's stipend for the given members in batches of
+// config.WalletBatchSize wallets, and adds the run to the period's report
+// Members of batches that fail are kept in the report so a later run can pay them
+func payPayrollMembers(ctx context.Context, payroll *models.Payroll, period string, userIDs []string) (*models.PayrollRun, error) {
+	run := &models.PayrollRun{
+		PayrollID:   payroll.ID,
+		WorkspaceID: payroll.WorkspaceID,
+		Period:      period,
+		Members:     len(userIDs),
+		StartedAt:   time.Now(),
+	}
+	for _, batch := range splitBatches(userIDs, config.WalletBatchSize) {
+		result, err := database.GrantPayroll(ctx, run, payroll.Amount, batch)
+		if err != nil {
+			run.Failed += len(batch)
+			run.Unpaid = append(run.Unpaid, batch...)
+			continue
+		}
+
+		run.Paid += len(result.Paid)
+		run.AlreadyPaid += result.AlreadyPaid
+		run.Skipped += result.Skipped
+		run.Minted += payroll.Amount * len(result.Paid)
+		for _, userID := range result.Paid {
+			notifyParticipant(userID, fmt.Sprintf("💰 Your %s stipend of %d :corbacoin: has arrived.", period, payroll.Amount))
+		}
+	}
+	run.FinishedAt = time.Now()
+
+	if err := database.SavePayrollRun(ctx, run); err != nil {
+		return nil, err
+	}
+	log.Printf("Payroll %s for %s: paid %d, already paid %d, skipped %d, failed %d", payroll.ID, period, run.Paid, run.AlreadyPaid, run.Skipped, run.Failed)
+	return run, nil
+}
+
+// splitBatches splits IDs into consecutive batches of at most size IDs
+func splitBatches(ids []string, size int) [][]string {
+	var batches [][]string
+	for start := 0; start < len(ids); start += size {
+		batches = append(batches, ids[start:min(start+size, len(ids))])
+	}
+	return batches
+}
+
+// payrollMembers returns the active human members a payroll pays: everyone in the workspace, or
+// only the members of its channels and user groups
+func payrollMembers(payroll *models.Payroll) ([]models.SlackUserInfo, error) {
+	users, err := slack.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var included map[string]bool
+	if len(payroll.Channels) > 0 || len(payroll.Groups) > 0 {
+		included = make(map[string]bool)
+		for _, channelID := range payroll.Channels {
+			memberIDs, err := slack.GetChannelMembers(channelID)
+			if err != nil {
+				return nil, err
+			}
+			for _, memberID := range memberIDs {
+				included[memberID] = true
+			}
+		}
+		for _, groupID := range payroll.Groups {
+			memberIDs, err := slack.GetUserGroupMembers(groupID)
+			if err != nil {
+				return nil, err
+			}
+			for _, memberID := range memberIDs {
+				included[memberID] = true
+			}
+		}
+	}
+
+	var members []models.SlackUserInfo
+	for _, user := range users {
+		// Slackbot is not flagged as a bot
+		if user.IsBot || user.Deleted || user.ID == "USLACKBOT" {
+			continue
+		}
+		if included != nil && !included[user.ID] {
+			continue
+		}
+		members = append(members, user)
+	}
+	return members, nil
+}
+
+// handlePayroll lists, adds, removes and runs payrolls, and shows their run reports
+func handlePayroll(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) == 0 {
+		return listPayrolls(ctx)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		return addPayroll(ctx, adminID, args[1:])
+
+	case "remove":
+		if len(args) != 2 {
+			return models.CommandResult{Success: false, Message: payrollUsage}
+		}
+		if err := database.DeletePayroll(ctx, args[1]); err != nil {
+			return payrollErrorResult(err, args[1])
+		}
+		message := fmt.Sprintf("💰 <@%s> removed payroll `%s`", adminID, args[1])
+		announceAdminAction(message)
+		return models.CommandResult{Success: true, Message: message}
+
+	case "run":
+		if len(args) != 2 {
+			return models.CommandResult{Success: false, Message: payrollUsage}
+		}
+		payroll, err := database.GetPayroll(ctx, args[1])
+		if err != nil {
+			return payrollErrorResult(err, args[1])
+		}
+		run, err := runPayroll(ctx, payroll, time.Now().UTC().Format(models.PayrollPeriodLayout))
+		if err != nil {
+			return models.CommandResult{
+				Success: false,
+				Message: "Error running payroll. Please try again.",
+			}
+		}
+		message := fmt.Sprintf("💰 <@%s> ran payroll `%s`\n%s", adminID, payroll.ID, formatPayrollRun(run))
+		announceAdminAction(message)
+		return models.CommandResult{Success: true, Message: message}
+
+	case "report":
+		if len(args) < 2 || len(args) > 3 {
+			return models.CommandResult{Success: false, Message: payrollUsage}
+		}
+		period := time.Now().UTC().Format(models.PayrollPeriodLayout)
+		if len(args) == 3 {
+			if _, err := time.Parse(models.PayrollPeriodLayout, args[2]); err != nil {
+				return models.CommandResult{Success: false, Message: "Periods are months such as `2026-10`."}
+			}
+			period = args[2]
+		}
+		if _, err := database.GetPayroll(ctx, args[1]); err != nil {
+			return payrollErrorResult(err, args[1])
+		}
+		run, err := database.GetPayrollRun(ctx, args[1], period)
+		if errors.Is(err, database.ErrPayrollRunNotFound) {
+			return models.CommandResult{Success: true, Message: fmt.Sprintf("Payroll `%s` has not run for %s yet.", args[1], period)}
+		}
+		if err != nil {
+			return models.CommandResult{
+				Success: false,
+				Message: "Error loading the payroll report. Please try again.",
+			}
+		}
+		return models.CommandResult{Success: true, Message: formatPayrollRun(run)}
+
+	default:
+		return models.CommandResult{Success: false, Message: payrollUsage}
+	}
+}
+
+// addPayroll parses `amount [#channel...] [@group...]` and saves the payroll
+func addPayroll(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) == 0 {
+		return models.CommandResult{Success: false, Message: payrollUsage}
+	}
+
+	amount, err := strconv.Atoi(args[0])
+	if err != nil || amount <= 0 {
+		return models.CommandResult{Success: false, Message: "Amount must be a positive whole number."}
+	}
+
+	payroll := &models.Payroll{
+		Amount:    amount,
+		CreatedBy: adminID,
+		CreatedAt: time.Now(),
+	}
+	for _, arg := range args[1:] {
+		if channelID := parseChannelReference(arg); channelID != "" {
+			payroll.Channels = append(payroll.Channels, channelID)
+			continue
+		}
+		if matches := userGroupReferencePattern.FindStringSubmatch(arg); matches != nil {
+			payroll.Groups = append(payroll.Groups, matches[1])
+			continue
+		}
+		group, err := slack.FindUserGroupByHandle(arg)
+		if err != nil {
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("`%s` is neither a channel nor a user group.", arg),
+			}
+		}
+		payroll.Groups = append(payroll.Groups, group.ID)
+	}
+
+	if _, err := database.CreatePayroll(ctx, payroll); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error saving payroll. Please try again.",
+		}
+	}
+
+	message := fmt.Sprintf("💰 <@%s> added payroll `%s`: %s", adminID, payroll.ID, describePayroll(payroll))
+	announceAdminAction(message)
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// listPayrolls describes every payroll of the workspace and its run for the current month
+func listPayrolls(ctx context.Context) models.CommandResult {
+	payrolls, err := database.GetPayrolls(ctx, config.WorkspaceFromContext(ctx))
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error loading payrolls. Please try again.",
+		}
+	}
+	if len(payrolls) == 0 {
+		return models.CommandResult{Success: true, Message: "There are no payrolls. Add one with `/corbacoin admin payroll add amount`."}
+	}
+
+	period := time.Now().UTC().Format(models.PayrollPeriodLayout)
+	var sb strings.Builder
+	sb.WriteString("*Payrolls* 💰\n")
+	for _, payroll := range payrolls {
+		status := "not run yet"
+		if run, err := database.GetPayrollRun(ctx, payroll.ID, period); err == nil {
+			status = fmt.Sprintf("%d paid", run.Paid)
+			if !run.Complete() {
+				status += ", incomplete"
+			}
+		}
+		sb.WriteString(fmt.Sprintf("• `%s` %s — %s: %s\n", payroll.ID, describePayroll(&payroll), period, status))
+	}
+	return models.CommandResult{Success: true, Message: sb.String()}
+}
+
+// describePayroll summarizes who a payroll pays and how much
+func describePayroll(payroll *models.Payroll) string {
+	if len(payroll.Channels) == 0 && len(payroll.Groups) == 0 {
+		return fmt.Sprintf("%d :corbacoin: a month for every active member", payroll.Amount)
+	}
+
+	targets := make([]string, 0, len(payroll.Channels)+len(payroll.Groups))
+	for _, channelID := range payroll.Channels {
+		targets = append(targets, fmt.Sprintf("<#%s>", channelID))
+	}
+	for _, groupID := range payroll.Groups {
+		targets = append(targets, fmt.Sprintf("<!subteam^%s>", groupID))
+	}
+	return fmt.Sprintf("%d :corbacoin: a month for the members of %s", payroll.Amount, strings.Join(targets, ", "))
+}
+
+// formatPayrollRun renders the report of a payroll run
+func formatPayrollRun(run *models.PayrollRun) string {
+	report := fmt.Sprintf("*Payroll `%s` — %s*\nPaid so far: %d (%d :corbacoin: minted)\nLatest run — Members: %d · Already paid: %d · Skipped: %d",
+		run.PayrollID, run.Period, run.Paid, run.Minted, run.Members, run.AlreadyPaid, run.Skipped)
+	if run.Failed > 0 {
+		report += fmt.Sprintf(" · ⚠️ Failed: %d, retried on the next run", run.Failed)
+	}
+	return report
+}
+
+// payrollErrorResult turns a payroll lookup error into a result
+func payrollErrorResult(err error, payrollID string) models.CommandResult {
+	if errors.Is(err, database.ErrPayrollNotFound) {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Payroll `%s` not found.", payrollID),
+		}
+	}
+	return models.CommandResult{
+		Success: false,
+		Message: "Error loading payroll. Please try again.",
+	}
+}
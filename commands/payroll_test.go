@@ -0,0 +1,29 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitBatches(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []string
+		size int
+		want [][]string
+	}{
+		{name: "no IDs", ids: nil, size: 2, want: nil},
+		{name: "exact multiple", ids: []string{"a", "b", "c", "d"}, size: 2, want: [][]string{{"a", "b"}, {"c", "d"}}},
+		{name: "remainder in the last batch", ids: []string{"a", "b", "c"}, size: 2, want: [][]string{{"a", "b"}, {"c"}}},
+		{name: "size larger than the list", ids: []string{"a", "b"}, size: 10, want: [][]string{{"a", "b"}}},
+		{name: "batches of one", ids: []string{"a", "b"}, size: 1, want: [][]string{{"a"}, {"b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitBatches(tt.ids, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitBatches(%v, %d) = %v, want %v", tt.ids, tt.size, got, tt.want)
+			}
+		})
+	}
+}
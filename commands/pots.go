@@ -0,0 +1,406 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/policy"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// potProgressWidth is the number of segments of a pot's progress bar
+const potProgressWidth = 10
+
+// potUsage is the help text for the pot commands
+const potUsage = "Usage: `/pot create \"title\" goal [@beneficiary] [--deadline 17:00|2h|3d]`, `/pot [list]`, " +
+	"`/pot show id`, `/pot give id amount` or `/pot cancel id`"
+
+// HandlePot runs a crowdfunding pot subcommand
+// Results meant for the channel, such as a new pot when its live message can't be posted, are not ephemeral
+func HandlePot(ctx context.Context, userID, username, channelID, text string) models.CommandResult {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return listPots(ctx)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "create":
+		return createPot(ctx, userID, channelID, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), args[0])))
+	case "list":
+		return listPots(ctx)
+	case "show":
+		if len(args) != 2 {
+			return privateResult(false, potUsage)
+		}
+		return showPot(ctx, args[1])
+	case "give":
+		if len(args) != 3 {
+			return privateResult(false, potUsage)
+		}
+		return giveToPot(ctx, userID, username, args[1], args[2])
+	case "cancel":
+		if len(args) != 2 {
+			return privateResult(false, potUsage)
+		}
+		return cancelPot(ctx, userID, args[1])
+	default:
+		return privateResult(false, potUsage)
+	}
+}
+
+// createPot parses `"title" goal [@beneficiary] [--deadline when]`, opens the pot and posts its live message
+func createPot(ctx context.Context, userID, channelID, text string) models.CommandResult {
+	matches := marketQuestionPattern.FindStringSubmatch(text)
+	if matches == nil {
+		return privateResult(false, "Please put the title in quotes.\n"+potUsage)
+	}
+
+	pot := &models.Pot{
+		CreatorID: userID,
+		Title:     strings.TrimSpace(matches[1]),
+		Status:    models.PotStatusOpen,
+		Channel:   channelID,
+		Deadline:  time.Now().AddDate(0, 0, config.PotDeadlineDays),
+		CreatedAt: time.Now(),
+	}
+
+	var rest []string
+	fields := strings.Fields(matches[2])
+	for i := 0; i < len(fields); i++ {
+		if strings.ToLower(fields[i]) == "--deadline" && i+1 < len(fields) {
+			deadline, err := parseDeadline(fields[i+1], localNow(ctx, userID))
+			if err != nil {
+				return privateResult(false, fmt.Sprintf("Could not understand `%s`. Use a time such as `17:00` or a duration such as `2h` or `3d`.", fields[i+1]))
+			}
+			pot.Deadline = deadline
+			i++
+			continue
+		}
+		rest = append(rest, fields[i])
+	}
+	if len(rest) < 1 || len(rest) > 2 {
+		return privateResult(false, potUsage)
+	}
+
+	goal, err := strconv.Atoi(rest[0])
+	if err != nil || goal <= 0 {
+		return privateResult(false, "The goal must be a positive whole number of coins.")
+	}
+	pot.Goal = goal
+
+	if len(rest) == 2 {
+		userInfo, err := slack.GetOrFindUser(parseUserReference(rest[1]))
+		if err != nil {
+			return privateResult(false, fmt.Sprintf("Could not find user '%s'. %v", rest[1], err))
+		}
+		// Make sure the wallet exists before it can be paid
+		beneficiary, err := database.GetUser(ctx, userInfo.ID, userInfo.Name)
+		if err != nil {
+			return privateResult(false, "Error loading the beneficiary. Please try again.")
+		}
+		if beneficiary.IsFrozen() {
+			return frozenRecipientResult(userInfo.ID)
+		}
+
+		// The whole goal is paid to the beneficiary at once, which must be allowed like any transfer
+		reason, err := policy.Evaluate(ctx, models.TransferRequest{
+			SenderID:    config.EscrowAccountID,
+			RecipientID: userInfo.ID,
+			Amount:      goal,
+		})
+		if err != nil {
+			return privateResult(false, "Error checking transfer limits. Please try again.")
+		}
+		if reason != "" {
+			return privateResult(false, reason)
+		}
+		pot.BeneficiaryID = userInfo.ID
+	}
+
+	if _, err := database.CreatePot(ctx, pot); err != nil {
+		return privateResult(false, "Error creating the pot. Please try again.")
+	}
+
+	text = fmt.Sprintf("💰 <@%s> started pot `%s`: %s", userID, pot.ID, pot.Title)
+	blocks := potBlocks(pot)
+	if database.GetSettings(ctx).IsQuietChannel(channelID) {
+		// Quiet channels get no live message, the pot is only shown to its creator
+		return models.CommandResult{Success: true, Message: text, Blocks: blocks, Ephemeral: true}
+	}
+	messageTS, err := slack.PostBlocksMessage(channelID, text, blocks)
+	if err != nil {
+		// Without a message to update, announce the pot through the command's response instead
+		log.Printf("Error posting message of pot %s: %v", pot.ID, err)
+		return models.CommandResult{Success: true, Message: text, Blocks: blocks}
+	}
+	database.SetPotMessage(ctx, pot.ID, messageTS)
+
+	return privateResult(true, fmt.Sprintf("💰 Pot `%s` is open until %s. Its message in the channel shows the progress.",
+		pot.ID, pot.Deadline.Format("2006-01-02 15:04 MST")))
+}
+
+// listPots lists the pots still collecting contributions
+func listPots(ctx context.Context) models.CommandResult {
+	pots, err := database.GetOpenPots(ctx, config.WorkspaceFromContext(ctx))
+	if err != nil {
+		return privateResult(false, "Error loading pots. Please try again.")
+	}
+	if len(pots) == 0 {
+		return privateResult(true, "No open pots. Start one with `/pot create \"Pizza for the support team\" 200`.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*Open Pots* 💰\n")
+	for _, pot := range pots {
+		sb.WriteString(fmt.Sprintf("• `%s` %s — %d / %d :corbacoin:, until %s\n",
+			pot.ID, pot.Title, pot.Raised, pot.Goal, pot.Deadline.Format("2006-01-02 15:04 MST")))
+	}
+	return privateResult(true, sb.String())
+}
+
+// showPot describes a pot and who contributed to it
+func showPot(ctx context.Context, potID string) models.CommandResult {
+	pot, result, ok := loadPot(ctx, potID)
+	if !ok {
+		return result
+	}
+
+	contributions, err := database.GetPotContributions(ctx, pot.ID)
+	if err != nil {
+		return privateResult(false, "Error loading the pot. Please try again.")
+	}
+	totals := make(map[string]int)
+	for _, contribution := range contributions {
+		totals[contribution.UserID] += contribution.Amount
+	}
+
+	blocks := potBlocks(pot)
+	message := fmt.Sprintf("*%s* — %d / %d :corbacoin:", pot.Title, pot.Raised, pot.Goal)
+	if len(totals) > 0 {
+		var sb strings.Builder
+		sb.WriteString("*Contributors*\n")
+		for _, entry := range topTotals(totals, len(totals)) {
+			sb.WriteString(fmt.Sprintf("• <@%s> %d :corbacoin:\n", entry.UserID, entry.Amount))
+		}
+		message += "\n" + sb.String()
+		blocks = append(blocks, slack.SectionBlock(sb.String()))
+	}
+	return models.CommandResult{Success: true, Message: message, Blocks: blocks, Ephemeral: true}
+}
+
+// giveToPot contributes coins to a pot, paying it out when the goal is reached
+func giveToPot(ctx context.Context, userID, username, potID, amountText string) models.CommandResult {
+	amount, err := strconv.Atoi(amountText)
+	if err != nil || amount <= 0 {
+		return privateResult(false, "The amount must be a positive whole number.")
+	}
+
+	pot, result, ok := loadPot(ctx, potID)
+	if !ok {
+		return result
+	}
+	if pot.BeneficiaryID == userID {
+		return privateResult(false, "You can't give to a pot that pays you.")
+	}
+
+	// Make sure the wallet exists before charging it
+	if _, err := database.GetUser(ctx, userID, username); err != nil {
+		return privateResult(false, "Error checking balance. Please try again.")
+	}
+
+	// A contribution to a pot with a beneficiary is a gift to them and follows the transfer limits
+	if pot.BeneficiaryID != "" && pot.Status == models.PotStatusOpen {
+		reason, err := policy.Evaluate(ctx, models.TransferRequest{
+			SenderID:    userID,
+			RecipientID: pot.BeneficiaryID,
+			Amount:      min(amount, pot.Remaining()),
+		})
+		if err != nil {
+			return privateResult(false, "Error checking transfer limits. Please try again.")
+		}
+		if reason != "" {
+			return privateResult(false, reason)
+		}
+	}
+
+	contributed, given, err := database.Contribute(ctx, pot.ID, userID, amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrPotClosed):
+			return privateResult(false, "This pot no longer takes contributions.")
+		case errors.Is(err, database.ErrOwnPot):
+			return privateResult(false, "You can't give to a pot that pays you.")
+		case errors.Is(err, database.ErrRecipientFrozen):
+			return privateResult(false, fmt.Sprintf("❄️ <@%s>'s wallet is frozen, so the pot can't be paid out and your contribution was not taken. "+
+				"The pot is refunded at its deadline, or when its creator cancels it.", pot.BeneficiaryID))
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return privateResult(false, "Insufficient funds! Check your balance with `/balance`.")
+		case errors.Is(err, database.ErrSenderFrozen):
+			return frozenSenderResult()
+		}
+		return privateResult(false, "Error giving to the pot. Please try again.")
+	}
+	pot = contributed
+
+	refreshPotMessage(pot)
+
+	message := fmt.Sprintf("💰 You gave %d :corbacoin: to pot `%s`.", given, pot.ID)
+	if given < amount {
+		message += fmt.Sprintf(" Only %d :corbacoin: were missing, so the rest stays in your wallet.", given)
+	}
+	if pot.Status == models.PotStatusOpen {
+		message += fmt.Sprintf(" %d :corbacoin: to go!", pot.Remaining())
+		return privateResult(true, message)
+	}
+
+	announcePotFunded(ctx, pot)
+	return privateResult(true, message+" 🎉 That completed the goal!")
+}
+
+// cancelPot refunds every contribution to a pot on behalf of its creator or an admin
+func cancelPot(ctx context.Context, userID, potID string) models.CommandResult {
+	pot, result, ok := loadPot(ctx, potID)
+	if !ok {
+		return result
+	}
+	if pot.CreatorID != userID && !IsAdmin(userID) {
+		return privateResult(false, "Only the pot's creator or an admin can cancel it.")
+	}
+
+	pot, refunds, err := database.RefundPot(ctx, pot.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrPotClosed) {
+			return privateResult(false, "This pot was already paid out or refunded.")
+		}
+		return privateResult(false, "Error cancelling the pot. Please try again.")
+	}
+
+	refreshPotMessage(pot)
+	for contributorID, refund := range refunds {
+		notifyParticipant(contributorID, fmt.Sprintf("↩️ Pot `%s` (%s) was cancelled: your %d :corbacoin: were refunded.", pot.ID, pot.Title, refund))
+	}
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("🚫 <@%s> cancelled pot `%s` and refunded %d :corbacoin: to %d users.", userID, pot.ID, pot.Raised, len(refunds)),
+	}
+}
+
+// RefundExpiredPots refunds the contributions to every pot that missed its goal by its deadline
+func RefundExpiredPots(ctx context.Context) error {
+	pots, err := database.GetOpenPots(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	refunded := 0
+	var failed error
+	for _, pot := range pots {
+		if now.Before(pot.Deadline) {
+			continue
+		}
+
+		potCtx := config.WithWorkspace(ctx, pot.WorkspaceID)
+		closed, refunds, err := database.RefundPot(potCtx, pot.ID)
+		if err != nil {
+			// Keep refunding the other pots
+			failed = err
+			continue
+		}
+
+		refreshPotMessage(closed)
+		for contributorID, refund := range refunds {
+			notifyParticipant(contributorID, fmt.Sprintf("↩️ Pot `%s` (%s) missed its goal: your %d :corbacoin: were refunded.", closed.ID, closed.Title, refund))
+		}
+		refunded++
+	}
+
+	log.Printf("Refunded %d pots", refunded)
+	return failed
+}
+
+// announcePotFunded tells the pot's channel, creator and beneficiary that it reached its goal
+func announcePotFunded(ctx context.Context, pot *models.Pot) {
+	message := fmt.Sprintf("🎉 Pot `%s` reached its goal of %d :corbacoin:! %s", pot.ID, pot.Goal, describePotOutcome(pot))
+	if err := slack.SendMessage(pot.Channel, message, pot.MessageTS); err != nil {
+		log.Printf("Error announcing pot %s: %v", pot.ID, err)
+	}
+
+	notifyParticipant(pot.CreatorID, message)
+	if pot.BeneficiaryID != "" && pot.BeneficiaryID != pot.CreatorID {
+		notifyParticipant(pot.BeneficiaryID, message)
+	}
+	if pot.BeneficiaryID != "" {
+		badges.Check(ctx, pot.BeneficiaryID)
+	}
+}
+
+// refreshPotMessage updates the pot's live message in its channel, if it has one
+func refreshPotMessage(pot *models.Pot) {
+	if pot.MessageTS == "" {
+		return
+	}
+	text := fmt.Sprintf("💰 Pot `%s`: %s — %d / %d :corbacoin:", pot.ID, pot.Title, pot.Raised, pot.Goal)
+	if err := slack.UpdateMessage(pot.Channel, pot.MessageTS, text, potBlocks(pot)); err != nil {
+		log.Printf("Error updating message of pot %s: %v", pot.ID, err)
+	}
+}
+
+// potBlocks lays out a pot's title, progress bar and status
+func potBlocks(pot *models.Pot) []models.Block {
+	header := fmt.Sprintf("💰 *%s*\nStarted by <@%s>", pot.Title, pot.CreatorID)
+	if pot.BeneficiaryID != "" {
+		header += fmt.Sprintf(" for <@%s>", pot.BeneficiaryID)
+	}
+
+	filled := min(pot.Raised*potProgressWidth/pot.Goal, potProgressWidth)
+	progress := fmt.Sprintf("`%s%s` %d%% · %d / %d :corbacoin:",
+		strings.Repeat("▓", filled), strings.Repeat("░", potProgressWidth-filled),
+		min(pot.Raised*100/pot.Goal, 100), pot.Raised, pot.Goal)
+
+	var footer string
+	switch pot.Status {
+	case models.PotStatusOpen:
+		footer = fmt.Sprintf("_`%s` · open until %s_\nGive with `/pot give %s amount`",
+			pot.ID, pot.Deadline.Format("2006-01-02 15:04 MST"), pot.ID)
+	case models.PotStatusRefunded:
+		footer = fmt.Sprintf("_`%s` · closed without being paid out, every contribution was refunded_", pot.ID)
+	default:
+		footer = fmt.Sprintf("_`%s` · goal reached!_ %s", pot.ID, describePotOutcome(pot))
+	}
+
+	return []models.Block{
+		slack.SectionBlock(header),
+		slack.SectionBlock(progress),
+		slack.SectionBlock(footer),
+	}
+}
+
+// describePotOutcome explains where the coins of a funded pot went
+func describePotOutcome(pot *models.Pot) string {
+	if pot.Status == models.PotStatusPaid {
+		return fmt.Sprintf("<@%s> received %d :corbacoin:.", pot.BeneficiaryID, pot.Raised)
+	}
+	return fmt.Sprintf("The pot was redeemed, <@%s> can go get it.", pot.CreatorID)
+}
+
+// loadPot retrieves a pot, returning an error result when it doesn't exist
+func loadPot(ctx context.Context, potID string) (*models.Pot, models.CommandResult, bool) {
+	pot, err := database.GetPot(ctx, strings.ToLower(potID))
+	if errors.Is(err, database.ErrPotNotFound) {
+		return nil, privateResult(false, fmt.Sprintf("There is no pot `%s`. Use `/pot list` to see open pots.", potID)), false
+	}
+	if err != nil {
+		return nil, privateResult(false, "Error loading the pot. Please try again."), false
+	}
+	return pot, models.CommandResult{}, true
+}
@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// HandleProfile returns the balance, giving streak and badges of a user, or of the caller when no user is given
+func HandleProfile(ctx context.Context, userID, username, target string) models.CommandResult {
+	target = strings.TrimSpace(target)
+	if target != "" {
+		userInfo, err := slack.GetOrFindUser(parseUserReference(target))
+		if err != nil {
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("Could not find user '%s'. %v", target, err),
+			}
+		}
+		userID, username = userInfo.ID, userInfo.Name
+	}
+
+	user, err := database.GetUser(ctx, userID, username)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error loading user. Please try again.",
+		}
+	}
+
+	header := fmt.Sprintf("*Profile of <@%s>*", userID)
+	details := fmt.Sprintf("*Balance:* %d :corbacoin:", user.Coins)
+	if !user.CreatedAt.IsZero() {
+		details += fmt.Sprintf("\n*Member since:* %s", user.CreatedAt.Format("Jan 2, 2006"))
+	}
+	if streak := formatStreak(user); streak != "" {
+		details += "\n" + streak
+	}
+
+	var earned strings.Builder
+	earned.WriteString("*Badges*\n")
+	count := 0
+	for _, badge := range badges.Definitions {
+		if !user.HasBadge(badge.ID) {
+			continue
+		}
+		earned.WriteString(fmt.Sprintf("%s *%s* - %s\n", badge.Emoji, badge.Name, badge.Description))
+		count++
+	}
+	if count == 0 {
+		earned.WriteString("_No badges yet_\n")
+	}
+	badgeText := strings.TrimSuffix(earned.String(), "\n")
+
+	return models.CommandResult{
+		Success: true,
+		Message: header + "\n" + details + "\n" + badgeText,
+		Blocks: []models.Block{
+			slack.SectionBlock(header),
+			slack.SectionBlock(details),
+			slack.SectionBlock(badgeText),
+		},
+	}
+}
@@ -0,0 +1,329 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/badges"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// maxTicketsPerPurchase is the largest number of raffle tickets bought at once
+const maxTicketsPerPurchase = 100
+
+// raffleUsage is the help text for the raffle commands
+const raffleUsage = "Usage: `/raffle start price --ends 17:00|2h`, `/raffle [list]`, `/raffle show id`, " +
+	"`/raffle buy id [count]`, `/raffle draw id` or `/raffle cancel id`"
+
+// HandleRaffle runs a raffle subcommand
+// Results meant for the channel, such as a new raffle or its winner, are not ephemeral
+func HandleRaffle(ctx context.Context, userID, username, channelID, text string) models.CommandResult {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return listRaffles(ctx)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "start":
+		return startRaffle(ctx, userID, channelID, args[1:])
+	case "list":
+		return listRaffles(ctx)
+	case "show":
+		if len(args) != 2 {
+			return privateResult(false, raffleUsage)
+		}
+		return showRaffle(ctx, args[1])
+	case "buy":
+		if len(args) < 2 || len(args) > 3 {
+			return privateResult(false, raffleUsage)
+		}
+		count := "1"
+		if len(args) == 3 {
+			count = args[2]
+		}
+		return buyTickets(ctx, userID, username, args[1], count)
+	case "draw":
+		if len(args) != 2 {
+			return privateResult(false, raffleUsage)
+		}
+		return drawRaffle(ctx, userID, args[1])
+	case "cancel":
+		if len(args) != 2 {
+			return privateResult(false, raffleUsage)
+		}
+		return cancelRaffle(ctx, userID, args[1])
+	default:
+		return privateResult(false, raffleUsage)
+	}
+}
+
+// startRaffle parses `price --ends when` and starts a raffle with a freshly committed seed
+func startRaffle(ctx context.Context, userID, channelID string, args []string) models.CommandResult {
+	if len(args) != 3 || strings.ToLower(args[1]) != "--ends" {
+		return privateResult(false, raffleUsage)
+	}
+
+	price, err := strconv.Atoi(args[0])
+	if err != nil || price <= 0 {
+		return privateResult(false, "The ticket price must be a positive whole number.")
+	}
+	endsAt, err := parseDeadline(args[2], localNow(ctx, userID))
+	if err != nil {
+		return privateResult(false, fmt.Sprintf("Could not understand `%s`. Use a time such as `17:00` or a duration such as `2h`.", args[2]))
+	}
+
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		log.Printf("Error generating raffle seed: %v", err)
+		return privateResult(false, "Error starting the raffle. Please try again.")
+	}
+
+	raffle := &models.Raffle{
+		CreatorID:   userID,
+		Channel:     channelID,
+		TicketPrice: price,
+		CutPercent:  database.GetSettings(ctx).RaffleCutPercent,
+		Status:      models.RaffleStatusOpen,
+		Seed:        hex.EncodeToString(seed),
+		EndsAt:      endsAt,
+		CreatedAt:   time.Now(),
+	}
+	raffle.SeedHash = models.HashSeed(raffle.Seed)
+	if _, err := database.CreateRaffle(ctx, raffle); err != nil {
+		return privateResult(false, "Error starting the raffle. Please try again.")
+	}
+
+	message := fmt.Sprintf("🎟️ <@%s> started raffle `%s`: tickets cost %d :corbacoin: and the draw is at %s.\n"+
+		"Buy tickets with `/raffle buy %s [count]`.\nSeed commitment (SHA-256): `%s`",
+		userID, raffle.ID, raffle.TicketPrice, raffle.EndsAt.Format("2006-01-02 15:04 MST"), raffle.ID, raffle.SeedHash)
+	if raffle.CutPercent > 0 {
+		message += fmt.Sprintf("\nThe treasury keeps %d%% of the pot.", raffle.CutPercent)
+	}
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// listRaffles lists the raffles that were not drawn yet
+func listRaffles(ctx context.Context) models.CommandResult {
+	raffles, err := database.GetOpenRaffles(ctx, config.WorkspaceFromContext(ctx))
+	if err != nil {
+		return privateResult(false, "Error loading raffles. Please try again.")
+	}
+	if len(raffles) == 0 {
+		return privateResult(true, "No open raffles. Start one with `/raffle start 5 --ends 17:00`.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*Open Raffles* 🎟️\n")
+	for _, raffle := range raffles {
+		sb.WriteString(fmt.Sprintf("• `%s` — %d :corbacoin: per ticket, %d :corbacoin: pot, draw at %s\n",
+			raffle.ID, raffle.TicketPrice, raffle.Pot, raffle.EndsAt.Format("2006-01-02 15:04 MST")))
+	}
+	return privateResult(true, sb.String())
+}
+
+// showRaffle describes a raffle, including the revealed seed once it was drawn
+func showRaffle(ctx context.Context, raffleID string) models.CommandResult {
+	raffle, result, ok := loadRaffle(ctx, raffleID)
+	if !ok {
+		return result
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*Raffle `%s`* 🎟️\n", raffle.ID))
+	sb.WriteString(fmt.Sprintf("• Started by <@%s>, %d :corbacoin: per ticket\n", raffle.CreatorID, raffle.TicketPrice))
+	sb.WriteString(fmt.Sprintf("• %d tickets sold, %d :corbacoin: pot\n", raffle.Tickets, raffle.Pot))
+	sb.WriteString(fmt.Sprintf("• Seed commitment: `%s`\n", raffle.SeedHash))
+	switch raffle.Status {
+	case models.RaffleStatusOpen:
+		sb.WriteString(fmt.Sprintf("• Draw at %s\n", raffle.EndsAt.Format("2006-01-02 15:04 MST")))
+	case models.RaffleStatusCancelled:
+		sb.WriteString("• Cancelled, every ticket was refunded\n")
+	case models.RaffleStatusDrawn:
+		sb.WriteString(describeDraw(raffle))
+	}
+	return privateResult(true, sb.String())
+}
+
+// buyTickets buys raffle tickets for a user
+func buyTickets(ctx context.Context, userID, username, raffleID, countText string) models.CommandResult {
+	count, err := strconv.Atoi(countText)
+	if err != nil || count <= 0 || count > maxTicketsPerPurchase {
+		return privateResult(false, fmt.Sprintf("You can buy between 1 and %d tickets at once.", maxTicketsPerPurchase))
+	}
+
+	raffle, result, ok := loadRaffle(ctx, raffleID)
+	if !ok {
+		return result
+	}
+
+	// Make sure the wallet exists before charging it
+	if _, err := database.GetUser(ctx, userID, username); err != nil {
+		return privateResult(false, "Error checking balance. Please try again.")
+	}
+
+	raffle, tickets, err := database.BuyTickets(ctx, raffle.ID, userID, count)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRaffleEnded):
+			return privateResult(false, "This raffle no longer sells tickets.")
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return privateResult(false, "Insufficient funds! Check your balance with `/balance`.")
+		case errors.Is(err, database.ErrSenderFrozen):
+			return privateResult(false, "❄️ Your wallet is frozen, so you can't buy tickets. Please contact an admin.")
+		}
+		return privateResult(false, "Error buying tickets. Please try again.")
+	}
+
+	numbers := fmt.Sprintf("#%d", tickets.First)
+	if tickets.Count > 1 {
+		numbers = fmt.Sprintf("#%d to #%d", tickets.First, tickets.First+tickets.Count-1)
+	}
+	return privateResult(true, fmt.Sprintf("🎟️ You bought %s for %d :corbacoin:. The pot is now %d :corbacoin:, drawn at %s.",
+		numbers, tickets.Count*raffle.TicketPrice, raffle.Pot, raffle.EndsAt.Format("2006-01-02 15:04 MST")))
+}
+
+// drawRaffle draws an ended raffle on behalf of its creator or an admin, without waiting for the scheduled job
+func drawRaffle(ctx context.Context, userID, raffleID string) models.CommandResult {
+	raffle, result, ok := loadSettleableRaffle(ctx, userID, raffleID)
+	if !ok {
+		return result
+	}
+	if time.Now().Before(raffle.EndsAt) {
+		return privateResult(false, fmt.Sprintf("This raffle sells tickets until %s.", raffle.EndsAt.Format("2006-01-02 15:04 MST")))
+	}
+
+	raffle, err := settleRaffle(ctx, raffle.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrRaffleSettled) {
+			return privateResult(false, "This raffle was already drawn or cancelled.")
+		}
+		return privateResult(false, "Error drawing the raffle. Please try again.")
+	}
+	return models.CommandResult{Success: true, Message: raffleResultMessage(raffle)}
+}
+
+// cancelRaffle refunds every ticket of a raffle on behalf of its creator or an admin
+func cancelRaffle(ctx context.Context, userID, raffleID string) models.CommandResult {
+	raffle, result, ok := loadSettleableRaffle(ctx, userID, raffleID)
+	if !ok {
+		return result
+	}
+
+	raffle, refunds, err := database.CancelRaffle(ctx, raffle.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrRaffleSettled) {
+			return privateResult(false, "This raffle was already drawn or cancelled.")
+		}
+		return privateResult(false, "Error cancelling the raffle. Please try again.")
+	}
+
+	for buyerID, refund := range refunds {
+		notifyParticipant(buyerID, fmt.Sprintf("↩️ Raffle `%s` was cancelled: your %d :corbacoin: were refunded.", raffle.ID, refund))
+	}
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("🚫 <@%s> cancelled raffle `%s` and refunded %d :corbacoin: to %d users.", userID, raffle.ID, raffle.Pot, len(refunds)),
+	}
+}
+
+// DrawDueRaffles draws every raffle whose sales ended and announces the winners in the raffles' channels
+func DrawDueRaffles(ctx context.Context) error {
+	raffles, err := database.GetOpenRaffles(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	drawn := 0
+	var failed error
+	for _, raffle := range raffles {
+		if now.Before(raffle.EndsAt) {
+			continue
+		}
+
+		raffleCtx := config.WithWorkspace(ctx, raffle.WorkspaceID)
+		settled, err := settleRaffle(raffleCtx, raffle.ID)
+		if err != nil {
+			// Keep drawing the other raffles
+			failed = err
+			continue
+		}
+		if err := slack.SendMessage(settled.Channel, raffleResultMessage(settled), ""); err != nil {
+			log.Printf("Error announcing raffle %s: %v", settled.ID, err)
+		}
+		drawn++
+	}
+
+	log.Printf("Drew %d raffles", drawn)
+	return failed
+}
+
+// settleRaffle draws a raffle and tells the winner
+func settleRaffle(ctx context.Context, raffleID string) (*models.Raffle, error) {
+	raffle, err := database.DrawRaffle(ctx, raffleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if raffle.WinnerID != "" {
+		notifyParticipant(raffle.WinnerID, fmt.Sprintf("🎉 Your ticket #%d won raffle `%s`: %d :corbacoin: are in your wallet!", raffle.WinningTicket, raffle.ID, raffle.Payout))
+		badges.Check(ctx, raffle.WinnerID)
+	}
+	return raffle, nil
+}
+
+// raffleResultMessage announces the outcome of a drawn raffle
+func raffleResultMessage(raffle *models.Raffle) string {
+	return fmt.Sprintf("🎟️ *Raffle `%s` was drawn*\n%s", raffle.ID, describeDraw(raffle))
+}
+
+// describeDraw explains the outcome of a drawn raffle and how to verify it
+func describeDraw(raffle *models.Raffle) string {
+	if raffle.WinnerID == "" {
+		return "• No tickets were sold, so there is no winner\n"
+	}
+
+	return fmt.Sprintf("• Ticket #%d of %d wins: <@%s> gets %d :corbacoin: of the %d :corbacoin: pot\n"+
+		"• Seed: `%s`\n"+
+		"• Verify that SHA-256(seed) is the commitment `%s`, and that the first 8 bytes of SHA-256(seed + \":%s\"), "+
+		"as a big-endian integer, modulo %d, plus 1 is %d\n",
+		raffle.WinningTicket, raffle.Tickets, raffle.WinnerID, raffle.Payout, raffle.Pot,
+		raffle.Seed, raffle.SeedHash, raffle.ID, raffle.Tickets, raffle.WinningTicket)
+}
+
+// loadRaffle retrieves a raffle, returning an error result when it doesn't exist
+func loadRaffle(ctx context.Context, raffleID string) (*models.Raffle, models.CommandResult, bool) {
+	raffle, err := database.GetRaffle(ctx, strings.ToLower(raffleID))
+	if errors.Is(err, database.ErrRaffleNotFound) {
+		return nil, privateResult(false, fmt.Sprintf("There is no raffle `%s`. Use `/raffle list` to see open raffles.", raffleID)), false
+	}
+	if err != nil {
+		return nil, privateResult(false, "Error loading the raffle. Please try again."), false
+	}
+	return raffle, models.CommandResult{}, true
+}
+
+// loadSettleableRaffle retrieves an open raffle the user is allowed to draw or cancel
+func loadSettleableRaffle(ctx context.Context, userID, raffleID string) (*models.Raffle, models.CommandResult, bool) {
+	raffle, result, ok := loadRaffle(ctx, raffleID)
+	if !ok {
+		return nil, result, false
+	}
+	if raffle.CreatorID != userID && !IsAdmin(userID) {
+		return nil, privateResult(false, "Only the raffle's creator or an admin can draw or cancel it."), false
+	}
+	if raffle.Status != models.RaffleStatusOpen {
+		return nil, privateResult(false, "This raffle was already drawn or cancelled."), false
+	}
+	return raffle, models.CommandResult{}, true
+}
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+func TestDescribeDrawRevealsCommittedSeed(t *testing.T) {
+	seed := "3f9a0c1e5b7d2468ace13579bdf02468ace13579bdf02468ace13579bdf02468"
+	raffle := &models.Raffle{
+		ID:       "r1",
+		Tickets:  12,
+		Pot:      60,
+		Payout:   60,
+		Seed:     seed,
+		SeedHash: models.HashSeed(seed),
+		WinnerID: "U1",
+	}
+	raffle.WinningTicket = models.DrawTicket(raffle.Seed, raffle.ID, raffle.Tickets)
+
+	matches := regexp.MustCompile("(?s)Seed: `([0-9a-f]+)`.*commitment `([0-9a-f]+)`").FindStringSubmatch(describeDraw(raffle))
+	if matches == nil {
+		t.Fatalf("describeDraw() does not reveal the seed and its commitment:\n%s", describeDraw(raffle))
+	}
+	if revealed, commitment := matches[1], matches[2]; models.HashSeed(revealed) != commitment {
+		t.Errorf("revealed seed %q hashes to %q, want the commitment %q", revealed, models.HashSeed(revealed), commitment)
+	}
+}
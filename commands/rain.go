@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// rainUsage is the help text for the rain command
+const rainUsage = "Usage: `/rain amount [memo]`"
+
+// HandleRain parses `amount [memo]` and splits the amount evenly among the users who posted in the
+// channel within the workspace's rain window, except the sender and bots
+// Every share is at least the rain_min_share setting, so a small rain only reaches the most recent
+// posters, and coins that don't divide evenly stay with the sender
+func HandleRain(ctx context.Context, userID, username, channelID, text string) models.CommandResult {
+	amountText, memo, _ := strings.Cut(strings.TrimSpace(text), " ")
+	amount, err := strconv.Atoi(amountText)
+	if err != nil {
+		return models.CommandResult{Success: false, Message: rainUsage}
+	}
+	if amount <= 0 {
+		return models.CommandResult{
+			Success: false,
+			Message: "Amount must be positive!",
+		}
+	}
+
+	settings := database.GetSettings(ctx)
+	if amount < settings.RainMinShare {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("A rain must be at least %d :corbacoin:.", settings.RainMinShare),
+		}
+	}
+
+	req := models.TransferRequest{
+		SenderID:   userID,
+		SenderName: username,
+		Amount:     amount,
+		Memo:       strings.TrimSpace(memo),
+		Channel:    channelID,
+	}
+	maxRecipients := min(amount/settings.RainMinShare, config.MaxGroupSendMembers)
+	recipients, err := recentPosters(ctx, channelID, userID, time.Duration(settings.RainWindowMinutes)*time.Minute, maxRecipients)
+	if err != nil {
+		log.Printf("Error reading recent messages of %s: %v", channelID, err)
+		return models.CommandResult{
+			Success: false,
+			Message: "Error reading the channel's recent messages. Please try again.",
+		}
+	}
+	if len(recipients) == 0 {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Nobody else posted here in the last %d minutes, so there's no one to rain on.", settings.RainWindowMinutes),
+		}
+	}
+
+	share := amount / len(recipients)
+	batch := make([]models.TransferRequest, len(recipients))
+	profiles := make(map[string]*models.SlackUserInfo, len(recipients))
+	for i, recipient := range recipients {
+		batch[i] = req
+		batch[i].Amount = share
+		batch[i].RecipientID = recipient.ID
+		batch[i].RecipientName = recipient.Name
+		profiles[recipient.ID] = &recipients[i]
+	}
+
+	if total := share * len(batch); total > settings.LargeTransferThreshold {
+		// Fail early when the transfers could not go through anyway
+		if result, ok := validateBatch(ctx, batch, profiles); !ok {
+			return result
+		}
+
+		message := fmt.Sprintf("You are about to make it rain %d :corbacoin: on %d people, %d :corbacoin: each. Are you sure?", total, len(batch), share)
+		return confirmationPrompt(ctx, &models.PendingTransfer{Transfer: req, Batch: batch}, message)
+	}
+
+	return executeRain(ctx, req, batch, profiles)
+}
+
+// recentPosters returns the users who posted in the channel within the window, most recent first and
+// at most limit of them, excluding the sender, bots, deactivated users and frozen wallets
+func recentPosters(ctx context.Context, channelID, senderID string, window time.Duration, limit int) ([]models.SlackUserInfo, error) {
+	messages, err := slack.GetChannelHistory(channelID, time.Now().Add(-window))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var posters []models.SlackUserInfo
+	for _, message := range messages {
+		if len(posters) >= limit {
+			break
+		}
+		if message.User == "" || message.BotID != "" || message.SubType == "bot_message" {
+			continue
+		}
+		if message.User == senderID || seen[message.User] {
+			continue
+		}
+		seen[message.User] = true
+
+		poster, err := slack.GetUserInfo(message.User)
+		if err != nil {
+			log.Printf("Error fetching poster %s: %v", message.User, err)
+			continue
+		}
+		if poster.IsBot || poster.Deleted {
+			continue
+		}
+
+		// A frozen wallet would fail the whole rain, so it is left out like a bot
+		wallet, err := database.GetUser(ctx, poster.ID, poster.Name)
+		if err != nil {
+			return nil, err
+		}
+		if wallet.IsFrozen() {
+			continue
+		}
+		posters = append(posters, *poster)
+	}
+	return posters, nil
+}
+
+// executeRain atomically pays the shares of a rain and returns its summary
+// req is the rain as requested, whose amount may exceed the sum of the shares, and recipients the
+// Slack profiles already fetched, by user ID
+func executeRain(ctx context.Context, req models.TransferRequest, batch []models.TransferRequest, recipients map[string]*models.SlackUserInfo) models.CommandResult {
+	if _, result, ok := executeBatch(ctx, batch, recipients); !ok {
+		return result
+	}
+
+	mentions := make([]string, len(batch))
+	for i, shareReq := range batch {
+		mentions[i] = fmt.Sprintf("<@%s>", shareReq.RecipientID)
+	}
+	share := batch[0].Amount
+	message := fmt.Sprintf("🌧️ <@%s> made it rain %d :corbacoin:! %s got %d :corbacoin: each",
+		req.SenderID, share*len(batch), strings.Join(mentions, ", "), share)
+	if left := req.Amount - share*len(batch); left > 0 {
+		message += fmt.Sprintf(" (%d :corbacoin: didn't split evenly and stayed with <@%s>)", left, req.SenderID)
+	}
+	if req.Memo != "" {
+		message += fmt.Sprintf(" — _%s_", req.Memo)
+	}
+	return models.CommandResult{
+		Success: true,
+		Message: message,
+	}
+}
@@ -0,0 +1,242 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// seasonUsage is the help text for the season admin commands
+const seasonUsage = "Usage: `/corbacoin admin season`, `/corbacoin admin season prizes amount... | off` or `/corbacoin admin season close`"
+
+// handleSeason shows the current season or changes its prizes or closes it
+func handleSeason(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) == 0 {
+		return describeSeason(ctx)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "prizes":
+		return handleSeasonPrizes(ctx, adminID, args[1:])
+	case "close":
+		return closeSeason(ctx, adminID)
+	default:
+		return models.CommandResult{Success: false, Message: seasonUsage}
+	}
+}
+
+// describeSeason shows the current season, its prizes and the balance wallets restart from
+func describeSeason(ctx context.Context) models.CommandResult {
+	settings := database.GetSettings(ctx)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*Season %d* 🏁\n", settings.CurrentSeason))
+	if !settings.SeasonStartedAt.IsZero() {
+		sb.WriteString(fmt.Sprintf("• Started on %s\n", settings.SeasonStartedAt.Format("2006-01-02")))
+	}
+	sb.WriteString(fmt.Sprintf("• Prizes: %s\n", formatPrizes(settings.SeasonPrizes)))
+	sb.WriteString(fmt.Sprintf("• Wallets restart from %d :corbacoin: when the season closes\n", settings.SeasonStartingBalance))
+
+	return models.CommandResult{Success: true, Message: sb.String()}
+}
+
+// handleSeasonPrizes sets the prizes awarded to the top of the ranking, best first
+func handleSeasonPrizes(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) == 0 {
+		return models.CommandResult{Success: false, Message: seasonUsage}
+	}
+
+	var prizes []int
+	if !(len(args) == 1 && strings.ToLower(args[0]) == "off") {
+		for _, arg := range args {
+			prize, err := strconv.Atoi(strings.Trim(arg, ","))
+			if err != nil || prize <= 0 {
+				return models.CommandResult{
+					Success: false,
+					Message: "Prizes must be positive whole numbers, e.g. `/corbacoin admin season prizes 50 30 20`.",
+				}
+			}
+			prizes = append(prizes, prize)
+		}
+	}
+
+	if _, err := database.UpdateSeasonPrizes(ctx, adminID, prizes); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error saving season prizes. Please try again.",
+		}
+	}
+
+	message := fmt.Sprintf("🏁 <@%s> set the season prizes to %s", adminID, formatPrizes(prizes))
+	announceAdminAction(message)
+
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// closeSeason archives the final ranking, awards the prizes and resets every active wallet for the next season
+// The ranking and the reset both start from one snapshot of the wallets, taken while escrow is empty
+func closeSeason(ctx context.Context, adminID string) models.CommandResult {
+	settings := database.GetSettings(ctx)
+
+	users, err := database.SnapshotWallets(ctx)
+	if errors.Is(err, database.ErrEscrowNotEmpty) {
+		return models.CommandResult{
+			Success: false,
+			Message: "Open markets, raffles or pots still hold coins in escrow. Resolve or cancel them before closing the season.",
+		}
+	}
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error loading wallets. Please try again.",
+		}
+	}
+
+	season := &models.Season{
+		Number:          settings.CurrentSeason,
+		ClosedAt:        time.Now(),
+		ClosedBy:        adminID,
+		StartingBalance: settings.SeasonStartingBalance,
+		Standings:       rankSeason(users, settings.SeasonPrizes),
+	}
+	if err := database.CloseSeason(ctx, season); err != nil {
+		if errors.Is(err, database.ErrSeasonAlreadyClosed) {
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("Season %d has already been closed.", season.Number),
+			}
+		}
+		return models.CommandResult{
+			Success: false,
+			Message: "Error closing the season. Please try again.",
+		}
+	}
+
+	// Every active wallet restarts from the starting balance, and winners get their prize on top
+	// Frozen wallets keep their balance, as they are left out of the ranking
+	snapshot := make(map[string]int)
+	balances := make(map[string]int)
+	for _, user := range users {
+		if !user.System && !user.IsFrozen() {
+			snapshot[user.UserID] = user.Coins
+			balances[user.UserID] = season.StartingBalance
+		}
+	}
+	for _, standing := range season.Standings {
+		balances[standing.UserID] += standing.Prize
+	}
+	if err := database.ResetBalances(ctx, snapshot, balances, fmt.Sprintf("season-%d", season.Number)); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Season %d was archived but resetting balances failed. Please check the logs.", season.Number),
+		}
+	}
+
+	for _, standing := range season.Standings {
+		if standing.Prize == 0 {
+			continue
+		}
+		message := fmt.Sprintf("🏆 You finished #%d in season %d and won %d :corbacoin:!", standing.Rank, season.Number, standing.Prize)
+		if err := slack.SendDirectMessage(standing.UserID, message); err != nil {
+			log.Printf("Error notifying %s of their season prize: %v", standing.UserID, err)
+		}
+	}
+
+	message := fmt.Sprintf("🏁 <@%s> closed season %d. Balances were reset to %d :corbacoin:.\n%s",
+		adminID, season.Number, season.StartingBalance, formatStandings(season, settings.LeaderboardLimit))
+	announceAdminAction(message)
+	if settings.AnnouncementChannel != "" {
+		if err := slack.SendMessage(settings.AnnouncementChannel, message, ""); err != nil {
+			log.Printf("Error announcing the end of season %d: %v", season.Number, err)
+		}
+	}
+
+	log.Printf("Season %d closed by %s: %d ranked wallets, %d reset", season.Number, adminID, len(season.Standings), len(balances))
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// rankSeason orders active wallets by balance and assigns the prizes to the top of the ranking
+// Frozen and system wallets are left out, as on the leaderboard
+func rankSeason(users []models.User, prizes []int) []models.SeasonStanding {
+	var ranked []models.User
+	for _, user := range users {
+		if !user.System && !user.IsFrozen() {
+			ranked = append(ranked, user)
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Coins != ranked[j].Coins {
+			return ranked[i].Coins > ranked[j].Coins
+		}
+		return ranked[i].UserID < ranked[j].UserID
+	})
+
+	standings := make([]models.SeasonStanding, 0, len(ranked))
+	for i, user := range ranked {
+		standing := models.SeasonStanding{
+			Rank:     i + 1,
+			UserID:   user.UserID,
+			Username: user.Username,
+			Coins:    user.Coins,
+		}
+		if i < len(prizes) {
+			standing.Prize = prizes[i]
+		}
+		standings = append(standings, standing)
+	}
+	return standings
+}
+
+// HandleSeasonLeaderboard returns the archived final ranking of a closed season
+func HandleSeasonLeaderboard(ctx context.Context, number int) (string, error) {
+	season, err := database.GetSeason(ctx, number)
+	if errors.Is(err, database.ErrSeasonNotFound) {
+		return fmt.Sprintf("Season %d has not been closed yet. The current season is %d.", number, database.GetSettings(ctx).CurrentSeason), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("*Corbacoin Leaderboard — Season %d* 🏆\n_Closed on %s_\n%s",
+		season.Number, season.ClosedAt.Format("2006-01-02"), formatStandings(season, database.GetSettings(ctx).LeaderboardLimit)), nil
+}
+
+// formatStandings lists the top of a season's final ranking and the prizes awarded
+func formatStandings(season *models.Season, limit int) string {
+	if len(season.Standings) == 0 {
+		return "No users were ranked."
+	}
+
+	var sb strings.Builder
+	for _, standing := range season.Standings[:min(limit, len(season.Standings))] {
+		sb.WriteString(fmt.Sprintf("%d. @%s: %d :corbacoin:", standing.Rank, standing.Username, standing.Coins))
+		if standing.Prize > 0 {
+			sb.WriteString(fmt.Sprintf(" — won %d :corbacoin:", standing.Prize))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// formatPrizes describes the prizes awarded to the top of the ranking
+func formatPrizes(prizes []int) string {
+	if len(prizes) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, 0, len(prizes))
+	for i, prize := range prizes {
+		parts = append(parts, fmt.Sprintf("#%d %d :corbacoin:", i+1, prize))
+	}
+	return strings.Join(parts, ", ")
+}
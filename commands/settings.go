@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+// settingHistoryLimit is the number of setting changes shown by the settings history command
+const settingHistoryLimit = 10
+
+// handleSettings shows the workspace's current settings, or their change history
+func handleSettings(ctx context.Context, args []string) models.CommandResult {
+	if len(args) > 0 && strings.ToLower(args[0]) == "history" {
+		return handleSettingHistory(ctx)
+	}
+
+	settings := database.GetSettings(ctx)
+
+	var sb strings.Builder
+	sb.WriteString("*Corbacoin Settings* ⚙️\n")
+	for _, definition := range models.SettingDefinitions {
+		sb.WriteString(fmt.Sprintf("• `%s` = *%d* — %s (%d-%d)\n",
+			definition.Key, *definition.Field(&settings), definition.Description, definition.Min, definition.Max))
+	}
+	if settings.UpdatedBy != "" {
+		sb.WriteString(fmt.Sprintf("_Last changed by <@%s> on %s_", settings.UpdatedBy, settings.UpdatedAt.Format("2006-01-02 15:04")))
+	}
+
+	return models.CommandResult{Success: true, Message: sb.String()}
+}
+
+// handleSettingHistory lists the most recent setting changes
+func handleSettingHistory(ctx context.Context) models.CommandResult {
+	changes, err := database.GetSettingHistory(ctx, settingHistoryLimit)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error loading settings history. Please try again.",
+		}
+	}
+
+	if len(changes) == 0 {
+		return models.CommandResult{Success: true, Message: "No settings have been changed yet."}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("*Settings History* 📜\n")
+	for _, change := range changes {
+		if change.Detail != "" {
+			sb.WriteString(fmt.Sprintf("• %s — <@%s> %s\n", change.CreatedAt.Format("2006-01-02 15:04"), change.AdminID, change.Detail))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("• %s — <@%s> changed `%s` from %d to %d\n",
+			change.CreatedAt.Format("2006-01-02 15:04"), change.AdminID, change.Key, change.OldValue, change.NewValue))
+	}
+
+	return models.CommandResult{Success: true, Message: sb.String()}
+}
+
+// handleSetSetting validates and stores a new value for a setting
+func handleSetSetting(ctx context.Context, adminID string, args []string) models.CommandResult {
+	usage := "Usage: `/corbacoin admin set setting value`. Use `/corbacoin admin settings` to list settings."
+	if len(args) != 2 {
+		return models.CommandResult{Success: false, Message: usage}
+	}
+
+	definition, ok := models.FindSettingDefinition(strings.ToLower(args[0]))
+	if !ok {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Unknown setting `%s`. Use `/corbacoin admin settings` to list settings.", args[0]),
+		}
+	}
+
+	value, err := strconv.Atoi(args[1])
+	if err != nil || value < definition.Min || value > definition.Max {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("`%s` must be a whole number between %d and %d.", definition.Key, definition.Min, definition.Max),
+		}
+	}
+
+	change, err := database.UpdateSetting(ctx, definition, value, adminID)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error saving setting. Please try again.",
+		}
+	}
+
+	message := fmt.Sprintf("⚙️ <@%s> changed `%s` from %d to %d", adminID, change.Key, change.OldValue, change.NewValue)
+	announceAdminAction(message)
+
+	return models.CommandResult{Success: true, Message: message}
+}
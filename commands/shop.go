@@ -0,0 +1,328 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+const (
+	// ActionBuyItem is the action ID of the button buying a shop item
+	ActionBuyItem = "buy_item"
+
+	// ActionDeliverOrder is the action ID of the button marking an order as delivered
+	ActionDeliverOrder = "deliver_order"
+
+	// ActionRefundOrder is the action ID of the button refunding an order
+	ActionRefundOrder = "refund_order"
+)
+
+// shopItemIDPattern matches the short IDs used to buy shop items, such as "coffee" or "day-off"
+var shopItemIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// shopUsage is the help text for the shop admin commands
+const shopUsage = "Usage: `/corbacoin admin shop add id price stock [@approver] name [| description]`, `/corbacoin admin shop stock id amount` or `/corbacoin admin shop remove id`"
+
+// HandleShop lists the items of the shop with a Buy button for each
+func HandleShop(ctx context.Context) (models.CommandResult, error) {
+	items, err := database.GetShopItems(ctx)
+	if err != nil {
+		return models.CommandResult{}, err
+	}
+
+	header := "*Corbacoin Shop* 🛍️"
+	if len(items) == 0 {
+		return models.CommandResult{Success: true, Message: header + "\nThe shop is empty for now."}, nil
+	}
+
+	text := header + "\n"
+	blocks := []models.Block{slack.SectionBlock(header)}
+	for _, item := range items {
+		line := fmt.Sprintf("*%s* (`%s`) — %d :corbacoin:", item.Name, item.ID, item.Price)
+		if item.Stock <= 0 {
+			line += " · _sold out_"
+		} else {
+			line += fmt.Sprintf(" · %d left", item.Stock)
+		}
+		if item.Description != "" {
+			line += "\n" + item.Description
+		}
+
+		text += "• " + line + "\n"
+		blocks = append(blocks, slack.SectionBlock(line))
+		if item.Stock > 0 {
+			blocks = append(blocks, slack.ActionsBlock("shop_item_"+item.ID,
+				slack.Button(fmt.Sprintf("Buy for %d", item.Price), ActionBuyItem, item.ID, "primary"),
+			))
+		}
+	}
+	text += "Use `/buy id` to buy an item."
+
+	return models.CommandResult{Success: true, Message: text, Blocks: blocks}, nil
+}
+
+// HandleBuy buys a shop item and asks its approver to deliver it
+func HandleBuy(ctx context.Context, userID, username, itemID string) models.CommandResult {
+	itemID = strings.ToLower(strings.TrimSpace(itemID))
+	if itemID == "" {
+		return models.CommandResult{Success: false, Message: "Usage: `/buy id`. Use `/shop` to see what's on sale."}
+	}
+
+	// Make sure the wallet exists before charging it
+	if _, err := database.GetUser(ctx, userID, username); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error checking balance. Please try again.",
+		}
+	}
+
+	order, err := database.Purchase(ctx, itemID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrItemNotFound):
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("There is no `%s` in the shop. Use `/shop` to see what's on sale.", itemID),
+			}
+		case errors.Is(err, database.ErrOutOfStock):
+			return models.CommandResult{Success: false, Message: "Sorry, this item is sold out."}
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return models.CommandResult{Success: false, Message: "Insufficient funds! You can't afford this item."}
+		case errors.Is(err, database.ErrSenderFrozen):
+			return models.CommandResult{
+				Success: false,
+				Message: "❄️ Your wallet is frozen, so you can't buy anything. Please contact an admin.",
+			}
+		}
+		return models.CommandResult{
+			Success: false,
+			Message: "Error processing purchase. Please try again.",
+		}
+	}
+
+	requestFulfilment(order)
+
+	message := fmt.Sprintf("🛍️ You bought *%s* for %d :corbacoin:.", order.ItemName, order.Price)
+	if order.ApproverID != "" {
+		message += fmt.Sprintf(" <@%s> will get it to you.", order.ApproverID)
+	} else {
+		message += " An admin will get it to you."
+	}
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// requestFulfilment asks the item's approver, or the admins when it has none, to deliver an order
+func requestFulfilment(order *models.Order) {
+	message := fmt.Sprintf("🛍️ <@%s> bought *%s* for %d :corbacoin:. Please deliver it or refund it.", order.BuyerID, order.ItemName, order.Price)
+	blocks := []models.Block{
+		slack.SectionBlock(message),
+		slack.ActionsBlock("order_"+order.ID,
+			slack.Button("Mark as delivered", ActionDeliverOrder, order.ID, "primary"),
+			slack.Button("Refund", ActionRefundOrder, order.ID, "danger"),
+		),
+	}
+
+	var err error
+	switch {
+	case order.ApproverID != "":
+		err = slack.SendDirectBlocksMessage(order.ApproverID, message, blocks)
+	case config.AdminLogChannel != "":
+		err = slack.SendBlocksMessage(config.AdminLogChannel, message, "", blocks)
+	default:
+		log.Printf("Order %s has no approver and ADMIN_LOG_CHANNEL is not set", order.ID)
+		return
+	}
+	if err != nil {
+		log.Printf("Error requesting fulfilment of order %s: %v", order.ID, err)
+	}
+}
+
+// DeliverOrder marks an order as delivered on behalf of its approver or an admin, and tells the buyer
+func DeliverOrder(ctx context.Context, orderID, userID string) models.CommandResult {
+	if result, ok := authorizeOrderHandler(ctx, orderID, userID); !ok {
+		return result
+	}
+
+	order, err := database.DeliverOrder(ctx, orderID, userID)
+	if err != nil {
+		return orderErrorResult(err)
+	}
+
+	notifyBuyer(order, fmt.Sprintf("📦 Your *%s* was delivered by <@%s>. Enjoy!", order.ItemName, userID))
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("📦 <@%s>'s *%s* was marked as delivered by <@%s>.", order.BuyerID, order.ItemName, userID),
+	}
+}
+
+// RefundOrder returns the price of an order to its buyer on behalf of its approver or an admin
+func RefundOrder(ctx context.Context, orderID, userID string) models.CommandResult {
+	if result, ok := authorizeOrderHandler(ctx, orderID, userID); !ok {
+		return result
+	}
+
+	order, err := database.RefundOrder(ctx, orderID, userID)
+	if err != nil {
+		return orderErrorResult(err)
+	}
+
+	notifyBuyer(order, fmt.Sprintf("↩️ Your purchase of *%s* was refunded by <@%s>: %d :corbacoin: are back in your wallet.", order.ItemName, userID, order.Price))
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("↩️ <@%s>'s *%s* was refunded by <@%s> (%d :corbacoin:).", order.BuyerID, order.ItemName, userID, order.Price),
+	}
+}
+
+// authorizeOrderHandler makes sure only the order's approver or an admin can handle it
+func authorizeOrderHandler(ctx context.Context, orderID, userID string) (models.CommandResult, bool) {
+	order, err := database.GetOrder(ctx, orderID)
+	if err != nil {
+		return models.CommandResult{Success: false, Message: "This order could not be found."}, false
+	}
+	if order.ApproverID != userID && !IsAdmin(userID) {
+		return models.CommandResult{
+			Success: false,
+			Message: "Only the item's approver or an admin can handle this order.",
+		}, false
+	}
+	return models.CommandResult{}, true
+}
+
+// orderErrorResult is the result returned when delivering or refunding an order fails
+func orderErrorResult(err error) models.CommandResult {
+	if errors.Is(err, database.ErrOrderHandled) {
+		return models.CommandResult{Success: false, Message: "This order was already handled."}
+	}
+	return models.CommandResult{Success: false, Message: "Error updating the order. Please try again."}
+}
+
+// notifyBuyer sends the buyer of an order a direct message about it
+func notifyBuyer(order *models.Order, message string) {
+	if err := slack.SendDirectMessage(order.BuyerID, message); err != nil {
+		log.Printf("Error notifying %s about order %s: %v", order.BuyerID, order.ID, err)
+	}
+}
+
+// handleShopAdmin adds items to the shop, restocks them or removes them
+func handleShopAdmin(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) < 2 {
+		return models.CommandResult{Success: false, Message: shopUsage}
+	}
+
+	itemID := strings.ToLower(args[1])
+	switch strings.ToLower(args[0]) {
+	case "add":
+		return addShopItem(ctx, adminID, itemID, args[2:])
+
+	case "stock":
+		if len(args) != 3 {
+			return models.CommandResult{Success: false, Message: shopUsage}
+		}
+		stock, err := strconv.Atoi(args[2])
+		if err != nil || stock < 0 {
+			return models.CommandResult{Success: false, Message: "Stock must be a whole number of 0 or more."}
+		}
+		if err := database.SetShopItemStock(ctx, itemID, stock); err != nil {
+			return shopItemErrorResult(err, itemID)
+		}
+		message := fmt.Sprintf("🛍️ <@%s> set the stock of `%s` to %d", adminID, itemID, stock)
+		announceAdminAction(message)
+		return models.CommandResult{Success: true, Message: message}
+
+	case "remove":
+		if err := database.DeleteShopItem(ctx, itemID); err != nil {
+			return shopItemErrorResult(err, itemID)
+		}
+		message := fmt.Sprintf("🛍️ <@%s> removed `%s` from the shop", adminID, itemID)
+		announceAdminAction(message)
+		return models.CommandResult{Success: true, Message: message}
+
+	default:
+		return models.CommandResult{Success: false, Message: shopUsage}
+	}
+}
+
+// addShopItem parses `price stock [@approver] name [| description]` and adds the item to the shop
+func addShopItem(ctx context.Context, adminID, itemID string, args []string) models.CommandResult {
+	if !shopItemIDPattern.MatchString(itemID) {
+		return models.CommandResult{
+			Success: false,
+			Message: "Item IDs may only contain lowercase letters, digits and dashes, e.g. `day-off`.",
+		}
+	}
+	if len(args) < 3 {
+		return models.CommandResult{Success: false, Message: shopUsage}
+	}
+
+	price, err := strconv.Atoi(args[0])
+	if err != nil || price <= 0 {
+		return models.CommandResult{Success: false, Message: "Price must be a positive whole number."}
+	}
+	stock, err := strconv.Atoi(args[1])
+	if err != nil || stock < 0 {
+		return models.CommandResult{Success: false, Message: "Stock must be a whole number of 0 or more."}
+	}
+
+	rest := args[2:]
+	approverID := ""
+	if strings.HasPrefix(rest[0], "<@") || strings.HasPrefix(rest[0], "@") {
+		identifier := parseUserReference(rest[0])
+		userInfo, err := slack.GetOrFindUser(identifier)
+		if err != nil {
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("Could not find user '%s'. %v", identifier, err),
+			}
+		}
+		approverID = userInfo.ID
+		rest = rest[1:]
+	}
+
+	name, description, _ := strings.Cut(strings.Join(rest, " "), "|")
+	name = strings.Trim(strings.TrimSpace(name), `"“”'`)
+	if name == "" {
+		return models.CommandResult{Success: false, Message: shopUsage}
+	}
+
+	item := &models.ShopItem{
+		ID:          itemID,
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		Price:       price,
+		Stock:       stock,
+		ApproverID:  approverID,
+		CreatedBy:   adminID,
+		CreatedAt:   time.Now(),
+	}
+	if err := database.CreateShopItem(ctx, item); err != nil {
+		return shopItemErrorResult(err, itemID)
+	}
+
+	message := fmt.Sprintf("🛍️ <@%s> added *%s* (`%s`) to the shop for %d :corbacoin:, %d in stock", adminID, item.Name, item.ID, item.Price, item.Stock)
+	if approverID != "" {
+		message += fmt.Sprintf(", delivered by <@%s>", approverID)
+	}
+	announceAdminAction(message)
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// shopItemErrorResult is the result returned when changing a shop item fails
+func shopItemErrorResult(err error, itemID string) models.CommandResult {
+	switch {
+	case errors.Is(err, database.ErrItemNotFound):
+		return models.CommandResult{Success: false, Message: fmt.Sprintf("There is no `%s` in the shop.", itemID)}
+	case errors.Is(err, database.ErrItemExists):
+		return models.CommandResult{Success: false, Message: fmt.Sprintf("An item with ID `%s` already exists.", itemID)}
+	}
+	return models.CommandResult{Success: false, Message: "Error updating the shop. Please try again."}
+}
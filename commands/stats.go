@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// EconomyStats summarizes the state of the Corbacoin economy
+type EconomyStats struct {
+	TotalSupply   int
+	Wallets       int
+	ActiveSenders int
+	Volume        int
+	Velocity      float64
+	MedianBalance float64
+	Gini          float64
+	ComputedAt    time.Time
+}
+
+var (
+	statsMu     sync.Mutex
+	cachedStats *EconomyStats
+)
+
+// HandleStats returns economy statistics as text with a Block Kit layout
+func HandleStats(ctx context.Context) (models.CommandResult, error) {
+	stats, err := getEconomyStats(ctx)
+	if err != nil {
+		return models.CommandResult{}, err
+	}
+
+	header := "*Corbacoin Economy* 📊"
+	footer := fmt.Sprintf("_Activity over the last %d days · updated %s_", config.StatsPeriodDays, stats.ComputedAt.Format("15:04"))
+	fields := []string{
+		fmt.Sprintf("*Total supply*\n%d :corbacoin:", stats.TotalSupply),
+		fmt.Sprintf("*Wallets*\n%d", stats.Wallets),
+		fmt.Sprintf("*Active senders*\n%d", stats.ActiveSenders),
+		fmt.Sprintf("*Velocity*\n%.2f (%d :corbacoin: moved)", stats.Velocity, stats.Volume),
+		fmt.Sprintf("*Median balance*\n%.1f :corbacoin:", stats.MedianBalance),
+		fmt.Sprintf("*Gini coefficient*\n%.2f", stats.Gini),
+	}
+
+	text := header + "\n"
+	for _, field := range fields {
+		text += "• " + field + "\n"
+	}
+	text += footer
+
+	return models.CommandResult{
+		Success: true,
+		Message: text,
+		Blocks: []models.Block{
+			slack.SectionBlock(header),
+			slack.FieldsBlock(fields...),
+			slack.SectionBlock(footer),
+		},
+	}, nil
+}
+
+// getEconomyStats returns the cached statistics, recomputing them once they are older than config.StatsCacheTTL
+func getEconomyStats(ctx context.Context) (*EconomyStats, error) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	if cachedStats != nil && time.Since(cachedStats.ComputedAt) < config.StatsCacheTTL*time.Second {
+		return cachedStats, nil
+	}
+
+	users, err := database.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers, err := database.GetTransfersSince(ctx, time.Now().AddDate(0, 0, -config.StatsPeriodDays))
+	if err != nil {
+		return nil, err
+	}
+
+	cachedStats = computeEconomyStats(users, transfers)
+	return cachedStats, nil
+}
+
+// computeEconomyStats derives the statistics from all wallets and the period's transfers
+// System wallets are left out: the coins they don't hold are exactly the coins in circulation
+func computeEconomyStats(users []models.User, transfers []models.Transfer) *EconomyStats {
+	stats := &EconomyStats{
+		ComputedAt: time.Now(),
+	}
+
+	balances := make([]int, 0, len(users))
+	for _, user := range users {
+		if user.System {
+			continue
+		}
+		stats.TotalSupply += user.Coins
+		balances = append(balances, user.Coins)
+	}
+	stats.Wallets = len(balances)
+	sort.Ints(balances)
+
+	senders := make(map[string]bool)
+	for _, transfer := range transfers {
+		// Undone transfers and self-sends did not actually move coins
+		if transfer.Type != models.TransferTypeTransfer || transfer.ReversedBy != "" || transfer.SenderID == transfer.RecipientID {
+			continue
+		}
+		senders[transfer.SenderID] = true
+		stats.Volume += transfer.Amount
+	}
+	stats.ActiveSenders = len(senders)
+
+	if stats.TotalSupply > 0 {
+		stats.Velocity = float64(stats.Volume) / float64(stats.TotalSupply)
+	}
+	stats.MedianBalance = median(balances)
+	stats.Gini = gini(balances, stats.TotalSupply)
+
+	return stats
+}
+
+// median returns the median of sorted values
+func median(sorted []int) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return float64(sorted[n/2])
+	}
+	return float64(sorted[n/2-1]+sorted[n/2]) / 2
+}
+
+// gini returns the Gini coefficient of sorted balances: 0 when everyone holds the same amount,
+// approaching 1 when a single wallet holds everything
+func gini(sorted []int, total int) float64 {
+	n := len(sorted)
+	if n == 0 || total == 0 {
+		return 0
+	}
+
+	weighted := 0
+	for i, balance := range sorted {
+		weighted += (i + 1) * balance
+	}
+	return 2*float64(weighted)/(float64(n)*float64(total)) - float64(n+1)/float64(n)
+}
@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+const streaksUsage = "Usage: `/corbacoin admin streaks` or `/corbacoin admin streaks days:bonus... | off`"
+
+// recordGivingStreak counts the day of a transfer towards the sender's giving streak
+// and tells them when a milestone bonus was paid
+func recordGivingStreak(ctx context.Context, transfer *models.Transfer) {
+	// Sending to yourself doesn't count as giving
+	if transfer.SenderID == transfer.RecipientID {
+		return
+	}
+
+	// An empty time zone keeps the one saved with the streak
+	timeZone := ""
+	if userInfo, err := slack.GetUserInfo(transfer.SenderID); err != nil {
+		log.Printf("Error fetching time zone of %s: %v", transfer.SenderID, err)
+	} else {
+		timeZone = userInfo.TZ
+	}
+
+	update, err := database.RecordGivingDay(ctx, transfer.SenderID, transfer.ID, timeZone, transfer.CreatedAt, database.GetSettings(ctx).StreakMilestones)
+	if err != nil || update.Bonus == 0 {
+		return
+	}
+
+	message := fmt.Sprintf("🔥 %d-day giving streak! You earned a bonus of %d :corbacoin:.", update.Days, update.Bonus)
+	if err := slack.SendDirectMessage(transfer.SenderID, message); err != nil {
+		log.Printf("Error notifying %s of their streak bonus: %v", transfer.SenderID, err)
+	}
+}
+
+// formatStreak describes a user's current giving streak, or returns "" when they have none
+func formatStreak(user *models.User) string {
+	days := user.CurrentStreak(time.Now())
+	if days == 0 {
+		return ""
+	}
+	return fmt.Sprintf("🔥 %d-day giving streak", days)
+}
+
+// WarnBreakingStreaks sends a direct message to users whose giving streak breaks at the end of their
+// local day, once it is past config.StreakWarningHour for them
+func WarnBreakingStreaks(ctx context.Context) error {
+	users, err := database.GetStreakingUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	warned := 0
+	for _, user := range users {
+		if user.StreakDays < config.StreakWarningMinDays || !user.StreakAtRisk(now) {
+			continue
+		}
+		today := user.StreakDay(now)
+		if user.StreakWarnedDay == today || now.In(user.Location()).Hour() < config.StreakWarningHour {
+			continue
+		}
+
+		message := fmt.Sprintf("⏳ Your %d-day giving streak ends at midnight! Send some :corbacoin: today to keep it going.", user.StreakDays)
+		if err := slack.SendDirectMessage(user.UserID, message); err != nil {
+			log.Printf("Error warning %s about their streak: %v", user.UserID, err)
+			continue
+		}
+		if err := database.MarkStreakWarned(ctx, user.UserID, today); err != nil {
+			return err
+		}
+		warned++
+	}
+
+	log.Printf("Warned %d users about breaking streaks", warned)
+	return nil
+}
+
+// handleStreaks shows or replaces the bonuses paid at giving streak milestones
+func handleStreaks(ctx context.Context, adminID string, args []string) models.CommandResult {
+	if len(args) == 0 {
+		milestones := database.GetSettings(ctx).StreakMilestones
+		return models.CommandResult{
+			Success: true,
+			Message: fmt.Sprintf("*Giving streak milestones* 🔥\n%s", formatStreakMilestones(milestones)),
+		}
+	}
+
+	var milestones []models.StreakMilestone
+	if !(len(args) == 1 && strings.ToLower(args[0]) == "off") {
+		seen := make(map[int]bool)
+		for _, arg := range args {
+			milestone, ok := parseStreakMilestone(strings.Trim(arg, ","))
+			if !ok || seen[milestone.Days] {
+				return models.CommandResult{
+					Success: false,
+					Message: "Milestones must be distinct days:bonus pairs of positive whole numbers, e.g. `/corbacoin admin streaks 7:5 30:20`.",
+				}
+			}
+			seen[milestone.Days] = true
+			milestones = append(milestones, milestone)
+		}
+		sort.Slice(milestones, func(i, j int) bool { return milestones[i].Days < milestones[j].Days })
+	}
+
+	if _, err := database.UpdateStreakMilestones(ctx, adminID, milestones); err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Error saving streak milestones. Please try again.",
+		}
+	}
+
+	message := fmt.Sprintf("🔥 <@%s> set the giving streak milestones to %s", adminID, formatStreakMilestones(milestones))
+	announceAdminAction(message)
+
+	return models.CommandResult{Success: true, Message: message}
+}
+
+// parseStreakMilestone parses a days:bonus pair
+func parseStreakMilestone(text string) (models.StreakMilestone, bool) {
+	daysText, bonusText, found := strings.Cut(text, ":")
+	if !found {
+		return models.StreakMilestone{}, false
+	}
+	days, err := strconv.Atoi(daysText)
+	if err != nil || days <= 0 {
+		return models.StreakMilestone{}, false
+	}
+	bonus, err := strconv.Atoi(bonusText)
+	if err != nil || bonus <= 0 {
+		return models.StreakMilestone{}, false
+	}
+	return models.StreakMilestone{Days: days, Bonus: bonus}, true
+}
+
+// formatStreakMilestones describes the bonuses paid at giving streak milestones
+func formatStreakMilestones(milestones []models.StreakMilestone) string {
+	if len(milestones) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, 0, len(milestones))
+	for _, milestone := range milestones {
+		parts = append(parts, fmt.Sprintf("%d days → %d :corbacoin:", milestone.Days, milestone.Bonus))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// ActionUndoTransfer is the action ID of the button reverting a completed transfer
+const ActionUndoTransfer = "undo_transfer"
+
+// undoableTransferBlocks returns the announcement of a transfer with an Undo button for the sender
+func undoableTransferBlocks(ctx context.Context, message, transferID string) []models.Block {
+	undoWindow := database.GetSettings(ctx).UndoWindowMinutes
+	return []models.Block{
+		slack.SectionBlock(message),
+		slack.ActionsBlock("undo_transfer",
+			slack.Button(fmt.Sprintf("Undo (%d min)", undoWindow), ActionUndoTransfer, transferID, ""),
+		),
+	}
+}
+
+// UndoTransfer reverts a transfer on behalf of its sender within the undo window
+// The recipient must still hold the transferred coins, and the sender any streak bonus the transfer earned
+func UndoTransfer(ctx context.Context, transferID, userID string) models.CommandResult {
+	transfer, err := database.GetTransfer(ctx, transferID)
+	if err != nil {
+		return models.CommandResult{
+			Success: false,
+			Message: "Could not find this transfer.",
+		}
+	}
+
+	if transfer.SenderID != userID {
+		return models.CommandResult{
+			Success: false,
+			Message: "Only the sender can undo this transfer.",
+		}
+	}
+
+	undoWindow := database.GetSettings(ctx).UndoWindowMinutes
+	if time.Since(transfer.CreatedAt) > time.Duration(undoWindow)*time.Minute {
+		return models.CommandResult{
+			Success: false,
+			Message: fmt.Sprintf("Transfers can only be undone within %d minutes.", undoWindow),
+		}
+	}
+
+	if _, err := database.ReverseTransfer(ctx, transferID); err != nil {
+		switch {
+		case errors.Is(err, database.ErrAlreadyReversed):
+			return models.CommandResult{
+				Success: false,
+				Message: "This transfer was already undone.",
+			}
+		case errors.Is(err, database.ErrSenderFrozen):
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("❄️ <@%s>'s wallet is frozen, so the transfer can't be undone.", transfer.RecipientID),
+			}
+		case errors.Is(err, database.ErrRecipientFrozen):
+			return frozenSenderResult()
+		case errors.Is(err, database.ErrInsufficientFunds):
+			return models.CommandResult{
+				Success: false,
+				Message: fmt.Sprintf("<@%s> no longer has the %d :corbacoin: to return.", transfer.RecipientID, transfer.Amount),
+			}
+		case errors.Is(err, database.ErrStreakBonusSpent):
+			return models.CommandResult{
+				Success: false,
+				Message: "You no longer have the giving streak bonus this transfer earned, so it can't be undone.",
+			}
+		default:
+			return models.CommandResult{
+				Success: false,
+				Message: "Error undoing transfer. Please try again.",
+			}
+		}
+	}
+
+	return models.CommandResult{
+		Success: true,
+		Message: fmt.Sprintf("~<@%s> sent %d :corbacoin: to <@%s>~\n↩️ Reverted by the sender.", transfer.SenderID, transfer.Amount, transfer.RecipientID),
+	}
+}
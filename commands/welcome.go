@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// WelcomeMember creates the wallet of a user who just joined the workspace, sends them a welcome
+// direct message and, when the workspace has an intro channel, introduces them there
+// Bots and users who already have a wallet are left alone
+func WelcomeMember(ctx context.Context, member *models.SlackUserInfo) {
+	if member.IsBot || member.Deleted {
+		return
+	}
+
+	user, created, err := database.CreateWallet(ctx, member)
+	if err != nil || !created {
+		return
+	}
+
+	message := fmt.Sprintf(`👋 Welcome to the team, <@%s>! This workspace uses *Corbacoin* :corbacoin: to say thanks.
+
+You start with %d :corbacoin:. Give some to someone who helped you with `+"`/send @user amount [memo]`"+`, check your balance with `+"`/balance`"+` and spend your coins in the `+"`/shop`"+`. Type `+"`/corbacoin help`"+` to see everything you can do.`, user.UserID, user.Coins)
+	if err := slack.SendDirectMessage(user.UserID, message); err != nil {
+		log.Printf("Error welcoming %s: %v", user.UserID, err)
+	}
+
+	introChannel := database.GetSettings(ctx).IntroChannel
+	if introChannel == "" {
+		return
+	}
+	intro := fmt.Sprintf("👋 Please welcome <@%s>, who just joined with %d :corbacoin:! Send them a coin to say hi.", user.UserID, user.Coins)
+	if err := slack.SendMessage(introChannel, intro, ""); err != nil {
+		log.Printf("Error introducing %s in %s: %v", user.UserID, introChannel, err)
+	}
+}
@@ -1,6 +1,8 @@
 package config
 
 const (
+	// The following are defaults for settings that admins can change at runtime
+
 	// InitialCoins is the number of coins a new user starts with
 	InitialCoins = 5
 
@@ -9,6 +11,79 @@ const (
 
 	// RequestTimestampTolerance is the maximum age of a request in seconds (5 minutes)
 	RequestTimestampTolerance = 300
+
+	// MaxRequestTimestampTolerance is the largest request timestamp tolerance admins can set, in seconds
+	// Signatures are checked against it before any workspace setting is read
+	MaxRequestTimestampTolerance = 900
+
+	// PairCapPeriodHours is the period over which transfers to the same recipient are capped
+	PairCapPeriodHours = 168
+
+	// DemurrageThreshold is the balance above which idle wallets decay
+	DemurrageThreshold = 50
+
+	// DemurrageRatePercent is the percentage of the balance above the threshold lost per period
+	DemurrageRatePercent = 5
+
+	// DemurragePeriodDays is the number of days between two decays of the same wallet
+	DemurragePeriodDays = 7
+
+	// DemurrageIdleDays is the number of days without sending before a wallet decays
+	DemurrageIdleDays = 14
+
+	// DigestTopCount is the number of top receivers and givers listed in the weekly digest
+	DigestTopCount = 3
+
+	// StatsCacheTTL is how long economy statistics are cached in seconds
+	StatsCacheTTL = 300
+
+	// StatsPeriodDays is the number of days of transfer history used for economy statistics
+	StatsPeriodDays = 30
+
+	// WalletBatchSize is the number of wallets updated in a single transaction by batch jobs
+	WalletBatchSize = 100
+
+	// TreasuryAccountID is the ID of the system wallet that issues coins and collects decayed coins
+	TreasuryAccountID = "treasury"
+
+	// EscrowAccountID is the ID of the system wallet holding coins on behalf of users
+	EscrowAccountID = "escrow"
+
+	// FeesAccountID is the ID of the system wallet collecting fees
+	FeesAccountID = "fees"
+
+	// BurnAccountID is the ID of the system wallet receiving destroyed coins
+	BurnAccountID = "burn"
+
+	// SettingsCacheTTL is how long settings read from the database are cached in seconds
+	SettingsCacheTTL = 60
+
+	// PendingTransferExpiry is how long a large transfer awaits confirmation in seconds (5 minutes)
+	PendingTransferExpiry = 300
+
+	// StreakWarningHour is the local hour from which users are warned that their giving streak is about to break
+	StreakWarningHour = 18
+
+	// PotDeadlineDays is how long a pot collects contributions when created without a deadline
+	PotDeadlineDays = 7
+
+	// LoanReminderDays is how many days before a loan's due date the borrower is reminded
+	LoanReminderDays = 3
+
+	// MaxLoanInterestPercent is the highest flat interest a loan may charge
+	MaxLoanInterestPercent = 100
+
+	// StreakWarningMinDays is the shortest giving streak users are warned about
+	StreakWarningMinDays = 2
+
+	// MaxGroupSendMembers is the most members a user group can have to be sent coins in one go
+	MaxGroupSendMembers = 50
+
+	// RainWindowMinutes is the default time window in which channel members must have posted to catch a rain
+	RainWindowMinutes = 30
+
+	// RainMinShare is the default smallest amount each member catching a rain gets
+	RainMinShare = 1
 )
 
 var (
@@ -18,7 +93,28 @@ var (
 	// SlackSigningSecret is used to verify Slack requests
 	SlackSigningSecret string
 
+	// SchedulerToken authenticates calls to the scheduled jobs endpoint
+	SchedulerToken string
+
+	// DigestChannel is the channel where the weekly digest is posted
+	DigestChannel string
+
+	// AdminUserIDs are the Slack user IDs allowed to run admin commands
+	AdminUserIDs []string
+
+	// AdminLogChannel is the channel where admin actions are announced
+	AdminLogChannel string
+
+	// DefaultWorkspaceID is the workspace used when a request does not identify one,
+	// e.g. for scheduled jobs and signature verification
+	DefaultWorkspaceID = "default"
+
 	// FirestoreDatabase is the name of the Firestore database
 	FirestoreDatabase = "corbacoin-database"
-)
 
+	// LargeTransferThreshold is the default amount above which a transfer must be confirmed by the sender
+	LargeTransferThreshold = 100
+
+	// UndoWindowMinutes is the default time after a transfer during which the sender can undo it
+	UndoWindowMinutes = 5
+)
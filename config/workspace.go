@@ -0,0 +1,22 @@
+package config
+
+import "context"
+
+// workspaceKey is the context key holding the Slack workspace (team) ID of a request
+type workspaceKey struct{}
+
+// WithWorkspace returns a context carrying the Slack workspace (team) ID
+func WithWorkspace(ctx context.Context, workspaceID string) context.Context {
+	if workspaceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, workspaceKey{}, workspaceID)
+}
+
+// WorkspaceFromContext returns the workspace ID carried by the context, or DefaultWorkspaceID
+func WorkspaceFromContext(ctx context.Context) string {
+	if workspaceID, ok := ctx.Value(workspaceKey{}).(string); ok {
+		return workspaceID
+	}
+	return DefaultWorkspaceID
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// givingPairRef returns the document counting the transfers from sender to recipient
+func givingPairRef(senderID, recipientID string) *firestore.DocumentRef {
+	return Client.Collection("giving_pairs").Doc(senderID + "-" + recipientID)
+}
+
+// readGivingPair reads how many transfers from sender to recipient count for badges within a transaction
+// A pair without a document yet is counted from the transfer history, once
+func readGivingPair(tx *firestore.Transaction, senderID, recipientID string) (*models.GivingPair, error) {
+	pair := &models.GivingPair{SenderID: senderID, RecipientID: recipientID}
+
+	doc, err := tx.Get(givingPairRef(senderID, recipientID))
+	if err == nil {
+		if err := doc.DataTo(pair); err != nil {
+			return nil, err
+		}
+		return pair, nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	transfers, err := readTransfers(tx.Documents(Client.Collection("transfers").
+		Where("sender_id", "==", senderID).
+		Where("recipient_id", "==", recipientID)))
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range transfers {
+		if transfer.Counts() {
+			pair.Transfers++
+		}
+	}
+	return pair, nil
+}
+
+// countGiving adds delta transfers to a pair and returns the changes to the badge counters of its
+// sender and recipient, which only apply to wallets whose counters were already backfilled
+func countGiving(pair *models.GivingPair, delta int) (senderChange, recipientChange walletChange) {
+	distinct := 0
+	switch {
+	case pair.Transfers == 0 && pair.Transfers+delta > 0:
+		distinct = 1
+	case pair.Transfers > 0 && pair.Transfers+delta <= 0:
+		distinct = -1
+	}
+	pair.Transfers = max(pair.Transfers+delta, 0)
+
+	senderChange = func(user *models.User) ([]firestore.Update, error) {
+		if !user.ActivityCounted {
+			return nil, nil
+		}
+		return []firestore.Update{
+			{Path: "transfers_sent", Value: max(user.TransfersSent+delta, 0)},
+			{Path: "distinct_recipients", Value: max(user.DistinctRecipients+distinct, 0)},
+		}, nil
+	}
+	recipientChange = func(user *models.User) ([]firestore.Update, error) {
+		if !user.ActivityCounted || distinct == 0 {
+			return nil, nil
+		}
+		return []firestore.Update{
+			{Path: "distinct_senders", Value: max(user.DistinctSenders+distinct, 0)},
+		}, nil
+	}
+	return senderChange, recipientChange
+}
+
+// CountActivity backfills a user's badge counters from their transfer history and returns the user
+// It only reads the history once: afterwards every transfer and undo keeps the counters up to date
+func CountActivity(ctx context.Context, userID string) (*models.User, error) {
+	userRef := Client.Collection("users").Doc(userID)
+
+	var user models.User
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		user = models.User{}
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if user.ActivityCounted {
+			return nil
+		}
+
+		sent, err := readTransfers(tx.Documents(Client.Collection("transfers").Where("sender_id", "==", userID)))
+		if err != nil {
+			return err
+		}
+		received, err := readTransfers(tx.Documents(Client.Collection("transfers").Where("recipient_id", "==", userID)))
+		if err != nil {
+			return err
+		}
+
+		recipients := make(map[string]bool)
+		senders := make(map[string]bool)
+		user.TransfersSent = 0
+		for _, transfer := range sent {
+			if transfer.Counts() {
+				user.TransfersSent++
+				recipients[transfer.RecipientID] = true
+			}
+		}
+		for _, transfer := range received {
+			if transfer.Counts() {
+				senders[transfer.SenderID] = true
+			}
+		}
+		user.DistinctRecipients = len(recipients)
+		user.DistinctSenders = len(senders)
+		user.ActivityCounted = true
+
+		return tx.Update(userRef, []firestore.Update{
+			{Path: "activity_counted", Value: true},
+			{Path: "transfers_sent", Value: user.TransfersSent},
+			{Path: "distinct_recipients", Value: user.DistinctRecipients},
+			{Path: "distinct_senders", Value: user.DistinctSenders},
+		})
+	})
+	if err != nil {
+		log.Printf("Error counting activity of %s: %v", userID, err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// readTransfers reads every transfer of a query
+func readTransfers(iter *firestore.DocumentIterator) ([]models.Transfer, error) {
+	defer iter.Stop()
+
+	var transfers []models.Transfer
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return transfers, err
+		}
+
+		var transfer models.Transfer
+		if err := doc.DataTo(&transfer); err != nil {
+			log.Printf("Error parsing transfer %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		transfer.ID = doc.Ref.ID
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
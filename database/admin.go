@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+// ApplyAdminAction atomically adjusts a user's balance or status and records the admin action
+// Admin actions deliberately apply to frozen wallets too, e.g. to burn a departed user's coins
+// Created coins come from the treasury and destroyed coins go to the burn account
+// PreviousBalance and NewBalance are filled in on the given action
+func ApplyAdminAction(ctx context.Context, action *models.AdminAction) error {
+	userRef := Client.Collection("users").Doc(action.UserID)
+	actionRef := Client.Collection("admin_actions").NewDoc()
+
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+
+		action.PreviousBalance = user.Coins
+		status := user.Status
+		switch action.Action {
+		case models.AdminActionMint:
+			action.NewBalance = user.Coins + action.Amount
+		case models.AdminActionBurn:
+			if user.Coins < action.Amount {
+				return ErrInsufficientFunds
+			}
+			action.NewBalance = user.Coins - action.Amount
+		case models.AdminActionSetBalance:
+			action.NewBalance = action.Amount
+		case models.AdminActionFreeze:
+			action.NewBalance = user.Coins
+			status = models.UserStatusFrozen
+		case models.AdminActionUnfreeze:
+			action.NewBalance = user.Coins
+			status = models.UserStatusActive
+		default:
+			return fmt.Errorf("unknown admin action: %s", action.Action)
+		}
+
+		// Coins come from the treasury and go to the burn account
+		delta := action.NewBalance - action.PreviousBalance
+		counterpartID := config.TreasuryAccountID
+		if delta < 0 {
+			counterpartID = config.BurnAccountID
+		}
+		if err := tx.Update(userRef, []firestore.Update{
+			{Path: "coins", Value: action.NewBalance},
+			{Path: "status", Value: status},
+		}); err != nil {
+			return err
+		}
+		if err := tx.Create(actionRef, action); err != nil {
+			return err
+		}
+		if delta == 0 {
+			return nil
+		}
+		if err := adjustSystemAccount(tx, counterpartID, -delta); err != nil {
+			return err
+		}
+		return postEntry(tx, action.Action, actionRef.ID,
+			models.Posting{AccountID: action.UserID, Amount: delta},
+			models.Posting{AccountID: counterpartID, Amount: -delta},
+		)
+	})
+	if err != nil {
+		log.Printf("Error applying admin action %s by %s on %s: %v", action.Action, action.AdminID, action.UserID, err)
+		return err
+	}
+
+	action.ID = actionRef.ID
+	return nil
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AwardBadges atomically adds badges to a user and returns the ones they didn't hold yet
+func AwardBadges(ctx context.Context, userID string, badgeIDs []string) ([]string, error) {
+	userRef := Client.Collection("users").Doc(userID)
+
+	var awarded []string
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		awarded = nil
+
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+
+		for _, badgeID := range badgeIDs {
+			if !user.HasBadge(badgeID) {
+				awarded = append(awarded, badgeID)
+			}
+		}
+		if len(awarded) == 0 {
+			return nil
+		}
+		return tx.Update(userRef, []firestore.Update{
+			{Path: "badges", Value: append(user.Badges, awarded...)},
+		})
+	})
+	if err != nil {
+		log.Printf("Error awarding badges %v to %s: %v", badgeIDs, userID, err)
+		return nil, err
+	}
+
+	return awarded, nil
+}
+
+// IncrementWeeklyPodiums atomically counts one more weekly podium for each user, once per week
+// The week, such as 2026-W42, is recorded in the digests collection, so retrying the digest of a
+// week that was already counted changes nothing and returns false
+func IncrementWeeklyPodiums(ctx context.Context, week string, userIDs []string) (bool, error) {
+	markerRef := Client.Collection("digests").Doc(week)
+
+	counted := false
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		counted = false
+
+		if _, err := tx.Get(markerRef); err == nil {
+			return nil
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		for _, userID := range userIDs {
+			if err := tx.Update(Client.Collection("users").Doc(userID), []firestore.Update{
+				{Path: "weekly_podiums", Value: firestore.Increment(1)},
+			}); err != nil {
+				return err
+			}
+		}
+		counted = true
+		return tx.Create(markerRef, map[string]interface{}{
+			"podium":     userIDs,
+			"created_at": time.Now(),
+		})
+	})
+	if err != nil {
+		log.Printf("Error counting weekly podiums of %s: %v", week, err)
+		return false, err
+	}
+
+	return counted, nil
+}
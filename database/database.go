@@ -3,12 +3,15 @@ package database
 import (
 	"context"
 	"log"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/unacorbatanegra/corbacoin-bot/config"
 	"github.com/unacorbatanegra/corbacoin-bot/models"
 	"github.com/unacorbatanegra/corbacoin-bot/slack"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -36,14 +39,14 @@ func GetUser(ctx context.Context, userID, username string) (*models.User, error)
 			}
 		}
 
-		// Create new user
+		// Create new user, with initial coins issued by the treasury
 		user := &models.User{
-			UserID:   userID,
-			Username: actualUsername,
-			Coins:    config.InitialCoins,
+			UserID:    userID,
+			Username:  actualUsername,
+			Coins:     GetSettings(ctx).InitialCoins,
+			CreatedAt: time.Now(),
 		}
-		_, err = userRef.Set(ctx, user)
-		if err != nil {
+		if err := createWallet(ctx, user); err != nil {
 			log.Printf("Error creating user %s (%s): %v", actualUsername, userID, err)
 			return user, nil
 		}
@@ -54,55 +57,68 @@ func GetUser(ctx context.Context, userID, username string) (*models.User, error)
 	var user models.User
 	if err := doc.DataTo(&user); err != nil {
 		log.Printf("Error parsing user data for %s (%s): %v", username, userID, err)
-		return &models.User{UserID: userID, Username: username, Coins: config.InitialCoins}, nil
+		return &models.User{UserID: userID, Username: username, Coins: GetSettings(ctx).InitialCoins}, nil
 	}
 
 	return &user, nil
 }
 
-// UpdateCoins updates a user's coin balance by adding the specified amount
-func UpdateCoins(ctx context.Context, userID string, amount int) (int, error) {
-	userRef := Client.Collection("users").Doc(userID)
-	doc, err := userRef.Get(ctx)
-	if err != nil {
-		log.Printf("Error getting user %s: %v", userID, err)
-		return 0, err
+// CreateWallet creates the wallet of a Slack user who just joined the workspace from their full profile
+// It returns false, and leaves the wallet alone, when the user already has one
+func CreateWallet(ctx context.Context, info *models.SlackUserInfo) (*models.User, bool, error) {
+	user := &models.User{
+		UserID:    info.ID,
+		Username:  info.Name,
+		Coins:     GetSettings(ctx).InitialCoins,
+		TimeZone:  info.TZ,
+		CreatedAt: time.Now(),
 	}
-
-	var user models.User
-	if err := doc.DataTo(&user); err != nil {
-		log.Printf("Error parsing user data for %s: %v", userID, err)
-		return 0, err
+	err := createWallet(ctx, user)
+	if status.Code(err) == codes.AlreadyExists {
+		return nil, false, nil
 	}
-
-	newAmount := user.Coins + amount
-	_, err = userRef.Update(ctx, []firestore.Update{
-		{Path: "coins", Value: newAmount},
-	})
-
 	if err != nil {
-		log.Printf("Error updating coins for %s: %v", userID, err)
-		return 0, err
+		log.Printf("Error creating wallet of %s (%s): %v", info.Name, info.ID, err)
+		return nil, false, err
 	}
 
-	return newAmount, nil
+	log.Printf("Wallet created on join: %s (%s)", info.Name, info.ID)
+	return user, true, nil
+}
+
+// createWallet creates a user's wallet with its initial coins issued by the treasury
+// It fails with codes.AlreadyExists when the user already has a wallet
+func createWallet(ctx context.Context, user *models.User) error {
+	userRef := Client.Collection("users").Doc(user.UserID)
+	return Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(userRef, user); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.TreasuryAccountID, -user.Coins); err != nil {
+			return err
+		}
+		return postEntry(tx, models.LedgerEntryIssue, user.UserID,
+			models.Posting{AccountID: user.UserID, Amount: user.Coins},
+			models.Posting{AccountID: config.TreasuryAccountID, Amount: -user.Coins},
+		)
+	})
 }
 
-// GetLeaderboard retrieves the top users by coin balance
+// GetLeaderboard retrieves the top users by coin balance, excluding frozen and system wallets
 func GetLeaderboard(ctx context.Context, limit int) ([]models.User, error) {
 	if limit <= 0 {
-		limit = config.LeaderboardLimit
+		limit = GetSettings(ctx).LeaderboardLimit
 	}
 
+	// Frozen and system wallets are skipped, so keep reading until enough users were found
 	query := Client.Collection("users").
-		OrderBy("coins", firestore.Desc).
-		Limit(limit)
+		OrderBy("coins", firestore.Desc)
 
 	iter := query.Documents(ctx)
 	defer iter.Stop()
 
 	var users []models.User
-	for {
+	for len(users) < limit {
 		doc, err := iter.Next()
 		if err == iterator.Done {
 			break
@@ -117,9 +133,68 @@ func GetLeaderboard(ctx context.Context, limit int) ([]models.User, error) {
 			log.Printf("Error parsing user data: %v", err)
 			continue
 		}
+		if user.IsFrozen() || user.System {
+			continue
+		}
 		users = append(users, user)
 	}
 
 	return users, nil
 }
 
+// GetUsersCreatedSince retrieves the users whose wallet was created after the given time
+func GetUsersCreatedSince(ctx context.Context, since time.Time) ([]models.User, error) {
+	iter := Client.Collection("users").
+		Where("created_at", ">=", since).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var users []models.User
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating new users: %v", err)
+			return users, err
+		}
+
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			log.Printf("Error parsing user data: %v", err)
+			continue
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// GetAllUsers retrieves every wallet
+func GetAllUsers(ctx context.Context) ([]models.User, error) {
+	iter := Client.Collection("users").Documents(ctx)
+	defer iter.Stop()
+
+	var users []models.User
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating users: %v", err)
+			return users, err
+		}
+
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			log.Printf("Error parsing user data: %v", err)
+			continue
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+// ApplyDemurrage atomically moves the decayed part of each user's balance to the treasury
+// decay returns the amount to take from a user given their current wallet, or 0 to skip them
+// A demurrage entry is recorded in the transfer history for every affected user
+func ApplyDemurrage(ctx context.Context, userIDs []string, treasuryID string, decay func(models.User) int) ([]models.Transfer, error) {
+	refs := make([]*firestore.DocumentRef, 0, len(userIDs))
+	for _, userID := range userIDs {
+		refs = append(refs, Client.Collection("users").Doc(userID))
+	}
+
+	var entries []models.Transfer
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		entries = nil
+
+		docs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		collected := 0
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+
+			var user models.User
+			if err := doc.DataTo(&user); err != nil {
+				return err
+			}
+
+			amount := decay(user)
+			if amount <= 0 {
+				continue
+			}
+
+			if err := tx.Update(doc.Ref, []firestore.Update{
+				{Path: "coins", Value: user.Coins - amount},
+				{Path: "last_demurrage_at", Value: now},
+			}); err != nil {
+				return err
+			}
+
+			entry := models.Transfer{
+				Type:        models.TransferTypeDemurrage,
+				SenderID:    user.UserID,
+				RecipientID: treasuryID,
+				Amount:      amount,
+				CreatedAt:   now,
+			}
+			entryRef := Client.Collection("transfers").NewDoc()
+			if err := tx.Create(entryRef, &entry); err != nil {
+				return err
+			}
+			entry.ID = entryRef.ID
+			if err := postTransfer(tx, models.TransferTypeDemurrage, entry.ID, user.UserID, treasuryID, amount); err != nil {
+				return err
+			}
+
+			collected += amount
+			entries = append(entries, entry)
+		}
+
+		if collected == 0 {
+			return nil
+		}
+		return adjustSystemAccount(tx, treasuryID, collected)
+	})
+	if err != nil {
+		log.Printf("Error applying demurrage to %d users: %v", len(userIDs), err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// MarkIdleSince records when demurrage first saw wallets without any recorded activity
+func MarkIdleSince(ctx context.Context, userIDs []string, at time.Time) error {
+	writer := Client.BulkWriter(ctx)
+
+	var jobs []*firestore.BulkWriterJob
+	for _, userID := range userIDs {
+		job, err := writer.Update(Client.Collection("users").Doc(userID), []firestore.Update{
+			{Path: "idle_since", Value: at},
+		})
+		if err != nil {
+			writer.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("Error marking wallets idle: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrUnbalancedEntry is returned when the postings of a ledger entry don't sum to zero
+	ErrUnbalancedEntry = errors.New("unbalanced ledger entry")
+
+	// ErrLedgerAlreadyOpened is returned when opening balances were already recorded
+	ErrLedgerAlreadyOpened = errors.New("ledger already opened")
+)
+
+// openingEntryID is the ID of the ledger entry recording the balances that predate the ledger
+const openingEntryID = "opening"
+
+// getSystemAccount reads a system wallet within a transaction
+// A wallet that doesn't exist yet is returned empty, and is created when its balance is first written
+func getSystemAccount(tx *firestore.Transaction, accountID string) (*models.User, error) {
+	doc, err := tx.Get(Client.Collection("users").Doc(accountID))
+	if status.Code(err) == codes.NotFound {
+		return &models.User{
+			UserID:    accountID,
+			Username:  accountID,
+			System:    true,
+			CreatedAt: time.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var account models.User
+	if err := doc.DataTo(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// adjustSystemAccount adds amount to a system wallet within a transaction, creating the wallet if needed
+// The wallet is incremented without being read, so transactions that only adjust the treasury or the
+// escrow don't contend on it
+func adjustSystemAccount(tx *firestore.Transaction, accountID string, amount int) error {
+	return tx.Set(Client.Collection("users").Doc(accountID), map[string]interface{}{
+		"user_id":   accountID,
+		"user_name": accountID,
+		"system":    true,
+		"coins":     firestore.Increment(amount),
+	}, firestore.MergeAll)
+}
+
+// postEntry records a ledger entry within a transaction, after the balances it describes were updated
+// Postings to the same account are merged and empty ones dropped, so nothing is recorded for a no-op
+func postEntry(tx *firestore.Transaction, entryType, reference string, postings ...models.Posting) error {
+	entry := models.LedgerEntry{
+		Type:      entryType,
+		Reference: reference,
+		CreatedAt: time.Now(),
+	}
+
+	totals := make(map[string]int)
+	for _, posting := range postings {
+		if _, ok := totals[posting.AccountID]; !ok {
+			entry.Postings = append(entry.Postings, models.Posting{AccountID: posting.AccountID})
+		}
+		totals[posting.AccountID] += posting.Amount
+	}
+
+	merged := entry.Postings[:0]
+	for _, posting := range entry.Postings {
+		if posting.Amount = totals[posting.AccountID]; posting.Amount != 0 {
+			merged = append(merged, posting)
+		}
+	}
+	entry.Postings = merged
+
+	if entry.Sum() != 0 {
+		return fmt.Errorf("%w: %s %s sums to %d", ErrUnbalancedEntry, entryType, reference, entry.Sum())
+	}
+	if len(entry.Postings) == 0 {
+		return nil
+	}
+	return tx.Create(Client.Collection("ledger").NewDoc(), &entry)
+}
+
+// openingClockSkew covers ledger entries whose created_at was taken before a page of the opening read
+// the ledger but that were committed after it
+const openingClockSkew = 5 * time.Minute
+
+// OpenLedger records the balances that predate the ledger as issued by the treasury
+// Wallets are opened in pages of config.WalletBatchSize, each recorded as its own opening entry, and the
+// opening entry marks the ledger as opened once every page is done. A wallet's opening balance is its
+// balance minus its postings, so running it again after a failure doesn't open a wallet twice
+// Afterwards the treasury's balance is minus the coins held by every other account
+// Postings already recorded are taken into account, so it is safe to run after the ledger went live
+func OpenLedger(ctx context.Context) (int, error) {
+	openingRef := Client.Collection("ledger").Doc(openingEntryID)
+	if _, err := openingRef.Get(ctx); status.Code(err) != codes.NotFound {
+		if err != nil {
+			log.Printf("Error opening ledger: %v", err)
+			return 0, err
+		}
+		return 0, ErrLedgerAlreadyOpened
+	}
+
+	// Entries recorded after this read are caught up within each page's transaction
+	readAt := time.Now()
+	posted, entries, err := sumPostings(Client.Collection("ledger").Documents(ctx))
+	if err != nil {
+		log.Printf("Error reading ledger: %v", err)
+		return 0, err
+	}
+	counted := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		counted[entry.ID] = true
+	}
+	since := readAt.Add(-openingClockSkew)
+
+	opened := 0
+	var after *firestore.DocumentSnapshot
+	for {
+		query := Client.Collection("users").OrderBy(firestore.DocumentID, firestore.Asc).Limit(config.WalletBatchSize)
+		if after != nil {
+			query = query.StartAfter(after)
+		}
+		page, err := query.Documents(ctx).GetAll()
+		if err != nil {
+			log.Printf("Error listing wallets to open the ledger: %v", err)
+			return opened, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		after = page[len(page)-1]
+
+		refs := make([]*firestore.DocumentRef, 0, len(page))
+		for _, doc := range page {
+			if doc.Ref.ID != config.TreasuryAccountID {
+				refs = append(refs, doc.Ref)
+			}
+		}
+		count, err := openPage(ctx, refs, posted, counted, since)
+		if err != nil {
+			log.Printf("Error opening the ledger for %d wallets: %v", len(refs), err)
+			return opened, err
+		}
+		opened += count
+	}
+
+	err = Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		treasury, err := getSystemAccount(tx, config.TreasuryAccountID)
+		if err != nil {
+			return err
+		}
+		treasuryPosted, err := catchUpPostings(tx, posted, counted, since)
+		if err != nil {
+			return err
+		}
+
+		// Coins the treasury held before the ledger, such as demurrage, were never issued to anyone
+		treasury.Coins = treasuryPosted[config.TreasuryAccountID]
+		if err := tx.Set(Client.Collection("users").Doc(config.TreasuryAccountID), treasury); err != nil {
+			return err
+		}
+		return tx.Create(openingRef, &models.LedgerEntry{
+			Type:      models.LedgerEntryOpening,
+			CreatedAt: time.Now(),
+		})
+	})
+	if err != nil {
+		log.Printf("Error opening ledger: %v", err)
+		return opened, err
+	}
+
+	return opened, nil
+}
+
+// openPage records the opening balances of a page of wallets against the treasury in one transaction
+// It returns how many wallets got an opening posting
+func openPage(ctx context.Context, refs []*firestore.DocumentRef, posted map[string]int, counted map[string]bool, since time.Time) (int, error) {
+	opened := 0
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		opened = 0
+
+		docs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+		pagePosted, err := catchUpPostings(tx, posted, counted, since)
+		if err != nil {
+			return err
+		}
+
+		var postings []models.Posting
+		issued := 0
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+			var user models.User
+			if err := doc.DataTo(&user); err != nil {
+				return err
+			}
+			if opening := user.Coins - pagePosted[doc.Ref.ID]; opening != 0 {
+				postings = append(postings, models.Posting{AccountID: doc.Ref.ID, Amount: opening})
+				issued += opening
+			}
+		}
+		if len(postings) == 0 {
+			return nil
+		}
+		opened = len(postings)
+
+		if err := adjustSystemAccount(tx, config.TreasuryAccountID, -issued); err != nil {
+			return err
+		}
+		postings = append(postings, models.Posting{AccountID: config.TreasuryAccountID, Amount: -issued})
+		return postEntry(tx, models.LedgerEntryOpening, "", postings...)
+	})
+	return opened, err
+}
+
+// catchUpPostings adds the postings of the entries recorded since the ledger was read to posted
+// The totals are returned as a copy, so a transaction that is retried starts over from posted
+func catchUpPostings(tx *firestore.Transaction, posted map[string]int, counted map[string]bool, since time.Time) (map[string]int, error) {
+	_, entries, err := sumPostings(tx.Documents(Client.Collection("ledger").Where("created_at", ">=", since)))
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int, len(posted))
+	for accountID, amount := range posted {
+		totals[accountID] = amount
+	}
+	for _, entry := range entries {
+		if counted[entry.ID] {
+			continue
+		}
+		for _, posting := range entry.Postings {
+			totals[posting.AccountID] += posting.Amount
+		}
+	}
+	return totals, nil
+}
+
+// CheckLedger verifies that every entry is balanced and every wallet's balance equals the sum of its postings
+// The check reads the whole ledger without a transaction, so transfers made meanwhile can cause false mismatches
+func CheckLedger(ctx context.Context) (*models.LedgerReport, error) {
+	report := &models.LedgerReport{CheckedAt: time.Now()}
+
+	posted, entries, err := sumPostings(Client.Collection("ledger").Documents(ctx))
+	if err != nil {
+		log.Printf("Error reading ledger: %v", err)
+		return nil, err
+	}
+
+	users, err := GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		report.Entries++
+		if entry.ID == openingEntryID {
+			report.Opened = true
+		}
+		if entry.Sum() != 0 {
+			report.Unbalanced = append(report.Unbalanced, entry.ID)
+		}
+	}
+
+	for _, user := range users {
+		if !user.System {
+			report.TotalSupply += user.Coins
+		}
+		if user.Coins != posted[user.UserID] {
+			report.Mismatches = append(report.Mismatches, models.LedgerMismatch{
+				AccountID: user.UserID,
+				Balance:   user.Coins,
+				Posted:    posted[user.UserID],
+			})
+		}
+		delete(posted, user.UserID)
+	}
+
+	// Postings to accounts that have no wallet at all
+	for accountID, amount := range posted {
+		if amount != 0 {
+			report.Mismatches = append(report.Mismatches, models.LedgerMismatch{AccountID: accountID, Posted: amount})
+		}
+	}
+
+	return report, nil
+}
+
+// sumPostings reads ledger entries and totals their postings by account
+func sumPostings(iter *firestore.DocumentIterator) (map[string]int, []models.LedgerEntry, error) {
+	defer iter.Stop()
+
+	totals := make(map[string]int)
+	var entries []models.LedgerEntry
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var entry models.LedgerEntry
+		if err := doc.DataTo(&entry); err != nil {
+			return nil, nil, err
+		}
+		entry.ID = doc.Ref.ID
+		for _, posting := range entry.Postings {
+			totals[posting.AccountID] += posting.Amount
+		}
+		entries = append(entries, entry)
+	}
+	return totals, entries, nil
+}
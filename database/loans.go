@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrLoanNotFound is returned when a loan doesn't exist or doesn't involve the user
+	ErrLoanNotFound = errors.New("loan not found")
+
+	// ErrLoanHandled is returned when accepting or declining a loan offer that was already answered
+	ErrLoanHandled = errors.New("loan offer already answered")
+
+	// ErrLoanExpired is returned when accepting a loan offer whose due date already passed
+	ErrLoanExpired = errors.New("loan offer expired")
+
+	// ErrLoanClosed is returned when repaying a loan that is not open
+	ErrLoanClosed = errors.New("loan not open")
+)
+
+// CreateLoan records a loan offer and returns its ID
+func CreateLoan(ctx context.Context, loan *models.Loan) (string, error) {
+	loan.WorkspaceID = config.WorkspaceFromContext(ctx)
+	id, err := createWithShortID(ctx, "loans", loan)
+	if err != nil {
+		log.Printf("Error creating loan from %s to %s: %v", loan.LenderID, loan.BorrowerID, err)
+		return "", err
+	}
+
+	loan.ID = id
+	return id, nil
+}
+
+// GetLoan retrieves a loan of the workspace carried by the context
+func GetLoan(ctx context.Context, id string) (*models.Loan, error) {
+	doc, err := Client.Collection("loans").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrLoanNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting loan %s: %v", id, err)
+		return nil, err
+	}
+
+	var loan models.Loan
+	if err := doc.DataTo(&loan); err != nil {
+		log.Printf("Error parsing loan %s: %v", id, err)
+		return nil, err
+	}
+	if loan.WorkspaceID != config.WorkspaceFromContext(ctx) {
+		return nil, ErrLoanNotFound
+	}
+	loan.ID = doc.Ref.ID
+	return &loan, nil
+}
+
+// AcceptLoan atomically activates a loan offer and moves its principal from the lender to the borrower
+// The principal is also recorded as a transfer for the transfer limits
+func AcceptLoan(ctx context.Context, loanID, borrowerID string) (*models.Loan, error) {
+	loanRef := Client.Collection("loans").Doc(loanID)
+	transferRef := Client.Collection("transfers").NewDoc()
+
+	var loan models.Loan
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := readLoan(tx, loanRef, &loan); err != nil {
+			return err
+		}
+		if loan.BorrowerID != borrowerID {
+			return ErrLoanNotFound
+		}
+		if loan.Status != models.LoanStatusOffered {
+			return ErrLoanHandled
+		}
+		now := time.Now()
+		if now.After(loan.DueAt) {
+			return ErrLoanExpired
+		}
+
+		lenderRef := Client.Collection("users").Doc(loan.LenderID)
+		borrowerRef := Client.Collection("users").Doc(loan.BorrowerID)
+		if err := moveCoins(tx, lenderRef, borrowerRef, loan.Principal); err != nil {
+			return err
+		}
+
+		loan.Status = models.LoanStatusActive
+		loan.AcceptedAt = now
+		if err := tx.Set(loanRef, &loan); err != nil {
+			return err
+		}
+		if err := createLoanTransfer(tx, transferRef, models.TransferTypeLoan, loanID, loan.LenderID, loan.BorrowerID, loan.Principal, now); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryLoan, loanID, loan.LenderID, loan.BorrowerID, loan.Principal)
+	})
+	if err != nil {
+		log.Printf("Error accepting loan %s: %v", loanID, err)
+		return nil, err
+	}
+
+	loan.ID = loanID
+	return &loan, nil
+}
+
+// DeclineLoan marks a loan offer as declined by its borrower
+func DeclineLoan(ctx context.Context, loanID, borrowerID string) (*models.Loan, error) {
+	loanRef := Client.Collection("loans").Doc(loanID)
+
+	var loan models.Loan
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := readLoan(tx, loanRef, &loan); err != nil {
+			return err
+		}
+		if loan.BorrowerID != borrowerID {
+			return ErrLoanNotFound
+		}
+		if loan.Status != models.LoanStatusOffered {
+			return ErrLoanHandled
+		}
+
+		loan.Status = models.LoanStatusDeclined
+		loan.ClosedAt = time.Now()
+		return tx.Set(loanRef, &loan)
+	})
+	if err != nil {
+		log.Printf("Error declining loan %s: %v", loanID, err)
+		return nil, err
+	}
+
+	loan.ID = loanID
+	return &loan, nil
+}
+
+// RepayLoan atomically moves up to amount coins from the borrower to the lender and returns the coins
+// actually repaid, which never exceed what is outstanding
+// The loan is closed once it is repaid in full, even after it defaulted. The repayment is also
+// recorded as a transfer for the transfer limits
+func RepayLoan(ctx context.Context, loanID, borrowerID string, amount int) (*models.Loan, int, error) {
+	loanRef := Client.Collection("loans").Doc(loanID)
+	transferRef := Client.Collection("transfers").NewDoc()
+
+	var loan models.Loan
+	var repaid int
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := readLoan(tx, loanRef, &loan); err != nil {
+			return err
+		}
+		if loan.BorrowerID != borrowerID {
+			return ErrLoanNotFound
+		}
+		if !loan.IsOpen() {
+			return ErrLoanClosed
+		}
+
+		repaid = min(amount, loan.Outstanding())
+		borrowerRef := Client.Collection("users").Doc(loan.BorrowerID)
+		lenderRef := Client.Collection("users").Doc(loan.LenderID)
+		if err := moveCoins(tx, borrowerRef, lenderRef, repaid); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		loan.Repaid += repaid
+		if loan.Outstanding() == 0 {
+			loan.Status = models.LoanStatusRepaid
+			loan.ClosedAt = now
+		}
+		if err := tx.Set(loanRef, &loan); err != nil {
+			return err
+		}
+		if err := createLoanTransfer(tx, transferRef, models.TransferTypeRepayment, loanID, loan.BorrowerID, loan.LenderID, repaid, now); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryRepayment, loanID, loan.BorrowerID, loan.LenderID, repaid)
+	})
+	if err != nil {
+		log.Printf("Error repaying %d of loan %s: %v", amount, loanID, err)
+		return nil, 0, err
+	}
+
+	loan.ID = loanID
+	return &loan, repaid, nil
+}
+
+// GetLoansOf retrieves the loans of the workspace carried by the context where the user is the lender
+// or the borrower, soonest due first
+func GetLoansOf(ctx context.Context, userID string) ([]models.Loan, error) {
+	workspaceID := config.WorkspaceFromContext(ctx)
+
+	var loans []models.Loan
+	for _, field := range []string{"lender_id", "borrower_id"} {
+		found, err := readLoans(Client.Collection("loans").Where(field, "==", userID).Documents(ctx))
+		if err != nil {
+			log.Printf("Error iterating loans of %s: %v", userID, err)
+			return loans, err
+		}
+		for _, loan := range found {
+			if loan.WorkspaceID == workspaceID {
+				loans = append(loans, loan)
+			}
+		}
+	}
+
+	sort.Slice(loans, func(i, j int) bool { return loans[i].DueAt.Before(loans[j].DueAt) })
+	return loans, nil
+}
+
+// GetActiveLoans retrieves the accepted loans of every workspace that are not repaid nor defaulted
+func GetActiveLoans(ctx context.Context) ([]models.Loan, error) {
+	loans, err := readLoans(Client.Collection("loans").Where("status", "==", models.LoanStatusActive).Documents(ctx))
+	if err != nil {
+		log.Printf("Error iterating active loans: %v", err)
+	}
+	return loans, err
+}
+
+// MarkLoanReminded records that the borrower was reminded of the due date
+func MarkLoanReminded(ctx context.Context, loanID string) error {
+	_, err := Client.Collection("loans").Doc(loanID).Update(ctx, []firestore.Update{
+		{Path: "reminded_at", Value: time.Now()},
+	})
+	if err != nil {
+		log.Printf("Error marking loan %s as reminded: %v", loanID, err)
+	}
+	return err
+}
+
+// MarkLoanDefaulted flags an active loan that passed its due date with coins outstanding
+// A loan repaid in the meantime is left as is, and false is returned
+func MarkLoanDefaulted(ctx context.Context, loanID string) (bool, error) {
+	loanRef := Client.Collection("loans").Doc(loanID)
+
+	defaulted := false
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		defaulted = false
+
+		var loan models.Loan
+		if err := readLoan(tx, loanRef, &loan); err != nil {
+			return err
+		}
+		if loan.Status != models.LoanStatusActive || loan.Outstanding() == 0 {
+			return nil
+		}
+
+		defaulted = true
+		return tx.Update(loanRef, []firestore.Update{{Path: "status", Value: models.LoanStatusDefaulted}})
+	})
+	if err != nil {
+		log.Printf("Error marking loan %s as defaulted: %v", loanID, err)
+		return false, err
+	}
+
+	return defaulted, nil
+}
+
+// createLoanTransfer records coins moved by a loan in the transfers collection, with the loan ID as memo
+func createLoanTransfer(tx *firestore.Transaction, ref *firestore.DocumentRef, transferType, loanID, senderID, recipientID string, amount int, now time.Time) error {
+	return tx.Create(ref, &models.Transfer{
+		Type:        transferType,
+		SenderID:    senderID,
+		RecipientID: recipientID,
+		Amount:      amount,
+		Memo:        loanID,
+		CreatedAt:   now,
+	})
+}
+
+// readLoan reads a loan within a transaction
+func readLoan(tx *firestore.Transaction, loanRef *firestore.DocumentRef, loan *models.Loan) error {
+	doc, err := tx.Get(loanRef)
+	if status.Code(err) == codes.NotFound {
+		return ErrLoanNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return doc.DataTo(loan)
+}
+
+// readLoans reads every loan returned by iter
+func readLoans(iter *firestore.DocumentIterator) ([]models.Loan, error) {
+	defer iter.Stop()
+
+	var loans []models.Loan
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return loans, err
+		}
+
+		var loan models.Loan
+		if err := doc.DataTo(&loan); err != nil {
+			log.Printf("Error parsing loan %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		loan.ID = doc.Ref.ID
+		loans = append(loans, loan)
+	}
+	return loans, nil
+}
@@ -0,0 +1,391 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrMarketNotFound is returned when a prediction market doesn't exist
+	ErrMarketNotFound = errors.New("market not found")
+
+	// ErrMarketClosed is returned when staking on a market that no longer accepts stakes
+	ErrMarketClosed = errors.New("market closed")
+
+	// ErrMarketSettled is returned when resolving or cancelling a market that was already settled
+	ErrMarketSettled = errors.New("market already settled")
+
+	// ErrMarketNotClosed is returned when a creator resolves a market before it closes
+	ErrMarketNotClosed = errors.New("market not closed yet")
+
+	// ErrResolverStaked is returned when a creator who staked on a market tries to resolve it
+	ErrResolverStaked = errors.New("resolver has a stake in the market")
+)
+
+// shortIDAlphabet is the set of characters of the short IDs users type in commands
+const shortIDAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// shortIDLength is the number of characters of a short ID
+const shortIDLength = 5
+
+// newShortID returns a random, easy to type ID
+func newShortID() string {
+	id := make([]byte, shortIDLength)
+	rand.Read(id)
+	for i := range id {
+		id[i] = shortIDAlphabet[int(id[i])%len(shortIDAlphabet)]
+	}
+	return string(id)
+}
+
+// createWithShortID creates a document with a new short ID in the collection, retrying on collisions
+func createWithShortID(ctx context.Context, collection string, data interface{}) (string, error) {
+	var err error
+	for range 3 {
+		ref := Client.Collection(collection).Doc(newShortID())
+		if _, err = ref.Create(ctx, data); status.Code(err) != codes.AlreadyExists {
+			if err != nil {
+				return "", err
+			}
+			return ref.ID, nil
+		}
+	}
+	return "", err
+}
+
+// CreateMarket opens a prediction market and returns its ID
+func CreateMarket(ctx context.Context, market *models.Market) (string, error) {
+	market.WorkspaceID = config.WorkspaceFromContext(ctx)
+	id, err := createWithShortID(ctx, "markets", market)
+	if err != nil {
+		log.Printf("Error creating market %q: %v", market.Question, err)
+		return "", err
+	}
+
+	market.ID = id
+	return id, nil
+}
+
+// GetMarket retrieves a prediction market of the workspace carried by the context
+func GetMarket(ctx context.Context, id string) (*models.Market, error) {
+	doc, err := Client.Collection("markets").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrMarketNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting market %s: %v", id, err)
+		return nil, err
+	}
+
+	var market models.Market
+	if err := doc.DataTo(&market); err != nil {
+		log.Printf("Error parsing market %s: %v", id, err)
+		return nil, err
+	}
+	if market.WorkspaceID != config.WorkspaceFromContext(ctx) {
+		return nil, ErrMarketNotFound
+	}
+	market.ID = doc.Ref.ID
+	return &market, nil
+}
+
+// GetOpenMarkets retrieves the unsettled prediction markets of the workspace carried by the context, newest first
+func GetOpenMarkets(ctx context.Context) ([]models.Market, error) {
+	iter := Client.Collection("markets").
+		Where("workspace_id", "==", config.WorkspaceFromContext(ctx)).
+		Where("status", "==", models.MarketStatusOpen).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var markets []models.Market
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating markets: %v", err)
+			return markets, err
+		}
+
+		var market models.Market
+		if err := doc.DataTo(&market); err != nil {
+			log.Printf("Error parsing market %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		market.ID = doc.Ref.ID
+		markets = append(markets, market)
+	}
+
+	sort.Slice(markets, func(i, j int) bool { return markets[i].CreatedAt.After(markets[j].CreatedAt) })
+	return markets, nil
+}
+
+// PlaceStake atomically moves a user's stake on an option of a market into escrow
+func PlaceStake(ctx context.Context, marketID, userID string, option, amount int) (*models.Market, error) {
+	marketRef := Client.Collection("markets").Doc(marketID)
+	userRef := Client.Collection("users").Doc(userID)
+	stakeRef := marketRef.Collection("stakes").NewDoc()
+
+	var market models.Market
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(marketRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrMarketNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&market); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if market.IsClosed(now) {
+			return ErrMarketClosed
+		}
+		if option < 0 || option >= len(market.Pools) {
+			return fmt.Errorf("market %s has no option %d", marketID, option)
+		}
+
+		userDoc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := userDoc.DataTo(&user); err != nil {
+			return err
+		}
+		if user.IsFrozen() {
+			return ErrSenderFrozen
+		}
+		if user.Coins < amount {
+			return ErrInsufficientFunds
+		}
+
+		market.Pools[option] += amount
+		if err := tx.Update(marketRef, []firestore.Update{{Path: "pools", Value: market.Pools}}); err != nil {
+			return err
+		}
+		if err := tx.Update(userRef, []firestore.Update{{Path: "coins", Value: user.Coins - amount}}); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.EscrowAccountID, amount); err != nil {
+			return err
+		}
+		if err := tx.Create(stakeRef, &models.Stake{
+			UserID:    userID,
+			Option:    option,
+			Amount:    amount,
+			CreatedAt: now,
+		}); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryStake, marketID, userID, config.EscrowAccountID, amount)
+	})
+	if err != nil {
+		log.Printf("Error staking %d on option %d of market %s for %s: %v", amount, option, marketID, userID, err)
+		return nil, err
+	}
+
+	market.ID = marketID
+	return &market, nil
+}
+
+// ResolveMarket atomically pays the pot of a market out of escrow to the stakers of the winning option
+// Winners share the pot pro-rata to their stake, rounded down, and the remainder goes to the treasury
+// When nobody backed the winning option, every stake is refunded instead
+// Unless admin is set, the market must be closed and the handler must not have a stake in it
+// It returns the coins paid to each user
+func ResolveMarket(ctx context.Context, marketID, handlerID string, winningOption int, admin bool) (*models.Market, map[string]int, error) {
+	return settleMarket(ctx, marketID, handlerID, winningOption, admin)
+}
+
+// CancelMarket atomically refunds every stake of a market out of escrow
+// It returns the coins refunded to each user
+func CancelMarket(ctx context.Context, marketID, handlerID string) (*models.Market, map[string]int, error) {
+	return settleMarket(ctx, marketID, handlerID, -1, true)
+}
+
+// settleMarket resolves a market on winningOption, or cancels it when winningOption is negative
+func settleMarket(ctx context.Context, marketID, handlerID string, winningOption int, admin bool) (*models.Market, map[string]int, error) {
+	marketRef := Client.Collection("markets").Doc(marketID)
+
+	var market models.Market
+	var payouts map[string]int
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(marketRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrMarketNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&market); err != nil {
+			return err
+		}
+		if market.Status != models.MarketStatusOpen {
+			return ErrMarketSettled
+		}
+		if winningOption >= len(market.Pools) {
+			return fmt.Errorf("market %s has no option %d", marketID, winningOption)
+		}
+
+		stakes, err := readStakes(tx.Documents(marketRef.Collection("stakes")))
+		if err != nil {
+			return err
+		}
+		if winningOption >= 0 && !admin {
+			if err := checkResolver(&market, stakes, handlerID, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		entryType := models.LedgerEntryPayout
+		market.Status = models.MarketStatusResolved
+		if winningOption < 0 || market.Pools[winningOption] == 0 {
+			entryType = models.LedgerEntryStakeRefund
+		}
+		if winningOption < 0 {
+			market.Status = models.MarketStatusCancelled
+		}
+		payouts = parimutuelPayouts(stakes, winningOption, market.Total())
+
+		// Read every paid wallet and the system accounts before writing
+		refs := make([]*firestore.DocumentRef, 0, len(payouts))
+		for userID := range payouts {
+			refs = append(refs, Client.Collection("users").Doc(userID))
+		}
+		userDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		for _, userDoc := range userDocs {
+			var user models.User
+			if err := userDoc.DataTo(&user); err != nil {
+				return err
+			}
+			if err := tx.Update(userDoc.Ref, []firestore.Update{{Path: "coins", Value: user.Coins + payouts[userDoc.Ref.ID]}}); err != nil {
+				return err
+			}
+		}
+
+		postings := settlementPostings(market.Total(), payouts)
+		for _, posting := range postings {
+			if posting.AccountID != config.EscrowAccountID && posting.AccountID != config.TreasuryAccountID {
+				continue
+			}
+			if err := adjustSystemAccount(tx, posting.AccountID, posting.Amount); err != nil {
+				return err
+			}
+		}
+
+		market.WinningOption = winningOption
+		market.SettledBy = handlerID
+		market.SettledAt = time.Now()
+		if err := tx.Set(marketRef, &market); err != nil {
+			return err
+		}
+		return postEntry(tx, entryType, marketID, postings...)
+	})
+	if err != nil {
+		log.Printf("Error settling market %s: %v", marketID, err)
+		return nil, nil, err
+	}
+
+	market.ID = marketID
+	return &market, payouts, nil
+}
+
+// checkResolver verifies that a creator may resolve a market: it must be closed, so nobody can still
+// stake on the outcome, and the creator must not stand to win from the answer they pick
+func checkResolver(market *models.Market, stakes []models.Stake, handlerID string, now time.Time) error {
+	if !market.ClosesAt.IsZero() && !now.After(market.ClosesAt) {
+		return ErrMarketNotClosed
+	}
+	for _, stake := range stakes {
+		if stake.UserID == handlerID {
+			return ErrResolverStaked
+		}
+	}
+	return nil
+}
+
+// settlementPostings returns the postings that empty a market's escrow into the payouts, with whatever
+// rounding leaves over going to the treasury
+func settlementPostings(total int, payouts map[string]int) []models.Posting {
+	userIDs := make([]string, 0, len(payouts))
+	for userID := range payouts {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+
+	postings := []models.Posting{{AccountID: config.EscrowAccountID, Amount: -total}}
+	paid := 0
+	for _, userID := range userIDs {
+		postings = append(postings, models.Posting{AccountID: userID, Amount: payouts[userID]})
+		paid += payouts[userID]
+	}
+	if remainder := total - paid; remainder != 0 {
+		postings = append(postings, models.Posting{AccountID: config.TreasuryAccountID, Amount: remainder})
+	}
+	return postings
+}
+
+// parimutuelPayouts splits the pot between the stakers of the winning option, pro-rata to their stake
+// Every stake is refunded when winningOption is negative or nobody backed it
+func parimutuelPayouts(stakes []models.Stake, winningOption, total int) map[string]int {
+	winningPool := 0
+	for _, stake := range stakes {
+		if stake.Option == winningOption {
+			winningPool += stake.Amount
+		}
+	}
+
+	payouts := make(map[string]int)
+	for _, stake := range stakes {
+		switch {
+		case winningOption < 0 || winningPool == 0:
+			payouts[stake.UserID] += stake.Amount
+		case stake.Option == winningOption:
+			payouts[stake.UserID] += stake.Amount * total / winningPool
+		}
+	}
+	return payouts
+}
+
+// readStakes reads every stake returned by iter
+func readStakes(iter *firestore.DocumentIterator) ([]models.Stake, error) {
+	defer iter.Stop()
+
+	var stakes []models.Stake
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var stake models.Stake
+		if err := doc.DataTo(&stake); err != nil {
+			return nil, err
+		}
+		stakes = append(stakes, stake)
+	}
+	return stakes, nil
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+func TestParimutuelPayouts(t *testing.T) {
+	tests := []struct {
+		name          string
+		stakes        []models.Stake
+		winningOption int
+		total         int
+		want          map[string]int
+	}{
+		{
+			name: "winners share the pot pro-rata",
+			stakes: []models.Stake{
+				{UserID: "alice", Option: 0, Amount: 30},
+				{UserID: "bob", Option: 0, Amount: 10},
+				{UserID: "carol", Option: 1, Amount: 60},
+			},
+			winningOption: 0,
+			total:         100,
+			want:          map[string]int{"alice": 75, "bob": 25},
+		},
+		{
+			name: "shares are rounded down",
+			stakes: []models.Stake{
+				{UserID: "alice", Option: 1, Amount: 1},
+				{UserID: "bob", Option: 1, Amount: 2},
+				{UserID: "carol", Option: 0, Amount: 7},
+			},
+			winningOption: 1,
+			total:         10,
+			want:          map[string]int{"alice": 3, "bob": 6},
+		},
+		{
+			name: "stakes of the same user add up",
+			stakes: []models.Stake{
+				{UserID: "alice", Option: 0, Amount: 5},
+				{UserID: "alice", Option: 0, Amount: 5},
+				{UserID: "bob", Option: 1, Amount: 10},
+			},
+			winningOption: 0,
+			total:         20,
+			want:          map[string]int{"alice": 20},
+		},
+		{
+			name: "nobody backed the winning option",
+			stakes: []models.Stake{
+				{UserID: "alice", Option: 0, Amount: 5},
+				{UserID: "bob", Option: 1, Amount: 10},
+			},
+			winningOption: 2,
+			total:         15,
+			want:          map[string]int{"alice": 5, "bob": 10},
+		},
+		{
+			name: "cancelled market refunds every stake",
+			stakes: []models.Stake{
+				{UserID: "alice", Option: 0, Amount: 5},
+				{UserID: "bob", Option: 1, Amount: 10},
+			},
+			winningOption: -1,
+			total:         15,
+			want:          map[string]int{"alice": 5, "bob": 10},
+		},
+		{
+			name:          "no stakes",
+			winningOption: 0,
+			want:          map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parimutuelPayouts(tt.stakes, tt.winningOption, tt.total)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parimutuelPayouts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettlementPostings(t *testing.T) {
+	stakes := []models.Stake{
+		{UserID: "alice", Option: 0, Amount: 1},
+		{UserID: "bob", Option: 0, Amount: 2},
+		{UserID: "carol", Option: 1, Amount: 7},
+	}
+
+	tests := []struct {
+		name          string
+		winningOption int
+		want          map[string]int
+	}{
+		{
+			name:          "cancelled market refunds the whole escrow",
+			winningOption: -1,
+			want:          map[string]int{config.EscrowAccountID: -10, "alice": 1, "bob": 2, "carol": 7},
+		},
+		{
+			name:          "nobody backed the answer",
+			winningOption: 2,
+			want:          map[string]int{config.EscrowAccountID: -10, "alice": 1, "bob": 2, "carol": 7},
+		},
+		{
+			name:          "rounding leftovers go to the treasury",
+			winningOption: 0,
+			want:          map[string]int{config.EscrowAccountID: -10, "alice": 3, "bob": 6, config.TreasuryAccountID: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payouts := parimutuelPayouts(stakes, tt.winningOption, 10)
+			postings := settlementPostings(10, payouts)
+
+			got := make(map[string]int)
+			sum := 0
+			for _, posting := range postings {
+				got[posting.AccountID] += posting.Amount
+				sum += posting.Amount
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("settlementPostings() = %v, want %v", got, tt.want)
+			}
+			if sum != 0 {
+				t.Errorf("settlementPostings() sums to %d, want 0", sum)
+			}
+		})
+	}
+}
+
+func TestCheckResolver(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	stakes := []models.Stake{{UserID: "bob", Option: 0, Amount: 5}}
+
+	tests := []struct {
+		name     string
+		closesAt time.Time
+		resolver string
+		want     error
+	}{
+		{name: "closed market", closesAt: now.Add(-time.Minute), resolver: "alice"},
+		{name: "market without a closing time", resolver: "alice"},
+		{name: "market still open", closesAt: now.Add(time.Hour), resolver: "alice", want: ErrMarketNotClosed},
+		{name: "creator has a stake", closesAt: now.Add(-time.Minute), resolver: "bob", want: ErrResolverStaked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			market := &models.Market{CreatorID: tt.resolver, ClosesAt: tt.closesAt}
+			if err := checkResolver(market, stakes, tt.resolver, now); !errors.Is(err, tt.want) {
+				t.Errorf("checkResolver() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
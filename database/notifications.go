@@ -0,0 +1,85 @@
+package database
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+)
+
+// SetNotificationMode stores how a user wants to be notified about received transfers
+func SetNotificationMode(ctx context.Context, userID, mode string) error {
+	_, err := Client.Collection("users").Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "notification_mode", Value: mode},
+	})
+	if err != nil {
+		log.Printf("Error setting notification mode for %s: %v", userID, err)
+		return err
+	}
+	return nil
+}
+
+// QueueNotification stores a received transfer for the recipient's next daily summary
+func QueueNotification(ctx context.Context, notification *models.QueuedNotification) error {
+	if _, _, err := Client.Collection("notification_queue").Add(ctx, notification); err != nil {
+		log.Printf("Error queueing notification for %s: %v", notification.RecipientID, err)
+		return err
+	}
+	return nil
+}
+
+// GetQueuedNotifications retrieves all notifications waiting for a daily summary, oldest first
+func GetQueuedNotifications(ctx context.Context) ([]models.QueuedNotification, error) {
+	iter := Client.Collection("notification_queue").
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var notifications []models.QueuedNotification
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating notification queue: %v", err)
+			return notifications, err
+		}
+
+		var notification models.QueuedNotification
+		if err := doc.DataTo(&notification); err != nil {
+			log.Printf("Error parsing queued notification: %v", err)
+			continue
+		}
+		notification.ID = doc.Ref.ID
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, nil
+}
+
+// DeleteQueuedNotifications removes notifications that were included in a summary
+func DeleteQueuedNotifications(ctx context.Context, notifications []models.QueuedNotification) error {
+	writer := Client.BulkWriter(ctx)
+
+	var jobs []*firestore.BulkWriterJob
+	for _, notification := range notifications {
+		job, err := writer.Delete(Client.Collection("notification_queue").Doc(notification.ID))
+		if err != nil {
+			writer.End()
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	writer.End()
+
+	for _, job := range jobs {
+		if _, err := job.Results(); err != nil {
+			log.Printf("Error deleting queued notification: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrPayrollNotFound is returned when a payroll doesn't exist
+	ErrPayrollNotFound = errors.New("payroll not found")
+
+	// ErrPayrollRunNotFound is returned when a payroll has not run for a period yet
+	ErrPayrollRunNotFound = errors.New("payroll run not found")
+)
+
+// CreatePayroll saves a payroll definition and returns its ID
+func CreatePayroll(ctx context.Context, payroll *models.Payroll) (string, error) {
+	payroll.WorkspaceID = config.WorkspaceFromContext(ctx)
+	id, err := createWithShortID(ctx, "payrolls", payroll)
+	if err != nil {
+		log.Printf("Error creating payroll of %d: %v", payroll.Amount, err)
+		return "", err
+	}
+
+	payroll.ID = id
+	return id, nil
+}
+
+// GetPayroll retrieves a payroll of the workspace carried by the context
+func GetPayroll(ctx context.Context, id string) (*models.Payroll, error) {
+	doc, err := Client.Collection("payrolls").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrPayrollNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting payroll %s: %v", id, err)
+		return nil, err
+	}
+
+	var payroll models.Payroll
+	if err := doc.DataTo(&payroll); err != nil {
+		log.Printf("Error parsing payroll %s: %v", id, err)
+		return nil, err
+	}
+	if payroll.WorkspaceID != config.WorkspaceFromContext(ctx) {
+		return nil, ErrPayrollNotFound
+	}
+	payroll.ID = doc.Ref.ID
+	return &payroll, nil
+}
+
+// GetPayrolls retrieves the payroll definitions, oldest first
+// An empty workspaceID returns the payrolls of every workspace
+func GetPayrolls(ctx context.Context, workspaceID string) ([]models.Payroll, error) {
+	query := Client.Collection("payrolls").Query
+	if workspaceID != "" {
+		query = query.Where("workspace_id", "==", workspaceID)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var payrolls []models.Payroll
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating payrolls: %v", err)
+			return payrolls, err
+		}
+
+		var payroll models.Payroll
+		if err := doc.DataTo(&payroll); err != nil {
+			log.Printf("Error parsing payroll %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		payroll.ID = doc.Ref.ID
+		payrolls = append(payrolls, payroll)
+	}
+
+	sort.Slice(payrolls, func(i, j int) bool { return payrolls[i].CreatedAt.Before(payrolls[j].CreatedAt) })
+	return payrolls, nil
+}
+
+// DeletePayroll removes a payroll of the workspace carried by the context
+// Its past runs and grants are kept
+func DeletePayroll(ctx context.Context, id string) error {
+	if _, err := GetPayroll(ctx, id); err != nil {
+		return err
+	}
+
+	if _, err := Client.Collection("payrolls").Doc(id).Delete(ctx); err != nil {
+		log.Printf("Error deleting payroll %s: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetPayrollRun retrieves the report of a payroll's run for a period
+func GetPayrollRun(ctx context.Context, payrollID, period string) (*models.PayrollRun, error) {
+	doc, err := payrollRunRef(payrollID, period).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrPayrollRunNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting run of payroll %s for %s: %v", payrollID, period, err)
+		return nil, err
+	}
+
+	var run models.PayrollRun
+	if err := doc.DataTo(&run); err != nil {
+		log.Printf("Error parsing run of payroll %s for %s: %v", payrollID, period, err)
+		return nil, err
+	}
+	run.ID = doc.Ref.ID
+	return &run, nil
+}
+
+// SavePayrollRun adds the outcome of a payroll run to the report of its period
+// The members paid and coins minted by earlier runs of the period are kept, along with when the
+// first one started, and the run is updated to the merged report
+func SavePayrollRun(ctx context.Context, run *models.PayrollRun) error {
+	ref := payrollRunRef(run.PayrollID, run.Period)
+
+	var merged models.PayrollRun
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		merged = *run
+
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var previous models.PayrollRun
+			if err := doc.DataTo(&previous); err != nil {
+				return err
+			}
+			merged = mergePayrollRun(*run, previous)
+		}
+		return tx.Set(ref, &merged)
+	})
+	if err != nil {
+		log.Printf("Error saving run of payroll %s for %s: %v", run.PayrollID, run.Period, err)
+		return err
+	}
+
+	*run = merged
+	run.ID = ref.ID
+	return nil
+}
+
+// mergePayrollRun adds a run to the report previously saved for its period
+// Paid and Minted accumulate and the report keeps when the first run started; the other counts and
+// the unpaid members describe the latest run, which retried whoever the earlier ones missed
+func mergePayrollRun(run, previous models.PayrollRun) models.PayrollRun {
+	run.Paid += previous.Paid
+	run.Minted += previous.Minted
+	run.StartedAt = previous.StartedAt
+	return run
+}
+
+// GetIncompletePayrollRuns retrieves the runs of every workspace that left members unpaid
+func GetIncompletePayrollRuns(ctx context.Context) ([]models.PayrollRun, error) {
+	iter := Client.Collection("payroll_runs").
+		Where("failed", ">", 0).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var runs []models.PayrollRun
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating incomplete payroll runs: %v", err)
+			return runs, err
+		}
+
+		var run models.PayrollRun
+		if err := doc.DataTo(&run); err != nil {
+			log.Printf("Error parsing payroll run %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		run.ID = doc.Ref.ID
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// GrantPayroll atomically mints a payroll run's stipend from the treasury for a batch of users
+// Users already paid within the run, frozen wallets and wallets that don't exist are skipped,
+// so running a batch again never pays anyone twice
+// A batch is a transaction rather than BulkWriter writes so that a grant document, the guard against
+// paying twice, is only ever saved together with the coins it records. The treasury is adjusted with a
+// blind increment, so concurrent batches don't contend on its document
+func GrantPayroll(ctx context.Context, run *models.PayrollRun, amount int, userIDs []string) (models.PayrollBatchResult, error) {
+	runRef := payrollRunRef(run.PayrollID, run.Period)
+	userRefs := make([]*firestore.DocumentRef, len(userIDs))
+	grantRefs := make([]*firestore.DocumentRef, len(userIDs))
+	for i, userID := range userIDs {
+		userRefs[i] = Client.Collection("users").Doc(userID)
+		grantRefs[i] = runRef.Collection("grants").Doc(userID)
+	}
+
+	var result models.PayrollBatchResult
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		result = models.PayrollBatchResult{}
+
+		grantDocs, err := tx.GetAll(grantRefs)
+		if err != nil {
+			return err
+		}
+		userDocs, err := tx.GetAll(userRefs)
+		if err != nil {
+			return err
+		}
+
+		granted := make([]bool, len(userIDs))
+		users := make([]*models.User, len(userIDs))
+		for i, userDoc := range userDocs {
+			granted[i] = grantDocs[i].Exists()
+			if !userDoc.Exists() {
+				continue
+			}
+			users[i] = &models.User{}
+			if err := userDoc.DataTo(users[i]); err != nil {
+				return err
+			}
+		}
+		result = planPayrollBatch(userIDs, granted, users)
+
+		now := time.Now()
+		var postings []models.Posting
+		for i, userID := range userIDs {
+			if !slices.Contains(result.Paid, userID) {
+				continue
+			}
+			if err := tx.Update(userRefs[i], []firestore.Update{{Path: "coins", Value: users[i].Coins + amount}}); err != nil {
+				return err
+			}
+			if err := tx.Create(grantRefs[i], &models.PayrollGrant{UserID: userID, Amount: amount, CreatedAt: now}); err != nil {
+				return err
+			}
+			postings = append(postings, models.Posting{AccountID: userID, Amount: amount})
+		}
+
+		if len(result.Paid) == 0 {
+			return nil
+		}
+		minted := amount * len(result.Paid)
+		if err := adjustSystemAccount(tx, config.TreasuryAccountID, -minted); err != nil {
+			return err
+		}
+		postings = append(postings, models.Posting{AccountID: config.TreasuryAccountID, Amount: -minted})
+		return postEntry(tx, models.LedgerEntryPayroll, runRef.ID, postings...)
+	})
+	if err != nil {
+		log.Printf("Error granting payroll %s for %s to %d users: %v", run.PayrollID, run.Period, len(userIDs), err)
+		return models.PayrollBatchResult{}, err
+	}
+
+	return result, nil
+}
+
+// planPayrollBatch decides who a payroll batch pays
+// granted[i] reports whether userIDs[i] was already paid within the run, and users[i] is their wallet,
+// or nil when it doesn't exist. System and frozen wallets are skipped along with missing ones
+func planPayrollBatch(userIDs []string, granted []bool, users []*models.User) models.PayrollBatchResult {
+	var result models.PayrollBatchResult
+	for i, userID := range userIDs {
+		switch {
+		case granted[i]:
+			result.AlreadyPaid++
+		case users[i] == nil || users[i].System || users[i].IsFrozen():
+			result.Skipped++
+		default:
+			result.Paid = append(result.Paid, userID)
+		}
+	}
+	return result
+}
+
+// payrollRunRef returns the document holding a payroll's run for a period
+func payrollRunRef(payrollID, period string) *firestore.DocumentRef {
+	return Client.Collection("payroll_runs").Doc(payrollID + "-" + period)
+}
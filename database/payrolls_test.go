@@ -0,0 +1,86 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+func TestMergePayrollRun(t *testing.T) {
+	first := time.Date(2026, 10, 1, 0, 5, 0, 0, time.UTC)
+	retry := time.Date(2026, 10, 2, 0, 5, 0, 0, time.UTC)
+	previous := models.PayrollRun{
+		Period: "2026-10", Members: 5, Paid: 3, AlreadyPaid: 0, Skipped: 0, Minted: 30,
+		Failed: 2, Unpaid: []string{"U4", "U5"}, StartedAt: first,
+	}
+	run := models.PayrollRun{
+		Period: "2026-10", Members: 2, Paid: 2, Minted: 20, StartedAt: retry, FinishedAt: retry,
+	}
+
+	want := models.PayrollRun{
+		Period: "2026-10", Members: 2, Paid: 5, Minted: 50, StartedAt: first, FinishedAt: retry,
+	}
+	if got := mergePayrollRun(run, previous); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergePayrollRun() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPlanPayrollBatch(t *testing.T) {
+	active := &models.User{Coins: 10}
+	frozen := &models.User{Coins: 10, Status: models.UserStatusFrozen}
+	system := &models.User{System: true}
+
+	tests := []struct {
+		name    string
+		userIDs []string
+		granted []bool
+		users   []*models.User
+		want    models.PayrollBatchResult
+	}{
+		{
+			name:    "first run pays every active wallet",
+			userIDs: []string{"U1", "U2"},
+			granted: []bool{false, false},
+			users:   []*models.User{active, active},
+			want:    models.PayrollBatchResult{Paid: []string{"U1", "U2"}},
+		},
+		{
+			name:    "running the period again pays nobody twice",
+			userIDs: []string{"U1", "U2"},
+			granted: []bool{true, true},
+			users:   []*models.User{active, active},
+			want:    models.PayrollBatchResult{AlreadyPaid: 2},
+		},
+		{
+			name:    "retrying unpaid members pays only the missing ones",
+			userIDs: []string{"U1", "U2", "U3"},
+			granted: []bool{true, false, true},
+			users:   []*models.User{active, active, active},
+			want:    models.PayrollBatchResult{Paid: []string{"U2"}, AlreadyPaid: 2},
+		},
+		{
+			name:    "frozen, system and missing wallets are skipped",
+			userIDs: []string{"U1", "U2", "treasury", "U4"},
+			granted: []bool{false, false, false, false},
+			users:   []*models.User{active, frozen, system, nil},
+			want:    models.PayrollBatchResult{Paid: []string{"U1"}, Skipped: 3},
+		},
+		{
+			name:    "a paid member frozen since is still already paid",
+			userIDs: []string{"U1"},
+			granted: []bool{true},
+			users:   []*models.User{frozen},
+			want:    models.PayrollBatchResult{AlreadyPaid: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planPayrollBatch(tt.userIDs, tt.granted, tt.users); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planPayrollBatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
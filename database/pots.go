@@ -0,0 +1,347 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrPotNotFound is returned when a pot doesn't exist
+	ErrPotNotFound = errors.New("pot not found")
+
+	// ErrPotClosed is returned when contributing to, or refunding, a pot that is no longer open
+	ErrPotClosed = errors.New("pot closed")
+
+	// ErrOwnPot is returned when the beneficiary of a pot contributes to it
+	ErrOwnPot = errors.New("contribution to own pot")
+)
+
+// CreatePot opens a pot and returns its ID
+func CreatePot(ctx context.Context, pot *models.Pot) (string, error) {
+	pot.WorkspaceID = config.WorkspaceFromContext(ctx)
+	id, err := createWithShortID(ctx, "pots", pot)
+	if err != nil {
+		log.Printf("Error creating pot %q: %v", pot.Title, err)
+		return "", err
+	}
+
+	pot.ID = id
+	return id, nil
+}
+
+// SetPotMessage records the channel message showing a pot's progress
+func SetPotMessage(ctx context.Context, id, messageTS string) error {
+	_, err := Client.Collection("pots").Doc(id).Update(ctx, []firestore.Update{
+		{Path: "message_ts", Value: messageTS},
+	})
+	if err != nil {
+		log.Printf("Error saving message of pot %s: %v", id, err)
+	}
+	return err
+}
+
+// GetPot retrieves a pot of the workspace carried by the context
+func GetPot(ctx context.Context, id string) (*models.Pot, error) {
+	doc, err := Client.Collection("pots").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrPotNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting pot %s: %v", id, err)
+		return nil, err
+	}
+
+	var pot models.Pot
+	if err := doc.DataTo(&pot); err != nil {
+		log.Printf("Error parsing pot %s: %v", id, err)
+		return nil, err
+	}
+	if pot.WorkspaceID != config.WorkspaceFromContext(ctx) {
+		return nil, ErrPotNotFound
+	}
+	pot.ID = doc.Ref.ID
+	return &pot, nil
+}
+
+// GetOpenPots retrieves the pots still collecting contributions, soonest deadline first
+// An empty workspaceID returns the open pots of every workspace
+func GetOpenPots(ctx context.Context, workspaceID string) ([]models.Pot, error) {
+	query := Client.Collection("pots").Where("status", "==", models.PotStatusOpen)
+	if workspaceID != "" {
+		query = query.Where("workspace_id", "==", workspaceID)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var pots []models.Pot
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating pots: %v", err)
+			return pots, err
+		}
+
+		var pot models.Pot
+		if err := doc.DataTo(&pot); err != nil {
+			log.Printf("Error parsing pot %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		pot.ID = doc.Ref.ID
+		pots = append(pots, pot)
+	}
+
+	sort.Slice(pots, func(i, j int) bool { return pots[i].Deadline.Before(pots[j].Deadline) })
+	return pots, nil
+}
+
+// Contribute atomically puts up to amount coins from the user in a pot's escrow and returns the
+// coins actually given, which never exceed what the goal still misses
+// The contribution that reaches the goal also pays the pot out of escrow, to the beneficiary
+// or to the treasury when the pot has none. A beneficiary whose wallet was frozen since the pot was
+// created can't be paid, and ErrRecipientFrozen is returned without taking the contribution
+// Contributions to a pot with a beneficiary are also recorded as transfers to them for the transfer limits
+func Contribute(ctx context.Context, potID, userID string, amount int) (*models.Pot, int, error) {
+	potRef := Client.Collection("pots").Doc(potID)
+	userRef := Client.Collection("users").Doc(userID)
+	contributionRef := potRef.Collection("contributions").NewDoc()
+	transferRef := Client.Collection("transfers").NewDoc()
+
+	var pot models.Pot
+	var given int
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(potRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrPotNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&pot); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if pot.Status != models.PotStatusOpen || now.After(pot.Deadline) {
+			return ErrPotClosed
+		}
+		if userID == pot.BeneficiaryID {
+			return ErrOwnPot
+		}
+
+		userDoc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := userDoc.DataTo(&user); err != nil {
+			return err
+		}
+		if user.IsFrozen() {
+			return ErrSenderFrozen
+		}
+		given = min(amount, pot.Remaining())
+		if user.Coins < given {
+			return ErrInsufficientFunds
+		}
+
+		pot.Raised += given
+		funded := pot.Remaining() == 0
+
+		// Read whoever the pot is paid to before writing anything
+		var recipientID string
+		var recipient *models.User
+		if funded {
+			if pot.BeneficiaryID != "" {
+				recipientID = pot.BeneficiaryID
+				recipientDoc, err := tx.Get(Client.Collection("users").Doc(recipientID))
+				if err != nil {
+					return err
+				}
+				recipient = &models.User{}
+				if err := recipientDoc.DataTo(recipient); err != nil {
+					return err
+				}
+				if recipient.IsFrozen() {
+					return ErrRecipientFrozen
+				}
+			} else {
+				recipientID = config.TreasuryAccountID
+			}
+		}
+
+		if err := tx.Update(userRef, []firestore.Update{{Path: "coins", Value: user.Coins - given}}); err != nil {
+			return err
+		}
+		if err := tx.Create(contributionRef, &models.PotContribution{UserID: userID, Amount: given, CreatedAt: now}); err != nil {
+			return err
+		}
+		if pot.BeneficiaryID != "" {
+			if err := tx.Create(transferRef, &models.Transfer{
+				Type:        models.TransferTypeContribution,
+				SenderID:    userID,
+				RecipientID: pot.BeneficiaryID,
+				Amount:      given,
+				Memo:        pot.Title,
+				CreatedAt:   now,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := postTransfer(tx, models.LedgerEntryContribution, potID, userID, config.EscrowAccountID, given); err != nil {
+			return err
+		}
+		if !funded {
+			if err := adjustSystemAccount(tx, config.EscrowAccountID, given); err != nil {
+				return err
+			}
+			return tx.Update(potRef, []firestore.Update{{Path: "raised", Value: pot.Raised}})
+		}
+
+		// The escrow receives the last contribution and pays out the whole pot at once
+		if err := adjustSystemAccount(tx, config.EscrowAccountID, given-pot.Raised); err != nil {
+			return err
+		}
+		if recipient == nil {
+			pot.Status = models.PotStatusRedeemed
+			if err := adjustSystemAccount(tx, recipientID, pot.Raised); err != nil {
+				return err
+			}
+		} else {
+			pot.Status = models.PotStatusPaid
+			if err := tx.Update(Client.Collection("users").Doc(recipientID), []firestore.Update{
+				{Path: "coins", Value: recipient.Coins + pot.Raised},
+			}); err != nil {
+				return err
+			}
+		}
+		pot.ClosedAt = now
+		if err := tx.Set(potRef, &pot); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryPotPayout, potID, config.EscrowAccountID, recipientID, pot.Raised)
+	})
+	if err != nil {
+		log.Printf("Error contributing %d to pot %s for %s: %v", amount, potID, userID, err)
+		return nil, 0, err
+	}
+
+	pot.ID = potID
+	return &pot, given, nil
+}
+
+// RefundPot atomically returns every contribution to a pot out of escrow
+// It returns the coins refunded to each user
+func RefundPot(ctx context.Context, potID string) (*models.Pot, map[string]int, error) {
+	potRef := Client.Collection("pots").Doc(potID)
+
+	var pot models.Pot
+	var refunds map[string]int
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(potRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrPotNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&pot); err != nil {
+			return err
+		}
+		if pot.Status != models.PotStatusOpen {
+			return ErrPotClosed
+		}
+
+		contributions, err := readPotContributions(tx.Documents(potRef.Collection("contributions")))
+		if err != nil {
+			return err
+		}
+		refunds = make(map[string]int)
+		for _, contribution := range contributions {
+			refunds[contribution.UserID] += contribution.Amount
+		}
+
+		refs := make([]*firestore.DocumentRef, 0, len(refunds))
+		for userID := range refunds {
+			refs = append(refs, Client.Collection("users").Doc(userID))
+		}
+		userDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		postings := []models.Posting{{AccountID: config.EscrowAccountID, Amount: -pot.Raised}}
+		for _, userDoc := range userDocs {
+			var user models.User
+			if err := userDoc.DataTo(&user); err != nil {
+				return err
+			}
+			refund := refunds[userDoc.Ref.ID]
+			if err := tx.Update(userDoc.Ref, []firestore.Update{{Path: "coins", Value: user.Coins + refund}}); err != nil {
+				return err
+			}
+			postings = append(postings, models.Posting{AccountID: userDoc.Ref.ID, Amount: refund})
+		}
+		if err := adjustSystemAccount(tx, config.EscrowAccountID, -pot.Raised); err != nil {
+			return err
+		}
+
+		pot.Status = models.PotStatusRefunded
+		pot.ClosedAt = time.Now()
+		if err := tx.Set(potRef, &pot); err != nil {
+			return err
+		}
+		return postEntry(tx, models.LedgerEntryContributionRefund, potID, postings...)
+	})
+	if err != nil {
+		log.Printf("Error refunding pot %s: %v", potID, err)
+		return nil, nil, err
+	}
+
+	pot.ID = potID
+	return &pot, refunds, nil
+}
+
+// GetPotContributions retrieves every contribution to a pot
+func GetPotContributions(ctx context.Context, potID string) ([]models.PotContribution, error) {
+	contributions, err := readPotContributions(Client.Collection("pots").Doc(potID).Collection("contributions").Documents(ctx))
+	if err != nil {
+		log.Printf("Error reading contributions of pot %s: %v", potID, err)
+	}
+	return contributions, err
+}
+
+// readPotContributions reads every contribution returned by iter
+func readPotContributions(iter *firestore.DocumentIterator) ([]models.PotContribution, error) {
+	defer iter.Stop()
+
+	var contributions []models.PotContribution
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var contribution models.PotContribution
+		if err := doc.DataTo(&contribution); err != nil {
+			return nil, err
+		}
+		contributions = append(contributions, contribution)
+	}
+	return contributions, nil
+}
@@ -0,0 +1,352 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrRaffleNotFound is returned when a raffle doesn't exist
+	ErrRaffleNotFound = errors.New("raffle not found")
+
+	// ErrRaffleEnded is returned when buying tickets for a raffle that no longer sells them
+	ErrRaffleEnded = errors.New("raffle ended")
+
+	// ErrRaffleSettled is returned when drawing or cancelling a raffle that was already drawn or cancelled
+	ErrRaffleSettled = errors.New("raffle already settled")
+)
+
+// CreateRaffle starts a raffle and returns its ID
+func CreateRaffle(ctx context.Context, raffle *models.Raffle) (string, error) {
+	raffle.WorkspaceID = config.WorkspaceFromContext(ctx)
+	id, err := createWithShortID(ctx, "raffles", raffle)
+	if err != nil {
+		log.Printf("Error creating raffle: %v", err)
+		return "", err
+	}
+
+	raffle.ID = id
+	return id, nil
+}
+
+// GetRaffle retrieves a raffle of the workspace carried by the context
+func GetRaffle(ctx context.Context, id string) (*models.Raffle, error) {
+	doc, err := Client.Collection("raffles").Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrRaffleNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting raffle %s: %v", id, err)
+		return nil, err
+	}
+
+	var raffle models.Raffle
+	if err := doc.DataTo(&raffle); err != nil {
+		log.Printf("Error parsing raffle %s: %v", id, err)
+		return nil, err
+	}
+	if raffle.WorkspaceID != config.WorkspaceFromContext(ctx) {
+		return nil, ErrRaffleNotFound
+	}
+	raffle.ID = doc.Ref.ID
+	return &raffle, nil
+}
+
+// GetOpenRaffles retrieves the raffles that were not drawn or cancelled yet, soonest ending first
+// An empty workspaceID returns the open raffles of every workspace
+func GetOpenRaffles(ctx context.Context, workspaceID string) ([]models.Raffle, error) {
+	query := Client.Collection("raffles").Where("status", "==", models.RaffleStatusOpen)
+	if workspaceID != "" {
+		query = query.Where("workspace_id", "==", workspaceID)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	var raffles []models.Raffle
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating raffles: %v", err)
+			return raffles, err
+		}
+
+		var raffle models.Raffle
+		if err := doc.DataTo(&raffle); err != nil {
+			log.Printf("Error parsing raffle %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		raffle.ID = doc.Ref.ID
+		raffles = append(raffles, raffle)
+	}
+
+	sort.Slice(raffles, func(i, j int) bool { return raffles[i].EndsAt.Before(raffles[j].EndsAt) })
+	return raffles, nil
+}
+
+// BuyTickets atomically puts the price of count tickets in escrow and assigns the next ticket numbers
+func BuyTickets(ctx context.Context, raffleID, userID string, count int) (*models.Raffle, *models.RaffleTickets, error) {
+	raffleRef := Client.Collection("raffles").Doc(raffleID)
+	userRef := Client.Collection("users").Doc(userID)
+	ticketsRef := raffleRef.Collection("tickets").NewDoc()
+
+	var raffle models.Raffle
+	var tickets models.RaffleTickets
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(raffleRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrRaffleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&raffle); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if raffle.Status != models.RaffleStatusOpen || now.After(raffle.EndsAt) {
+			return ErrRaffleEnded
+		}
+
+		userDoc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := userDoc.DataTo(&user); err != nil {
+			return err
+		}
+		if user.IsFrozen() {
+			return ErrSenderFrozen
+		}
+		price := raffle.TicketPrice * count
+		if user.Coins < price {
+			return ErrInsufficientFunds
+		}
+
+		tickets = models.RaffleTickets{
+			UserID:    userID,
+			First:     raffle.Tickets + 1,
+			Count:     count,
+			CreatedAt: now,
+		}
+		raffle.Tickets += count
+		raffle.Pot += price
+
+		if err := tx.Update(raffleRef, []firestore.Update{
+			{Path: "tickets", Value: raffle.Tickets},
+			{Path: "pot", Value: raffle.Pot},
+		}); err != nil {
+			return err
+		}
+		if err := tx.Update(userRef, []firestore.Update{{Path: "coins", Value: user.Coins - price}}); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.EscrowAccountID, price); err != nil {
+			return err
+		}
+		if err := tx.Create(ticketsRef, &tickets); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryTicket, raffleID, userID, config.EscrowAccountID, price)
+	})
+	if err != nil {
+		log.Printf("Error buying %d tickets of raffle %s for %s: %v", count, raffleID, userID, err)
+		return nil, nil, err
+	}
+
+	raffle.ID = raffleID
+	return &raffle, &tickets, nil
+}
+
+// DrawRaffle atomically draws the winning ticket of a raffle, reveals its seed and pays the pot out of escrow
+// The treasury keeps the cut announced when the raffle started; a raffle without tickets is closed without a winner
+func DrawRaffle(ctx context.Context, raffleID string) (*models.Raffle, error) {
+	raffleRef := Client.Collection("raffles").Doc(raffleID)
+
+	var raffle models.Raffle
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(raffleRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrRaffleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&raffle); err != nil {
+			return err
+		}
+		if raffle.Status != models.RaffleStatusOpen {
+			return ErrRaffleSettled
+		}
+
+		raffle.Status = models.RaffleStatusDrawn
+		raffle.DrawnAt = time.Now()
+		if raffle.Tickets == 0 {
+			return tx.Set(raffleRef, &raffle)
+		}
+
+		purchases, err := readRaffleTickets(tx.Documents(raffleRef.Collection("tickets")))
+		if err != nil {
+			return err
+		}
+		raffle.WinningTicket = models.DrawTicket(raffle.Seed, raffleID, raffle.Tickets)
+		for _, purchase := range purchases {
+			if raffle.WinningTicket >= purchase.First && raffle.WinningTicket < purchase.First+purchase.Count {
+				raffle.WinnerID = purchase.UserID
+			}
+		}
+		if raffle.WinnerID == "" {
+			return errors.New("winning ticket has no owner")
+		}
+
+		// A frozen winner is paid like anyone else: the tickets were bought before the freeze
+		// and the draw is verifiable, so withholding the pot would change a published result
+		winnerRef := Client.Collection("users").Doc(raffle.WinnerID)
+		winnerDoc, err := tx.Get(winnerRef)
+		if err != nil {
+			return err
+		}
+		var winner models.User
+		if err := winnerDoc.DataTo(&winner); err != nil {
+			return err
+		}
+
+		cut := raffle.Pot * raffle.CutPercent / 100
+		raffle.Payout = raffle.Pot - cut
+
+		if err := tx.Update(winnerRef, []firestore.Update{{Path: "coins", Value: winner.Coins + raffle.Payout}}); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.EscrowAccountID, -raffle.Pot); err != nil {
+			return err
+		}
+		if cut > 0 {
+			if err := adjustSystemAccount(tx, config.TreasuryAccountID, cut); err != nil {
+				return err
+			}
+		}
+		if err := tx.Set(raffleRef, &raffle); err != nil {
+			return err
+		}
+		return postEntry(tx, models.LedgerEntryRafflePayout, raffleID,
+			models.Posting{AccountID: config.EscrowAccountID, Amount: -raffle.Pot},
+			models.Posting{AccountID: raffle.WinnerID, Amount: raffle.Payout},
+			models.Posting{AccountID: config.TreasuryAccountID, Amount: cut},
+		)
+	})
+	if err != nil {
+		log.Printf("Error drawing raffle %s: %v", raffleID, err)
+		return nil, err
+	}
+
+	raffle.ID = raffleID
+	return &raffle, nil
+}
+
+// CancelRaffle atomically refunds every ticket of a raffle out of escrow
+// It returns the coins refunded to each user
+func CancelRaffle(ctx context.Context, raffleID string) (*models.Raffle, map[string]int, error) {
+	raffleRef := Client.Collection("raffles").Doc(raffleID)
+
+	var raffle models.Raffle
+	var refunds map[string]int
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(raffleRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrRaffleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&raffle); err != nil {
+			return err
+		}
+		if raffle.Status != models.RaffleStatusOpen {
+			return ErrRaffleSettled
+		}
+
+		purchases, err := readRaffleTickets(tx.Documents(raffleRef.Collection("tickets")))
+		if err != nil {
+			return err
+		}
+		refunds = make(map[string]int)
+		for _, purchase := range purchases {
+			refunds[purchase.UserID] += purchase.Count * raffle.TicketPrice
+		}
+
+		refs := make([]*firestore.DocumentRef, 0, len(refunds))
+		for userID := range refunds {
+			refs = append(refs, Client.Collection("users").Doc(userID))
+		}
+		userDocs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		postings := []models.Posting{{AccountID: config.EscrowAccountID, Amount: -raffle.Pot}}
+		for _, userDoc := range userDocs {
+			var user models.User
+			if err := userDoc.DataTo(&user); err != nil {
+				return err
+			}
+			refund := refunds[userDoc.Ref.ID]
+			if err := tx.Update(userDoc.Ref, []firestore.Update{{Path: "coins", Value: user.Coins + refund}}); err != nil {
+				return err
+			}
+			postings = append(postings, models.Posting{AccountID: userDoc.Ref.ID, Amount: refund})
+		}
+		if err := adjustSystemAccount(tx, config.EscrowAccountID, -raffle.Pot); err != nil {
+			return err
+		}
+
+		raffle.Status = models.RaffleStatusCancelled
+		if err := tx.Set(raffleRef, &raffle); err != nil {
+			return err
+		}
+		return postEntry(tx, models.LedgerEntryTicketRefund, raffleID, postings...)
+	})
+	if err != nil {
+		log.Printf("Error cancelling raffle %s: %v", raffleID, err)
+		return nil, nil, err
+	}
+
+	raffle.ID = raffleID
+	return &raffle, refunds, nil
+}
+
+// readRaffleTickets reads every ticket purchase returned by iter
+func readRaffleTickets(iter *firestore.DocumentIterator) ([]models.RaffleTickets, error) {
+	defer iter.Stop()
+
+	var purchases []models.RaffleTickets
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var purchase models.RaffleTickets
+		if err := doc.DataTo(&purchase); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, purchase)
+	}
+	return purchases, nil
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrSeasonNotFound is returned when no archive exists for a season
+	ErrSeasonNotFound = errors.New("season not found")
+
+	// ErrSeasonAlreadyClosed is returned when the season was closed by someone else in the meantime
+	ErrSeasonAlreadyClosed = errors.New("season already closed")
+
+	// ErrEscrowNotEmpty is returned when a season is closed while open markets, raffles or pots hold coins
+	ErrEscrowNotEmpty = errors.New("coins are held in escrow")
+)
+
+// seasonRef returns the archive document of a season of a workspace
+func seasonRef(workspaceID string, number int) *firestore.DocumentRef {
+	return Client.Collection("settings").Doc(workspaceID).Collection("seasons").Doc(strconv.Itoa(number))
+}
+
+// SnapshotWallets reads every wallet at a single point in time to rank a season
+// It fails with ErrEscrowNotEmpty while escrow holds coins, which would otherwise be refunded into the next season
+func SnapshotWallets(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		escrow, err := getSystemAccount(tx, config.EscrowAccountID)
+		if err != nil {
+			return err
+		}
+		if escrow.Coins != 0 {
+			return ErrEscrowNotEmpty
+		}
+
+		docs, err := tx.Documents(Client.Collection("users")).GetAll()
+		if err != nil {
+			return err
+		}
+		users = make([]models.User, 0, len(docs))
+		for _, doc := range docs {
+			var user models.User
+			if err := doc.DataTo(&user); err != nil {
+				log.Printf("Error parsing user %s: %v", doc.Ref.ID, err)
+				continue
+			}
+			users = append(users, user)
+		}
+		return nil
+	}, firestore.ReadOnly)
+	if err != nil {
+		log.Printf("Error taking a snapshot of the wallets: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// CloseSeason archives the season and starts the next one in the workspace carried by the context
+// The season number is checked against the current one so a season can only be closed once
+func CloseSeason(ctx context.Context, season *models.Season) error {
+	workspaceID := config.WorkspaceFromContext(ctx)
+	settingsRef := Client.Collection("settings").Doc(workspaceID)
+	historyRef := settingsRef.Collection("history").NewDoc()
+	archiveRef := seasonRef(workspaceID, season.Number)
+
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		settings := DefaultSettings()
+		doc, err := tx.Get(settingsRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := doc.DataTo(&settings); err != nil {
+				return err
+			}
+		}
+
+		if settings.CurrentSeason != season.Number {
+			return ErrSeasonAlreadyClosed
+		}
+
+		season.WorkspaceID = workspaceID
+		season.StartedAt = settings.SeasonStartedAt
+		if err := tx.Create(archiveRef, season); err != nil {
+			return err
+		}
+
+		if err := tx.Set(settingsRef, map[string]interface{}{
+			"current_season":    season.Number + 1,
+			"season_started_at": season.ClosedAt,
+			"updated_by":        season.ClosedBy,
+			"updated_at":        season.ClosedAt,
+		}, firestore.MergeAll); err != nil {
+			return err
+		}
+
+		return tx.Create(historyRef, models.SettingChange{
+			WorkspaceID: workspaceID,
+			Key:         "current_season",
+			OldValue:    season.Number,
+			NewValue:    season.Number + 1,
+			Detail:      fmt.Sprintf("closed season %d", season.Number),
+			AdminID:     season.ClosedBy,
+			CreatedAt:   season.ClosedAt,
+		})
+	})
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			err = ErrSeasonAlreadyClosed
+		}
+		log.Printf("Error closing season %d for workspace %s: %v", season.Number, workspaceID, err)
+		return err
+	}
+
+	forgetSettings(workspaceID)
+	return nil
+}
+
+// ResetBalances sets the balance of each wallet in balances, keyed by user ID, in batches of config.WalletBatchSize
+// Coins a wallet gained or spent since its balance in snapshot carry over on top of the new balance, so
+// transfers made while the season closes are kept. Wallets frozen in the meantime are left alone
+// The treasury takes back or issues the difference, recorded as one season-reset entry per batch
+func ResetBalances(ctx context.Context, snapshot, balances map[string]int, reference string) error {
+	userIDs := make([]string, 0, len(balances))
+	for userID := range balances {
+		userIDs = append(userIDs, userID)
+	}
+	slices.Sort(userIDs)
+
+	for start := 0; start < len(userIDs); start += config.WalletBatchSize {
+		batch := userIDs[start:min(start+config.WalletBatchSize, len(userIDs))]
+		if err := resetBatch(ctx, batch, snapshot, balances, reference); err != nil {
+			log.Printf("Error resetting balances of %d users: %v", len(batch), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// resetBatch atomically resets the balances of a batch of wallets against the treasury
+func resetBatch(ctx context.Context, userIDs []string, snapshot, balances map[string]int, reference string) error {
+	refs := make([]*firestore.DocumentRef, 0, len(userIDs))
+	for _, userID := range userIDs {
+		refs = append(refs, Client.Collection("users").Doc(userID))
+	}
+
+	return Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+
+		docs, err := tx.GetAll(refs)
+		if err != nil {
+			return err
+		}
+
+		var postings []models.Posting
+		issued := 0
+		for _, doc := range docs {
+			if !doc.Exists() {
+				continue
+			}
+
+			var user models.User
+			if err := doc.DataTo(&user); err != nil {
+				return err
+			}
+			if user.IsFrozen() {
+				continue
+			}
+
+			balance := max(balances[user.UserID]+user.Coins-snapshot[user.UserID], 0)
+			delta := balance - user.Coins
+			if delta == 0 {
+				continue
+			}
+			if err := tx.Update(doc.Ref, []firestore.Update{
+				{Path: "coins", Value: balance},
+			}); err != nil {
+				return err
+			}
+			postings = append(postings, models.Posting{AccountID: user.UserID, Amount: delta})
+			issued += delta
+		}
+
+		if issued != 0 {
+			if err := adjustSystemAccount(tx, config.TreasuryAccountID, -issued); err != nil {
+				return err
+			}
+		}
+		postings = append(postings, models.Posting{AccountID: config.TreasuryAccountID, Amount: -issued})
+		return postEntry(tx, models.LedgerEntrySeasonReset, reference, postings...)
+	})
+}
+
+// GetSeason retrieves the archive of a closed season of the workspace carried by the context
+func GetSeason(ctx context.Context, number int) (*models.Season, error) {
+	doc, err := seasonRef(config.WorkspaceFromContext(ctx), number).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrSeasonNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting season %d: %v", number, err)
+		return nil, err
+	}
+
+	var season models.Season
+	if err := doc.DataTo(&season); err != nil {
+		log.Printf("Error parsing season %d: %v", number, err)
+		return nil, err
+	}
+	return &season, nil
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// cachedSettings is a workspace's settings along with when they were loaded
+type cachedSettings struct {
+	settings models.Settings
+	loadedAt time.Time
+}
+
+var (
+	settingsMu    sync.Mutex
+	settingsCache = make(map[string]cachedSettings)
+)
+
+// DefaultSettings returns the settings used when a workspace has not overridden them
+func DefaultSettings() models.Settings {
+	return models.Settings{
+		InitialCoins:              config.InitialCoins,
+		LeaderboardLimit:          config.LeaderboardLimit,
+		RequestTimestampTolerance: config.RequestTimestampTolerance,
+		LargeTransferThreshold:    config.LargeTransferThreshold,
+		UndoWindowMinutes:         config.UndoWindowMinutes,
+		PairCapPeriodHours:        config.PairCapPeriodHours,
+		DemurrageThreshold:        config.DemurrageThreshold,
+		DemurrageRatePercent:      config.DemurrageRatePercent,
+		DemurragePeriodDays:       config.DemurragePeriodDays,
+		DemurrageIdleDays:         config.DemurrageIdleDays,
+		SeasonStartingBalance:     config.InitialCoins,
+		RainWindowMinutes:         config.RainWindowMinutes,
+		RainMinShare:              config.RainMinShare,
+		CurrentSeason:             1,
+	}
+}
+
+// GetSettings returns the settings of the workspace carried by the context
+// Settings are cached for config.SettingsCacheTTL seconds and fall back to the defaults
+// when they can't be loaded
+func GetSettings(ctx context.Context) models.Settings {
+	workspaceID := config.WorkspaceFromContext(ctx)
+
+	settingsMu.Lock()
+	cached, ok := settingsCache[workspaceID]
+	settingsMu.Unlock()
+	if ok && time.Since(cached.loadedAt) < config.SettingsCacheTTL*time.Second {
+		return cached.settings
+	}
+
+	settings, err := loadSettings(ctx, workspaceID)
+	if err != nil {
+		log.Printf("Error loading settings for workspace %s, using defaults: %v", workspaceID, err)
+		return DefaultSettings()
+	}
+
+	settingsMu.Lock()
+	settingsCache[workspaceID] = cachedSettings{settings: settings, loadedAt: time.Now()}
+	settingsMu.Unlock()
+
+	return settings
+}
+
+// loadSettings reads a workspace's settings document on top of the defaults
+func loadSettings(ctx context.Context, workspaceID string) (models.Settings, error) {
+	settings := DefaultSettings()
+
+	doc, err := Client.Collection("settings").Doc(workspaceID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	// Fields missing from the document keep their default value
+	if err := doc.DataTo(&settings); err != nil {
+		return DefaultSettings(), err
+	}
+	return settings, nil
+}
+
+// UpdateSetting changes an integer setting of the workspace carried by the context and records the change
+func UpdateSetting(ctx context.Context, definition models.SettingDefinition, value int, adminID string) (*models.SettingChange, error) {
+	if value < definition.Min || value > definition.Max {
+		return nil, fmt.Errorf("%s must be between %d and %d", definition.Key, definition.Min, definition.Max)
+	}
+
+	return updateSettings(ctx, adminID, func(settings *models.Settings) (models.SettingChange, map[string]interface{}) {
+		field := definition.Field(settings)
+		change := models.SettingChange{
+			Key:      definition.Key,
+			OldValue: *field,
+			NewValue: value,
+		}
+		*field = value
+		return change, map[string]interface{}{definition.Key: value}
+	})
+}
+
+// UpdateChannelSettings applies mutate to the channel settings of the workspace carried by the context
+// The detail describes the change in the settings history
+func UpdateChannelSettings(ctx context.Context, adminID, detail string, mutate func(*models.Settings)) (*models.SettingChange, error) {
+	return updateSettings(ctx, adminID, func(settings *models.Settings) (models.SettingChange, map[string]interface{}) {
+		mutate(settings)
+		change := models.SettingChange{
+			Key:    "channels",
+			Detail: detail,
+		}
+		return change, map[string]interface{}{
+			"allowed_channels":     settings.AllowedChannels,
+			"quiet_channels":       settings.QuietChannels,
+			"announcement_channel": settings.AnnouncementChannel,
+			"intro_channel":        settings.IntroChannel,
+		}
+	})
+}
+
+// UpdateSeasonPrizes replaces the prizes awarded to the top of the ranking when a season closes
+func UpdateSeasonPrizes(ctx context.Context, adminID string, prizes []int) (*models.SettingChange, error) {
+	return updateSettings(ctx, adminID, func(settings *models.Settings) (models.SettingChange, map[string]interface{}) {
+		detail := "removed the season prizes"
+		if len(prizes) > 0 {
+			detail = fmt.Sprintf("set the season prizes to %v", prizes)
+		}
+		change := models.SettingChange{
+			Key:    "season_prizes",
+			Detail: detail,
+		}
+		return change, map[string]interface{}{"season_prizes": prizes}
+	})
+}
+
+// UpdateStreakMilestones replaces the bonuses paid when a giving streak reaches a number of days
+func UpdateStreakMilestones(ctx context.Context, adminID string, milestones []models.StreakMilestone) (*models.SettingChange, error) {
+	return updateSettings(ctx, adminID, func(settings *models.Settings) (models.SettingChange, map[string]interface{}) {
+		detail := "removed the streak milestones"
+		if len(milestones) > 0 {
+			detail = fmt.Sprintf("set the streak milestones to %v", milestones)
+		}
+		change := models.SettingChange{
+			Key:    "streak_milestones",
+			Detail: detail,
+		}
+		return change, map[string]interface{}{"streak_milestones": milestones}
+	})
+}
+
+// updateSettings atomically applies mutate to the workspace's settings and records the change it returns
+// Only the fields mutate returns are written, so settings left at their default follow later changes to the defaults
+func updateSettings(ctx context.Context, adminID string, mutate func(*models.Settings) (models.SettingChange, map[string]interface{})) (*models.SettingChange, error) {
+	workspaceID := config.WorkspaceFromContext(ctx)
+	settingsRef := Client.Collection("settings").Doc(workspaceID)
+	historyRef := settingsRef.Collection("history").NewDoc()
+
+	var change models.SettingChange
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		settings := DefaultSettings()
+		doc, err := tx.Get(settingsRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := doc.DataTo(&settings); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		var fields map[string]interface{}
+		change, fields = mutate(&settings)
+		change.WorkspaceID = workspaceID
+		change.AdminID = adminID
+		change.CreatedAt = now
+
+		fields["updated_by"] = adminID
+		fields["updated_at"] = now
+		if err := tx.Set(settingsRef, fields, firestore.MergeAll); err != nil {
+			return err
+		}
+		return tx.Create(historyRef, change)
+	})
+	if err != nil {
+		log.Printf("Error updating settings for workspace %s: %v", workspaceID, err)
+		return nil, err
+	}
+
+	forgetSettings(workspaceID)
+	return &change, nil
+}
+
+// forgetSettings drops the cached copy of a workspace's settings so changes apply right away on this instance
+func forgetSettings(workspaceID string) {
+	settingsMu.Lock()
+	delete(settingsCache, workspaceID)
+	settingsMu.Unlock()
+}
+
+// GetSettingHistory retrieves the most recent setting changes of the workspace carried by the context
+func GetSettingHistory(ctx context.Context, limit int) ([]models.SettingChange, error) {
+	workspaceID := config.WorkspaceFromContext(ctx)
+	iter := Client.Collection("settings").Doc(workspaceID).Collection("history").
+		OrderBy("created_at", firestore.Desc).
+		Limit(limit).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var changes []models.SettingChange
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating setting history: %v", err)
+			return changes, err
+		}
+
+		var change models.SettingChange
+		if err := doc.DataTo(&change); err != nil {
+			log.Printf("Error parsing setting change: %v", err)
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
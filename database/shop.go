@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrItemNotFound is returned when a shop item doesn't exist
+	ErrItemNotFound = errors.New("shop item not found")
+
+	// ErrItemExists is returned when creating a shop item whose ID is already taken
+	ErrItemExists = errors.New("shop item already exists")
+
+	// ErrOutOfStock is returned when buying an item that is sold out
+	ErrOutOfStock = errors.New("shop item out of stock")
+
+	// ErrOrderHandled is returned when an order was already delivered or refunded
+	ErrOrderHandled = errors.New("order already handled")
+)
+
+// shopItemRef returns the document of a shop item of a workspace
+func shopItemRef(workspaceID, itemID string) *firestore.DocumentRef {
+	return Client.Collection("settings").Doc(workspaceID).Collection("shop_items").Doc(itemID)
+}
+
+// CreateShopItem adds an item to the shop of the workspace carried by the context
+func CreateShopItem(ctx context.Context, item *models.ShopItem) error {
+	_, err := shopItemRef(config.WorkspaceFromContext(ctx), item.ID).Create(ctx, item)
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrItemExists
+	}
+	if err != nil {
+		log.Printf("Error creating shop item %s: %v", item.ID, err)
+		return err
+	}
+	return nil
+}
+
+// SetShopItemStock changes how many units of a shop item are left
+func SetShopItemStock(ctx context.Context, itemID string, stock int) error {
+	_, err := shopItemRef(config.WorkspaceFromContext(ctx), itemID).Update(ctx, []firestore.Update{
+		{Path: "stock", Value: stock},
+	}, firestore.Exists)
+	if status.Code(err) == codes.NotFound {
+		return ErrItemNotFound
+	}
+	if err != nil {
+		log.Printf("Error updating stock of shop item %s: %v", itemID, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteShopItem removes an item from the shop; its past orders are kept
+func DeleteShopItem(ctx context.Context, itemID string) error {
+	_, err := shopItemRef(config.WorkspaceFromContext(ctx), itemID).Delete(ctx, firestore.Exists)
+	if status.Code(err) == codes.NotFound {
+		return ErrItemNotFound
+	}
+	if err != nil {
+		log.Printf("Error deleting shop item %s: %v", itemID, err)
+		return err
+	}
+	return nil
+}
+
+// GetShopItems retrieves the items of the shop of the workspace carried by the context, cheapest first
+func GetShopItems(ctx context.Context) ([]models.ShopItem, error) {
+	iter := Client.Collection("settings").Doc(config.WorkspaceFromContext(ctx)).Collection("shop_items").
+		OrderBy("price", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var items []models.ShopItem
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating shop items: %v", err)
+			return items, err
+		}
+
+		var item models.ShopItem
+		if err := doc.DataTo(&item); err != nil {
+			log.Printf("Error parsing shop item %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		item.ID = doc.Ref.ID
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// Purchase atomically takes one unit of a shop item, pays its price to the treasury and records the order
+func Purchase(ctx context.Context, itemID, buyerID string) (*models.Order, error) {
+	workspaceID := config.WorkspaceFromContext(ctx)
+	itemRef := shopItemRef(workspaceID, itemID)
+	buyerRef := Client.Collection("users").Doc(buyerID)
+	orderRef := Client.Collection("orders").NewDoc()
+
+	var order models.Order
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		itemDoc, err := tx.Get(itemRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrItemNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var item models.ShopItem
+		if err := itemDoc.DataTo(&item); err != nil {
+			return err
+		}
+		if item.Stock <= 0 {
+			return ErrOutOfStock
+		}
+
+		buyerDoc, err := tx.Get(buyerRef)
+		if err != nil {
+			return err
+		}
+		var buyer models.User
+		if err := buyerDoc.DataTo(&buyer); err != nil {
+			return err
+		}
+		if buyer.IsFrozen() {
+			return ErrSenderFrozen
+		}
+		if buyer.Coins < item.Price {
+			return ErrInsufficientFunds
+		}
+
+		order = models.Order{
+			WorkspaceID: workspaceID,
+			ItemID:      itemID,
+			ItemName:    item.Name,
+			BuyerID:     buyerID,
+			Price:       item.Price,
+			ApproverID:  item.ApproverID,
+			Status:      models.OrderStatusPending,
+			CreatedAt:   time.Now(),
+		}
+
+		if err := tx.Update(itemRef, []firestore.Update{{Path: "stock", Value: item.Stock - 1}}); err != nil {
+			return err
+		}
+		if err := tx.Update(buyerRef, []firestore.Update{{Path: "coins", Value: buyer.Coins - item.Price}}); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.TreasuryAccountID, item.Price); err != nil {
+			return err
+		}
+		if err := tx.Create(orderRef, &order); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryPurchase, orderRef.ID, buyerID, config.TreasuryAccountID, item.Price)
+	})
+	if err != nil {
+		log.Printf("Error purchasing %s for %s: %v", itemID, buyerID, err)
+		return nil, err
+	}
+
+	order.ID = orderRef.ID
+	return &order, nil
+}
+
+// GetOrder retrieves a shop order by ID
+func GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	doc, err := Client.Collection("orders").Doc(orderID).Get(ctx)
+	if err != nil {
+		log.Printf("Error getting order %s: %v", orderID, err)
+		return nil, err
+	}
+
+	var order models.Order
+	if err := doc.DataTo(&order); err != nil {
+		log.Printf("Error parsing order %s: %v", orderID, err)
+		return nil, err
+	}
+	order.ID = doc.Ref.ID
+	return &order, nil
+}
+
+// DeliverOrder marks a pending order as delivered
+func DeliverOrder(ctx context.Context, orderID, handlerID string) (*models.Order, error) {
+	return handleOrder(ctx, orderID, handlerID, models.OrderStatusDelivered)
+}
+
+// RefundOrder atomically returns the price of a pending order to its buyer and puts the unit back in stock
+func RefundOrder(ctx context.Context, orderID, handlerID string) (*models.Order, error) {
+	return handleOrder(ctx, orderID, handlerID, models.OrderStatusRefunded)
+}
+
+// handleOrder moves a pending order to its final status, refunding it when required
+func handleOrder(ctx context.Context, orderID, handlerID, newStatus string) (*models.Order, error) {
+	orderRef := Client.Collection("orders").Doc(orderID)
+
+	var order models.Order
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(orderRef)
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&order); err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusPending {
+			return ErrOrderHandled
+		}
+
+		now := time.Now()
+		updates := []firestore.Update{
+			{Path: "status", Value: newStatus},
+			{Path: "handled_by", Value: handlerID},
+			{Path: "handled_at", Value: now},
+		}
+		if newStatus != models.OrderStatusRefunded {
+			order.Status, order.HandledBy, order.HandledAt = newStatus, handlerID, now
+			return tx.Update(orderRef, updates)
+		}
+
+		// Refunds deliberately ignore frozen wallets: the buyer gets back what they paid
+		buyerRef := Client.Collection("users").Doc(order.BuyerID)
+		buyerDoc, err := tx.Get(buyerRef)
+		if err != nil {
+			return err
+		}
+		var buyer models.User
+		if err := buyerDoc.DataTo(&buyer); err != nil {
+			return err
+		}
+
+		// The item may have been removed from the shop since
+		itemRef := shopItemRef(order.WorkspaceID, order.ItemID)
+		itemDoc, err := tx.Get(itemRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if itemDoc != nil && itemDoc.Exists() {
+			var item models.ShopItem
+			if err := itemDoc.DataTo(&item); err != nil {
+				return err
+			}
+			if err := tx.Update(itemRef, []firestore.Update{{Path: "stock", Value: item.Stock + 1}}); err != nil {
+				return err
+			}
+		}
+		if err := tx.Update(buyerRef, []firestore.Update{{Path: "coins", Value: buyer.Coins + order.Price}}); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.TreasuryAccountID, -order.Price); err != nil {
+			return err
+		}
+
+		order.Status, order.HandledBy, order.HandledAt = newStatus, handlerID, now
+		if err := tx.Update(orderRef, updates); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.LedgerEntryRefund, orderID, config.TreasuryAccountID, order.BuyerID, order.Price)
+	})
+	if err != nil {
+		log.Printf("Error marking order %s as %s: %v", orderID, newStatus, err)
+		return nil, err
+	}
+
+	order.ID = orderID
+	return &order, nil
+}
@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+)
+
+// StreakUpdate is the outcome of recording a day on which a user sent coins
+type StreakUpdate struct {
+	Days     int
+	Extended bool
+	Bonus    int
+}
+
+// ErrStreakBonusSpent is returned when undoing a transfer whose streak bonus its sender no longer has
+var ErrStreakBonusSpent = errors.New("streak bonus already spent")
+
+// RecordGivingDay atomically extends the user's giving streak for the local day of transfer sentAt
+// The transfer is remembered with the streak so undoing it rolls the day back
+// The streak is counted in timeZone, which is also saved for later streak checks;
+// an empty timeZone keeps the one already saved
+// When the streak reaches one of the milestones its bonus is paid from the treasury
+func RecordGivingDay(ctx context.Context, userID, transferID, timeZone string, sentAt time.Time, milestones []models.StreakMilestone) (*StreakUpdate, error) {
+	userRef := Client.Collection("users").Doc(userID)
+
+	var update StreakUpdate
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		update = StreakUpdate{}
+
+		doc, err := tx.Get(userRef)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			return err
+		}
+		if timeZone != "" {
+			user.TimeZone = timeZone
+		}
+
+		today := user.StreakDay(sentAt)
+		update.Days = user.ExtendStreak(sentAt)
+		if user.StreakLastDay == today {
+			// Already counted today
+			return nil
+		}
+		update.Extended = true
+		for _, milestone := range milestones {
+			if milestone.Days == update.Days {
+				update.Bonus += milestone.Bonus
+			}
+		}
+
+		updates := []firestore.Update{
+			{Path: "streak_days", Value: update.Days},
+			{Path: "streak_last_day", Value: today},
+			{Path: "time_zone", Value: user.TimeZone},
+			{Path: "streak_transfer_id", Value: transferID},
+			{Path: "streak_previous_days", Value: user.StreakDays},
+			{Path: "streak_previous_last_day", Value: user.StreakLastDay},
+			{Path: "streak_bonus", Value: update.Bonus},
+		}
+		if update.Bonus == 0 {
+			return tx.Update(userRef, updates)
+		}
+
+		updates = append(updates, firestore.Update{Path: "coins", Value: user.Coins + update.Bonus})
+		if err := tx.Update(userRef, updates); err != nil {
+			return err
+		}
+		if err := adjustSystemAccount(tx, config.TreasuryAccountID, -update.Bonus); err != nil {
+			return err
+		}
+		return postEntry(tx, models.LedgerEntryStreakBonus, userID,
+			models.Posting{AccountID: userID, Amount: update.Bonus},
+			models.Posting{AccountID: config.TreasuryAccountID, Amount: -update.Bonus},
+		)
+	})
+	if err != nil {
+		log.Printf("Error recording giving day of %s: %v", userID, err)
+		return nil, err
+	}
+
+	return &update, nil
+}
+
+// rollbackGivingDay works out, within the transaction reversing a transfer, how the reversal changes
+// the giving streak of the transfer's sender, and returns nil when the transfer didn't count a day
+// Another transfer sent the same local day then counts the day instead; otherwise the streak goes back
+// to what it was and the sender returns the milestone bonus the day paid, which is also returned
+func rollbackGivingDay(tx *firestore.Transaction, transfer *models.Transfer) (walletChange, int, error) {
+	doc, err := tx.Get(Client.Collection("users").Doc(transfer.SenderID))
+	if err != nil {
+		return nil, 0, err
+	}
+	var sender models.User
+	if err := doc.DataTo(&sender); err != nil {
+		return nil, 0, err
+	}
+	if sender.StreakTransferID != transfer.ID {
+		return nil, 0, nil
+	}
+
+	dayStart, err := time.ParseInLocation(models.StreakDayLayout, sender.StreakLastDay, sender.Location())
+	if err != nil {
+		return nil, 0, err
+	}
+	iter := tx.Documents(Client.Collection("transfers").
+		Where("sender_id", "==", sender.UserID).
+		Where("created_at", ">=", dayStart).
+		OrderBy("created_at", firestore.Asc))
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var other models.Transfer
+		if err := doc.DataTo(&other); err != nil {
+			return nil, 0, err
+		}
+		if doc.Ref.ID == transfer.ID || other.Type != models.TransferTypeTransfer || other.ReversedBy != "" ||
+			other.RecipientID == other.SenderID || sender.StreakDay(other.CreatedAt) != sender.StreakLastDay {
+			continue
+		}
+
+		otherID := doc.Ref.ID
+		return func(user *models.User) ([]firestore.Update, error) {
+			return []firestore.Update{{Path: "streak_transfer_id", Value: otherID}}, nil
+		}, 0, nil
+	}
+
+	bonus := sender.StreakBonus
+	return func(user *models.User) ([]firestore.Update, error) {
+		if user.Coins < bonus {
+			return nil, ErrStreakBonusSpent
+		}
+		user.Coins -= bonus
+		return []firestore.Update{
+			{Path: "streak_days", Value: sender.StreakPreviousDays},
+			{Path: "streak_last_day", Value: sender.StreakPreviousLastDay},
+			{Path: "streak_transfer_id", Value: ""},
+			{Path: "streak_previous_days", Value: 0},
+			{Path: "streak_previous_last_day", Value: ""},
+			{Path: "streak_bonus", Value: 0},
+		}, nil
+	}, bonus, nil
+}
+
+// GetStreakingUsers retrieves the users with a giving streak, including streaks that may have broken since
+func GetStreakingUsers(ctx context.Context) ([]models.User, error) {
+	iter := Client.Collection("users").
+		Where("streak_days", ">", 0).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var users []models.User
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating streaking users: %v", err)
+			return users, err
+		}
+
+		var user models.User
+		if err := doc.DataTo(&user); err != nil {
+			log.Printf("Error parsing user data: %v", err)
+			continue
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// MarkStreakWarned records that the user was warned about their streak on the given local day
+func MarkStreakWarned(ctx context.Context, userID, day string) error {
+	_, err := Client.Collection("users").Doc(userID).Update(ctx, []firestore.Update{
+		{Path: "streak_warned_day", Value: day},
+	})
+	if err != nil {
+		log.Printf("Error marking streak warning of %s: %v", userID, err)
+	}
+	return err
+}
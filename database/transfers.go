@@ -0,0 +1,494 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	// ErrInsufficientFunds is returned when a balance is too low to cover a transfer
+	ErrInsufficientFunds = errors.New("insufficient funds")
+
+	// ErrAlreadyReversed is returned when undoing a transfer that was already reversed
+	ErrAlreadyReversed = errors.New("transfer already reversed")
+
+	// ErrSenderFrozen is returned when the sending wallet is frozen
+	ErrSenderFrozen = errors.New("sender wallet is frozen")
+
+	// ErrRecipientFrozen is returned when the receiving wallet is frozen
+	ErrRecipientFrozen = errors.New("recipient wallet is frozen")
+)
+
+// Transfer atomically moves coins between two existing users and records the transfer
+func Transfer(ctx context.Context, transfer *models.Transfer) error {
+	senderRef := Client.Collection("users").Doc(transfer.SenderID)
+	recipientRef := Client.Collection("users").Doc(transfer.RecipientID)
+	transferRef := Client.Collection("transfers").NewDoc()
+
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var senderCounts, recipientCounts walletChange
+		var pair *models.GivingPair
+		if transfer.Counts() {
+			var err error
+			if pair, err = readGivingPair(tx, transfer.SenderID, transfer.RecipientID); err != nil {
+				return err
+			}
+			senderCounts, recipientCounts = countGiving(pair, 1)
+		}
+
+		lastSent := withUpdates(firestore.Update{Path: "last_sent_at", Value: transfer.CreatedAt})
+		if err := moveCoinsWith(tx, senderRef, recipientRef, transfer.Amount, combineChanges(lastSent, senderCounts), recipientCounts); err != nil {
+			return err
+		}
+		if pair != nil {
+			if err := tx.Set(givingPairRef(pair.SenderID, pair.RecipientID), pair); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(transferRef, transfer); err != nil {
+			return err
+		}
+		return postTransfer(tx, models.TransferTypeTransfer, transferRef.ID, transfer.SenderID, transfer.RecipientID, transfer.Amount)
+	})
+	if err != nil {
+		log.Printf("Error transferring %d from %s to %s: %v", transfer.Amount, transfer.SenderID, transfer.RecipientID, err)
+		return err
+	}
+
+	transfer.ID = transferRef.ID
+	return nil
+}
+
+// TransferToMany atomically records transfers from one sender to several distinct recipients
+// Either every transfer goes through or none does, so the sender must afford their total
+func TransferToMany(ctx context.Context, transfers []*models.Transfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	senderID := transfers[0].SenderID
+	senderRef := Client.Collection("users").Doc(senderID)
+
+	total := 0
+	recipientRefs := make([]*firestore.DocumentRef, len(transfers))
+	transferRefs := make([]*firestore.DocumentRef, len(transfers))
+	for i, transfer := range transfers {
+		total += transfer.Amount
+		recipientRefs[i] = Client.Collection("users").Doc(transfer.RecipientID)
+		transferRefs[i] = Client.Collection("transfers").NewDoc()
+	}
+
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		senderDoc, err := tx.Get(senderRef)
+		if err != nil {
+			return err
+		}
+		var sender models.User
+		if err := senderDoc.DataTo(&sender); err != nil {
+			return err
+		}
+		if sender.IsFrozen() {
+			return ErrSenderFrozen
+		}
+		if sender.Coins < total {
+			return ErrInsufficientFunds
+		}
+
+		recipientDocs, err := tx.GetAll(recipientRefs)
+		if err != nil {
+			return err
+		}
+		recipients := make([]models.User, len(recipientDocs))
+		for i, recipientDoc := range recipientDocs {
+			if err := recipientDoc.DataTo(&recipients[i]); err != nil {
+				return err
+			}
+			if recipients[i].IsFrozen() {
+				return ErrRecipientFrozen
+			}
+		}
+
+		pairs := make([]*models.GivingPair, len(transfers))
+		senderCounts := make([]walletChange, len(transfers))
+		recipientUpdates := make([][]firestore.Update, len(transfers))
+		for i, transfer := range transfers {
+			recipients[i].Coins += transfer.Amount
+			if !transfer.Counts() {
+				continue
+			}
+			if pairs[i], err = readGivingPair(tx, senderID, transfer.RecipientID); err != nil {
+				return err
+			}
+			var recipientCounts walletChange
+			senderCounts[i], recipientCounts = countGiving(pairs[i], 1)
+			if recipientUpdates[i], err = recipientCounts(&recipients[i]); err != nil {
+				return err
+			}
+		}
+
+		sender.Coins -= total
+		senderUpdates, err := combineChanges(senderCounts...)(&sender)
+		if err != nil {
+			return err
+		}
+		senderUpdates = append([]firestore.Update{
+			{Path: "coins", Value: sender.Coins},
+			{Path: "last_sent_at", Value: transfers[0].CreatedAt},
+		}, senderUpdates...)
+		if err := tx.Update(senderRef, senderUpdates); err != nil {
+			return err
+		}
+		for i, transfer := range transfers {
+			updates := append([]firestore.Update{{Path: "coins", Value: recipients[i].Coins}}, recipientUpdates[i]...)
+			if err := tx.Update(recipientRefs[i], updates); err != nil {
+				return err
+			}
+			if pairs[i] != nil {
+				if err := tx.Set(givingPairRef(senderID, transfer.RecipientID), pairs[i]); err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(transferRefs[i], transfer); err != nil {
+				return err
+			}
+			if err := postTransfer(tx, models.TransferTypeTransfer, transferRefs[i].ID, senderID, transfer.RecipientID, transfer.Amount); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error transferring %d from %s to %d recipients: %v", total, senderID, len(transfers), err)
+		return err
+	}
+
+	for i, transfer := range transfers {
+		transfer.ID = transferRefs[i].ID
+	}
+	return nil
+}
+
+// GetTransfer retrieves a recorded transfer by ID
+func GetTransfer(ctx context.Context, id string) (*models.Transfer, error) {
+	doc, err := Client.Collection("transfers").Doc(id).Get(ctx)
+	if err != nil {
+		log.Printf("Error getting transfer %s: %v", id, err)
+		return nil, err
+	}
+
+	var transfer models.Transfer
+	if err := doc.DataTo(&transfer); err != nil {
+		log.Printf("Error parsing transfer %s: %v", id, err)
+		return nil, err
+	}
+	transfer.ID = doc.Ref.ID
+
+	return &transfer, nil
+}
+
+// GetTransfersSince retrieves all transfers and reversals recorded after the given time, oldest first
+func GetTransfersSince(ctx context.Context, since time.Time) ([]models.Transfer, error) {
+	iter := Client.Collection("transfers").
+		Where("created_at", ">=", since).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var transfers []models.Transfer
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating transfers: %v", err)
+			return transfers, err
+		}
+
+		var transfer models.Transfer
+		if err := doc.DataTo(&transfer); err != nil {
+			log.Printf("Error parsing transfer %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		transfer.ID = doc.Ref.ID
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
+
+// GetTransfersBySenderSince retrieves the transfers sent by a user after the given time, oldest first
+// This query needs a composite index on sender_id and created_at
+func GetTransfersBySenderSince(ctx context.Context, senderID string, since time.Time) ([]models.Transfer, error) {
+	iter := Client.Collection("transfers").
+		Where("sender_id", "==", senderID).
+		Where("created_at", ">=", since).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx)
+	defer iter.Stop()
+
+	var transfers []models.Transfer
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Printf("Error iterating transfers of %s: %v", senderID, err)
+			return transfers, err
+		}
+
+		var transfer models.Transfer
+		if err := doc.DataTo(&transfer); err != nil {
+			log.Printf("Error parsing transfer %s: %v", doc.Ref.ID, err)
+			continue
+		}
+		transfer.ID = doc.Ref.ID
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, nil
+}
+
+// GetTransfersByRecipientSince retrieves the transfers received by a user after the given time, oldest first
+// This query needs a composite index on recipient_id and created_at
+func GetTransfersByRecipientSince(ctx context.Context, recipientID string, since time.Time) ([]models.Transfer, error) {
+	transfers, err := readTransfers(Client.Collection("transfers").
+		Where("recipient_id", "==", recipientID).
+		Where("created_at", ">=", since).
+		OrderBy("created_at", firestore.Asc).
+		Documents(ctx))
+	if err != nil {
+		log.Printf("Error iterating transfers to %s: %v", recipientID, err)
+	}
+	return transfers, err
+}
+
+// ReverseTransfer atomically sends the coins of a transfer back to its sender
+// The original transfer is kept and linked to a new reversal entry
+func ReverseTransfer(ctx context.Context, id string) (*models.Transfer, error) {
+	originalRef := Client.Collection("transfers").Doc(id)
+	reversalRef := Client.Collection("transfers").NewDoc()
+
+	var reversal models.Transfer
+	err := Client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(originalRef)
+		if err != nil {
+			return err
+		}
+
+		var original models.Transfer
+		if err := doc.DataTo(&original); err != nil {
+			return err
+		}
+		if original.ReversedBy != "" {
+			return ErrAlreadyReversed
+		}
+
+		original.ID = id
+		rollback, bonus, err := rollbackGivingDay(tx, &original)
+		if err != nil {
+			return err
+		}
+		var senderCounts, recipientCounts walletChange
+		var pair *models.GivingPair
+		if original.Counts() {
+			if pair, err = readGivingPair(tx, original.SenderID, original.RecipientID); err != nil {
+				return err
+			}
+			senderCounts, recipientCounts = countGiving(pair, -1)
+		}
+		senderRef := Client.Collection("users").Doc(original.RecipientID)
+		recipientRef := Client.Collection("users").Doc(original.SenderID)
+		// The reversal sends the coins back, so the original recipient is its sender
+		if err := moveCoinsWith(tx, senderRef, recipientRef, original.Amount, recipientCounts, combineChanges(rollback, senderCounts)); err != nil {
+			return err
+		}
+		if pair != nil {
+			if err := tx.Set(givingPairRef(pair.SenderID, pair.RecipientID), pair); err != nil {
+				return err
+			}
+		}
+		if bonus > 0 {
+			if err := adjustSystemAccount(tx, config.TreasuryAccountID, bonus); err != nil {
+				return err
+			}
+			if err := postEntry(tx, models.LedgerEntryStreakBonusReversal, id,
+				models.Posting{AccountID: original.SenderID, Amount: -bonus},
+				models.Posting{AccountID: config.TreasuryAccountID, Amount: bonus},
+			); err != nil {
+				return err
+			}
+		}
+
+		reversal = models.Transfer{
+			Type:        models.TransferTypeReversal,
+			SenderID:    original.RecipientID,
+			RecipientID: original.SenderID,
+			Amount:      original.Amount,
+			ReversalOf:  id,
+			CreatedAt:   time.Now(),
+		}
+		if err := tx.Create(reversalRef, &reversal); err != nil {
+			return err
+		}
+		if err := postTransfer(tx, models.TransferTypeReversal, reversalRef.ID, reversal.SenderID, reversal.RecipientID, reversal.Amount); err != nil {
+			return err
+		}
+		return tx.Update(originalRef, []firestore.Update{
+			{Path: "reversed_by", Value: reversalRef.ID},
+		})
+	})
+	if err != nil {
+		log.Printf("Error reversing transfer %s: %v", id, err)
+		return nil, err
+	}
+
+	reversal.ID = reversalRef.ID
+	return &reversal, nil
+}
+
+// moveCoins debits sender and credits recipient within a transaction, applying any extra sender updates
+// Frozen wallets can neither send nor receive
+// All reads happen before any write, as Firestore transactions require
+func moveCoins(tx *firestore.Transaction, senderRef, recipientRef *firestore.DocumentRef, amount int, senderUpdates ...firestore.Update) error {
+	return moveCoinsWith(tx, senderRef, recipientRef, amount, withUpdates(senderUpdates...), nil)
+}
+
+// walletChange changes a wallet read within a transaction, adjusting user.Coins in place, and returns
+// the updates of its other fields
+type walletChange func(user *models.User) ([]firestore.Update, error)
+
+// withUpdates returns a change that only applies the given updates
+func withUpdates(updates ...firestore.Update) walletChange {
+	return func(user *models.User) ([]firestore.Update, error) {
+		return updates, nil
+	}
+}
+
+// combineChanges returns a change applying each of the changes in order, skipping nil ones
+func combineChanges(changes ...walletChange) walletChange {
+	return func(user *models.User) ([]firestore.Update, error) {
+		var updates []firestore.Update
+		for _, change := range changes {
+			if change == nil {
+				continue
+			}
+			more, err := change(user)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, more...)
+		}
+		return updates, nil
+	}
+}
+
+// moveCoinsWith is moveCoins with changes applied to the debited sender and the credited recipient
+// in the same writes; either change may be nil
+func moveCoinsWith(tx *firestore.Transaction, senderRef, recipientRef *firestore.DocumentRef, amount int, senderChange, recipientChange walletChange) error {
+	senderDoc, err := tx.Get(senderRef)
+	if err != nil {
+		return err
+	}
+
+	var sender models.User
+	if err := senderDoc.DataTo(&sender); err != nil {
+		return err
+	}
+	if sender.IsFrozen() {
+		return ErrSenderFrozen
+	}
+	if sender.Coins < amount {
+		return ErrInsufficientFunds
+	}
+
+	// Sending to yourself leaves the balance unchanged
+	if senderRef.ID == recipientRef.ID {
+		return nil
+	}
+
+	recipientDoc, err := tx.Get(recipientRef)
+	if err != nil {
+		return err
+	}
+
+	var recipient models.User
+	if err := recipientDoc.DataTo(&recipient); err != nil {
+		return err
+	}
+	if recipient.IsFrozen() {
+		return ErrRecipientFrozen
+	}
+
+	sender.Coins -= amount
+	recipient.Coins += amount
+	senderUpdates, err := combineChanges(senderChange)(&sender)
+	if err != nil {
+		return err
+	}
+	recipientUpdates, err := combineChanges(recipientChange)(&recipient)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Update(senderRef, append([]firestore.Update{{Path: "coins", Value: sender.Coins}}, senderUpdates...)); err != nil {
+		return err
+	}
+	return tx.Update(recipientRef, append([]firestore.Update{{Path: "coins", Value: recipient.Coins}}, recipientUpdates...))
+}
+
+// postTransfer records the ledger entry of coins moved with moveCoins
+func postTransfer(tx *firestore.Transaction, entryType, reference, senderID, recipientID string, amount int) error {
+	return postEntry(tx, entryType, reference,
+		models.Posting{AccountID: senderID, Amount: -amount},
+		models.Posting{AccountID: recipientID, Amount: amount},
+	)
+}
+
+// CreatePendingTransfer stores a transfer awaiting confirmation and returns its ID
+func CreatePendingTransfer(ctx context.Context, pending *models.PendingTransfer) (string, error) {
+	ref := Client.Collection("pending_transfers").NewDoc()
+	if _, err := ref.Set(ctx, pending); err != nil {
+		log.Printf("Error creating pending transfer for %s: %v", pending.Transfer.SenderID, err)
+		return "", err
+	}
+
+	pending.ID = ref.ID
+	return ref.ID, nil
+}
+
+// GetPendingTransfer retrieves a pending transfer by ID
+func GetPendingTransfer(ctx context.Context, id string) (*models.PendingTransfer, error) {
+	doc, err := Client.Collection("pending_transfers").Doc(id).Get(ctx)
+	if err != nil {
+		log.Printf("Error getting pending transfer %s: %v", id, err)
+		return nil, err
+	}
+
+	var pending models.PendingTransfer
+	if err := doc.DataTo(&pending); err != nil {
+		log.Printf("Error parsing pending transfer %s: %v", id, err)
+		return nil, err
+	}
+	pending.ID = doc.Ref.ID
+
+	return &pending, nil
+}
+
+// DeletePendingTransfer removes a pending transfer
+// It fails if the transfer was already removed, so only one caller can claim it
+func DeletePendingTransfer(ctx context.Context, id string) error {
+	_, err := Client.Collection("pending_transfers").Doc(id).Delete(ctx, firestore.Exists)
+	if err != nil {
+		log.Printf("Error deleting pending transfer %s: %v", id, err)
+		return err
+	}
+	return nil
+}
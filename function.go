@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"cloud.google.com/go/firestore"
 	"github.com/GoogleCloudPlatform/functions-framework-go/functions"
@@ -22,10 +24,27 @@ func init() {
 	// Load configuration from environment variables
 	config.SlackBotToken = os.Getenv("SLACK_BOT_TOKEN")
 	config.SlackSigningSecret = os.Getenv("SLACK_SIGNING_SECRET")
+	config.SchedulerToken = os.Getenv("SCHEDULER_TOKEN")
+	config.DigestChannel = os.Getenv("DIGEST_CHANNEL")
+	config.AdminLogChannel = os.Getenv("ADMIN_LOG_CHANNEL")
+	if teamID := os.Getenv("SLACK_TEAM_ID"); teamID != "" {
+		config.DefaultWorkspaceID = teamID
+	}
+	for _, adminID := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if adminID = strings.TrimSpace(adminID); adminID != "" {
+			config.AdminUserIDs = append(config.AdminUserIDs, adminID)
+		}
+	}
 
 	if config.SlackSigningSecret == "" {
 		log.Println("WARNING: SLACK_SIGNING_SECRET environment variable is not set")
 	}
+	if os.Getenv("SLACK_TEAM_ID") == "" {
+		log.Println("WARNING: SLACK_TEAM_ID environment variable is not set; scheduled jobs and signature checks use the default settings, not the ones admins change")
+	}
+
+	loadIntEnv("LARGE_TRANSFER_THRESHOLD", &config.LargeTransferThreshold)
+	loadIntEnv("UNDO_WINDOW_MINUTES", &config.UndoWindowMinutes)
 
 	// Initialize Firestore client
 	ctx := context.Background()
@@ -53,9 +72,26 @@ func init() {
 	// Register HTTP functions with Gin handlers wrapped for Cloud Functions
 	functions.HTTP("SlackCommandGo", ginToHTTPHandler(handlers.SlackCommand))
 	functions.HTTP("SlackEventsGo", ginToHTTPHandler(handlers.SlackEvents))
+	functions.HTTP("SlackInteractionsGo", ginToHTTPHandler(handlers.SlackInteractions))
+	functions.HTTP("ScheduledJobsGo", ginToHTTPHandler(handlers.ScheduledJob))
 	log.Println("HTTP functions registered")
 }
 
+// loadIntEnv overrides target with the positive integer in the named environment variable, if set
+func loadIntEnv(name string, target *int) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("WARNING: invalid %s %q, using default %d", name, raw, *target)
+		return
+	}
+	*target = value
+}
+
 // ginToHTTPHandler wraps a Gin handler to work with Cloud Functions
 func ginToHTTPHandler(ginHandler gin.HandlerFunc) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -13,6 +13,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/unacorbatanegra/corbacoin-bot/commands"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
 	"github.com/unacorbatanegra/corbacoin-bot/models"
 	"github.com/unacorbatanegra/corbacoin-bot/slack"
 )
@@ -30,7 +32,7 @@ func SlackCommand(c *gin.Context) {
 	log.Println("SlackCommand body: " + string(body))
 
 	// Verify Slack signature
-	if !slack.VerifySignature(c.Request, body) {
+	if !verifySignature(c, body) {
 		log.Println("Unauthorized: signature verification failed")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
@@ -47,12 +49,24 @@ func SlackCommand(c *gin.Context) {
 	userID := c.Request.FormValue("user_id")
 	userName := c.Request.FormValue("user_name")
 	responseURL := c.Request.FormValue("response_url")
+	channelID := c.Request.FormValue("channel_id")
+	teamID := c.Request.FormValue("team_id")
 
 	// Send immediate acknowledgment
 	acknowledgments := map[string]string{
 		"/balance":     "⏳ Checking your balance...",
 		"/send":        "⏳ Processing transfer...",
 		"/leaderboard": "⏳ Loading leaderboard...",
+		"/corbacoin":   "⏳ Processing...",
+		"/shop":        "⏳ Opening the shop...",
+		"/buy":         "⏳ Processing purchase...",
+		"/bet":         "⏳ Processing...",
+		"/raffle":      "⏳ Processing...",
+		"/pot":         "⏳ Processing...",
+		"/rain":        "⏳ Making it rain...",
+		"/lend":        "⏳ Processing...",
+		"/repay":       "⏳ Processing repayment...",
+		"/loans":       "⏳ Loading your loans...",
 	}
 
 	ack := acknowledgments[command]
@@ -65,48 +79,211 @@ func SlackCommand(c *gin.Context) {
 		ResponseType: "ephemeral",
 	})
 
+	responder := slack.Responder{
+		ResponseURL: responseURL,
+		ChannelID:   channelID,
+		UserID:      userID,
+	}
+
 	// Process command in background
 	go func() {
-		ctx := context.Background()
+		ctx := config.WithWorkspace(context.Background(), teamID)
+
+		// Admin commands work everywhere so admins can always change the channel settings
+		settings := database.GetSettings(ctx)
+		isAdminCommand := command == "/corbacoin" && strings.HasPrefix(strings.ToLower(strings.TrimSpace(text)), "admin")
+		if !settings.IsChannelAllowed(channelID) && !isAdminCommand {
+			responder.RespondError("Corbacoin is not enabled in this channel.")
+			return
+		}
+
+		// Quiet channels only get private results
+		quiet := settings.IsQuietChannel(channelID)
 
 		switch command {
 		case "/balance":
+			_, public := commands.ParseVisibility(text, true)
+			public = public && !quiet
 			message, err := commands.HandleBalance(ctx, userID, userName)
 			if err != nil {
-				slack.SendErrorResponse(responseURL, "An error occurred. Please try again later.", userID)
+				responder.RespondError("An error occurred. Please try again later.")
 				return
 			}
-			slack.SendResponse(responseURL, message, "in_channel")
+			responder.Respond(message, nil, public)
 
 		case "/send":
 			log.Println("Send command received: " + text)
-			recipientIdentifier, amount, ok := commands.ParseSendCommand(text)
-			if !ok {
-				slack.SendErrorResponse(responseURL, "Usage: `/send @user amount`", userID)
+			sendText, public := commands.ParseVisibility(text, true)
+			public = public && !quiet
+			target, amount, memo, err := commands.ResolveSendTarget(sendText)
+			if errors.Is(err, commands.ErrSendUsage) {
+				responder.RespondError("Usage: `/send @user|@group amount [memo] [--private]`")
 				return
 			}
-
-			// Get recipient user info from Slack (works with both user_id and username)
-			recipientInfo, err := slack.GetOrFindUser(recipientIdentifier)
 			if err != nil {
-				slack.SendErrorResponse(responseURL, fmt.Sprintf("Could not find user '%s'. %v", recipientIdentifier, err), userID)
+				responder.RespondError(err.Error())
 				return
 			}
 
-			result := commands.HandleSend(ctx, userID, userName, recipientInfo.ID, recipientInfo.Name, amount)
-			if result.Success {
-				slack.SendResponse(responseURL, result.Message, "in_channel")
+			req := models.TransferRequest{
+				SenderID:   userID,
+				SenderName: userName,
+				Amount:     amount,
+				Memo:       memo,
+				Channel:    channelID,
+			}
+			var result models.CommandResult
+			if target.GroupID != "" {
+				result = commands.HandleGroupSend(ctx, req, target.GroupID)
 			} else {
-				slack.SendErrorResponse(responseURL, result.Message, userID)
+				req.RecipientID, req.RecipientName = target.User.ID, target.User.Name
+				result = commands.HandleSend(ctx, req)
+			}
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			// Large transfer prompts are always private
+			responder.Respond(result.Message, result.Blocks, public && !result.Ephemeral)
+			if public && !result.Ephemeral {
+				commands.MirrorAnnouncement(ctx, channelID, result.Message)
 			}
 
 		case "/leaderboard":
-			message, err := commands.HandleLeaderboard(ctx)
+			leaderboardText, public := commands.ParseVisibility(text, true)
+			public = public && !quiet
+			message, err := commands.HandleLeaderboard(ctx, leaderboardText)
 			if err != nil {
-				slack.SendErrorResponse(responseURL, "An error occurred. Please try again later.", userID)
+				responder.RespondError("An error occurred. Please try again later.")
+				return
+			}
+			responder.Respond(message, nil, public)
+
+		case "/shop":
+			result, err := commands.HandleShop(ctx)
+			if err != nil {
+				responder.RespondError("An error occurred. Please try again later.")
+				return
+			}
+			responder.Respond(result.Message, result.Blocks, false)
+
+		case "/buy":
+			result := commands.HandleBuy(ctx, userID, userName, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, nil, false)
+
+		case "/bet":
+			result := commands.HandleBet(ctx, userID, userName, channelID, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, result.Blocks, !result.Ephemeral && !quiet)
+
+		case "/raffle":
+			result := commands.HandleRaffle(ctx, userID, userName, channelID, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, nil, !result.Ephemeral && !quiet)
+
+		case "/pot":
+			result := commands.HandlePot(ctx, userID, userName, channelID, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, result.Blocks, !result.Ephemeral && !quiet)
+
+		case "/rain":
+			result := commands.HandleRain(ctx, userID, userName, channelID, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
 				return
 			}
-			slack.SendResponse(responseURL, message, "in_channel")
+			// Large rain prompts are always private
+			public := !result.Ephemeral && !quiet
+			responder.Respond(result.Message, result.Blocks, public)
+			if public {
+				commands.MirrorAnnouncement(ctx, channelID, result.Message)
+			}
+
+		case "/lend":
+			result := commands.HandleLend(ctx, userID, userName, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, nil, false)
+
+		case "/repay":
+			result := commands.HandleRepay(ctx, userID, userName, text)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, nil, false)
+
+		case "/loans":
+			result := commands.HandleLoans(ctx, userID)
+			if !result.Success {
+				responder.RespondError(result.Message)
+				return
+			}
+			responder.Respond(result.Message, nil, false)
+
+		case "/corbacoin":
+			args := strings.Fields(text)
+			if len(args) == 0 {
+				responder.Respond(commands.GetHelpMessage(false), nil, false)
+				return
+			}
+
+			switch strings.ToLower(args[0]) {
+			case "notifications":
+				mode := ""
+				if len(args) > 1 {
+					mode = args[1]
+				}
+				result := commands.HandleNotifications(ctx, userID, userName, mode)
+				if !result.Success {
+					responder.RespondError(result.Message)
+					return
+				}
+				responder.Respond(result.Message, nil, false)
+
+			case "stats":
+				_, public := commands.ParseVisibility(strings.Join(args[1:], " "), false)
+				result, err := commands.HandleStats(ctx)
+				if err != nil {
+					responder.RespondError("An error occurred. Please try again later.")
+					return
+				}
+				responder.Respond(result.Message, result.Blocks, public && !quiet)
+
+			case "profile":
+				result := commands.HandleProfile(ctx, userID, userName, strings.Join(args[1:], " "))
+				if !result.Success {
+					responder.RespondError(result.Message)
+					return
+				}
+				responder.Respond(result.Message, result.Blocks, false)
+
+			case "admin":
+				result := commands.HandleAdmin(ctx, userID, strings.Join(args[1:], " "))
+				if !result.Success {
+					responder.RespondError(result.Message)
+					return
+				}
+				responder.Respond(result.Message, nil, false)
+
+			default:
+				responder.Respond(commands.GetHelpMessage(false), nil, false)
+			}
 		}
 	}()
 }
@@ -124,7 +301,7 @@ func SlackEvents(c *gin.Context) {
 
 	log.Println("SlackEvents body: " + string(body))
 	// Verify Slack signature
-	if !slack.VerifySignature(c.Request, body) {
+	if !verifySignature(c, body) {
 		log.Println("Unauthorized: signature verification failed")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
@@ -152,19 +329,29 @@ func SlackEvents(c *gin.Context) {
 
 	// Process event in background
 	go func() {
-		ctx := context.Background()
+		ctx := config.WithWorkspace(context.Background(), payload.TeamID)
 		event := payload.Event
 
 		log.Printf("Event type: %s", event.Type)
 		log.Println("Body: " + string(body))
 
+		// Ignore messages posted by bots, including our own
+		if event.BotID != "" {
+			return
+		}
+
+		if event.Type == "team_join" && event.Member != nil {
+			commands.WelcomeMember(ctx, event.Member)
+			return
+		}
+
 		if event.Type == "app_mention" || event.Type == "message" {
 			channel := event.Channel
 			threadTS := event.ThreadTS
 			if threadTS == "" {
 				threadTS = event.TS
 			}
-			userName := event.User
+			userID := event.User
 
 			// Remove ONLY the first bot mention (not all mentions, as we need recipient mentions)
 			re := regexp.MustCompile(`<@[A-Z0-9]+>\s*`)
@@ -182,16 +369,41 @@ func SlackEvents(c *gin.Context) {
 			}
 
 			command := strings.ToLower(parts[0])
-			log.Printf("App mention received: command=%s, user=%s, channel=%s, fullText=%s", command, userName, channel, text)
+			log.Printf("App mention received: command=%s, user=%s, channel=%s, fullText=%s", command, userID, channel, text)
+
+			// Admin commands work everywhere so admins can always change the channel settings
+			settings := database.GetSettings(ctx)
+			if !settings.IsChannelAllowed(channel) && command != "admin" {
+				// Only explicit mentions get an answer; plain channel messages are not meant for the bot
+				if event.Type == "app_mention" {
+					slack.SendEphemeral(channel, userID, "Corbacoin is not enabled in this channel.", threadTS, nil)
+				}
+				return
+			}
+
+			// Wallets are named after the sender's Slack username, as with slash commands. Events don't
+			// carry it, and an empty name makes GetUser fetch it from Slack only when it creates the wallet,
+			// falling back to the user ID
+			userName := ""
+
+			// Quiet channels only get answers the user can see
+			quiet := settings.IsQuietChannel(channel)
+			reply := func(message string, blocks []models.Block) {
+				if quiet {
+					slack.SendEphemeral(channel, userID, message, threadTS, blocks)
+					return
+				}
+				slack.SendBlocksMessage(channel, message, threadTS, blocks)
+			}
 
 			switch command {
 			case "balance":
-				message, err := commands.HandleBalance(ctx, userName, userName)
+				message, err := commands.HandleBalance(ctx, userID, userName)
 				if err != nil {
 					log.Printf("Error handling balance: %v", err)
 					return
 				}
-				slack.SendMessage(channel, message, threadTS)
+				reply(message, nil)
 
 			case "send":
 				// Extract everything after the "send" command
@@ -204,37 +416,155 @@ func SlackEvents(c *gin.Context) {
 					}
 				}
 				
-				recipientIdentifier, amount, ok := commands.ParseSendCommand(sendText)
-				if !ok {
-					slack.SendMessage(channel, "Usage: `@CorbacoinBot send @user amount`", threadTS)
+				target, amount, memo, err := commands.ResolveSendTarget(sendText)
+				if errors.Is(err, commands.ErrSendUsage) {
+					reply("Usage: `@CorbacoinBot send @user|@group amount [memo]`", nil)
 					return
 				}
-
-				// Get recipient user info from Slack (works with both user_id and username)
-				recipientInfo, err := slack.GetOrFindUser(recipientIdentifier)
 				if err != nil {
-					slack.SendMessage(channel, fmt.Sprintf("Could not find user '%s'. %v", recipientIdentifier, err), threadTS)
+					reply(err.Error(), nil)
 					return
 				}
 
-				result := commands.HandleSend(ctx, userName, userName, recipientInfo.ID, recipientInfo.Name, amount)
-				slack.SendMessage(channel, result.Message, threadTS)
+				req := models.TransferRequest{
+					SenderID:   userID,
+					SenderName: userName,
+					Amount:     amount,
+					Memo:       memo,
+					Channel:    channel,
+					ThreadTS:   threadTS,
+				}
+				var result models.CommandResult
+				if target.GroupID != "" {
+					result = commands.HandleGroupSend(ctx, req, target.GroupID)
+				} else {
+					req.RecipientID, req.RecipientName = target.User.ID, target.User.Name
+					result = commands.HandleSend(ctx, req)
+				}
+				if result.Ephemeral {
+					// Large transfers wait for the sender to confirm
+					slack.SendEphemeral(channel, userID, result.Message, threadTS, result.Blocks)
+					return
+				}
+				reply(result.Message, result.Blocks)
+				if result.Success && !quiet {
+					commands.MirrorAnnouncement(ctx, channel, result.Message)
+				}
 
 			case "leaderboard":
-				message, err := commands.HandleLeaderboard(ctx)
+				message, err := commands.HandleLeaderboard(ctx, strings.Join(parts[1:], " "))
 				if err != nil {
 					log.Printf("Error handling leaderboard: %v", err)
 					return
 				}
-				slack.SendMessage(channel, message, threadTS)
+				reply(message, nil)
+
+			case "notifications":
+				mode := ""
+				if len(parts) > 1 {
+					mode = parts[1]
+				}
+				result := commands.HandleNotifications(ctx, userID, userName, mode)
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
+
+			case "stats":
+				result, err := commands.HandleStats(ctx)
+				if err != nil {
+					log.Printf("Error handling stats: %v", err)
+					return
+				}
+				reply(result.Message, result.Blocks)
+
+			case "profile":
+				result := commands.HandleProfile(ctx, userID, "", strings.Join(parts[1:], " "))
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, result.Blocks)
+
+			case "admin":
+				result := commands.HandleAdmin(ctx, userID, strings.Join(parts[1:], " "))
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
+
+			case "shop":
+				result, err := commands.HandleShop(ctx)
+				if err != nil {
+					log.Printf("Error handling shop: %v", err)
+					return
+				}
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, result.Blocks)
+
+			case "buy":
+				result := commands.HandleBuy(ctx, userID, userName, strings.Join(parts[1:], " "))
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
+
+			case "bet":
+				result := commands.HandleBet(ctx, userID, userName, channel, strings.Join(parts[1:], " "))
+				if result.Ephemeral || !result.Success {
+					slack.SendEphemeral(channel, userID, result.Message, threadTS, result.Blocks)
+					return
+				}
+				reply(result.Message, result.Blocks)
+
+			case "raffle":
+				result := commands.HandleRaffle(ctx, userID, userName, channel, strings.Join(parts[1:], " "))
+				if result.Ephemeral || !result.Success {
+					slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
+					return
+				}
+				reply(result.Message, nil)
+
+			case "pot":
+				result := commands.HandlePot(ctx, userID, userName, channel, strings.Join(parts[1:], " "))
+				if result.Ephemeral || !result.Success {
+					slack.SendEphemeral(channel, userID, result.Message, threadTS, result.Blocks)
+					return
+				}
+				reply(result.Message, result.Blocks)
+
+			case "rain":
+				result := commands.HandleRain(ctx, userID, userName, channel, strings.Join(parts[1:], " "))
+				if result.Ephemeral || !result.Success {
+					slack.SendEphemeral(channel, userID, result.Message, threadTS, result.Blocks)
+					return
+				}
+				reply(result.Message, result.Blocks)
+				if !quiet {
+					commands.MirrorAnnouncement(ctx, channel, result.Message)
+				}
+
+			case "lend":
+				result := commands.HandleLend(ctx, userID, userName, strings.Join(parts[1:], " "))
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
+
+			case "repay":
+				result := commands.HandleRepay(ctx, userID, userName, strings.Join(parts[1:], " "))
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
+
+			case "loans":
+				result := commands.HandleLoans(ctx, userID)
+				slack.SendEphemeral(channel, userID, result.Message, threadTS, nil)
 
 			case "help":
 				message := commands.GetHelpMessage(true)
-				slack.SendMessage(channel, message, threadTS)
+				reply(message, nil)
 
 			default:
-				slack.SendMessage(channel, "Unknown command. Try `@CorbacoinBot help` for available commands.", threadTS)
+				reply("Unknown command. Try `@CorbacoinBot help` for available commands.", nil)
 			}
 		}
 	}()
 }
+
+// verifySignature checks the Slack signature of a request using the configured timestamp tolerance
+// The signature is checked with the largest tolerance first, so settings are only read for authentic
+// requests. The request's workspace is unknown until then, so the default workspace's settings apply
+func verifySignature(c *gin.Context, body []byte) bool {
+	if !slack.VerifySignature(c.Request, body, config.MaxRequestTimestampTolerance) {
+		return false
+	}
+
+	tolerance := database.GetSettings(c.Request.Context()).RequestTimestampTolerance
+	if slack.RequestAge(c.Request) > int64(tolerance) {
+		log.Println("Request timestamp is too old")
+		return false
+	}
+	return true
+}
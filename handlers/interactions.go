@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unacorbatanegra/corbacoin-bot/commands"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// SlackInteractions handles Slack interactive component callbacks such as button clicks
+func SlackInteractions(c *gin.Context) {
+	// Read body for signature verification
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+	// Verify Slack signature
+	if !verifySignature(c, body) {
+		log.Println("Unauthorized: signature verification failed")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Interaction payloads arrive as JSON in the "payload" form field
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request"})
+		return
+	}
+
+	var payload models.SlackInteractionPayload
+	if err := json.Unmarshal([]byte(c.Request.FormValue("payload")), &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bad Request"})
+		return
+	}
+
+	log.Printf("Slack interaction received: type=%s, user=%s, actions=%d", payload.Type, payload.User.ID, len(payload.Actions))
+
+	// Acknowledge receipt
+	c.Status(http.StatusOK)
+
+	// Process actions in background
+	go func() {
+		ctx := config.WithWorkspace(context.Background(), payload.Team.ID)
+
+		for _, action := range payload.Actions {
+			switch action.ActionID {
+			case commands.ActionConfirmTransfer:
+				result, transfer := commands.ConfirmTransfer(ctx, action.Value, payload.User.ID)
+				if !result.Success {
+					slack.ReplaceOriginal(payload.ResponseURL, "❌ "+result.Message)
+					continue
+				}
+
+				// Quiet channels keep the outcome private
+				if database.GetSettings(ctx).IsQuietChannel(transfer.Channel) {
+					slack.PostResponse(payload.ResponseURL, models.SlackResponse{
+						Text:            result.Message,
+						Blocks:          result.Blocks,
+						ReplaceOriginal: true,
+					})
+					continue
+				}
+
+				// Swap the private prompt for a public announcement of the transfer
+				slack.DeleteOriginal(payload.ResponseURL)
+				if transfer.ThreadTS != "" {
+					slack.SendBlocksMessage(transfer.Channel, result.Message, transfer.ThreadTS, result.Blocks)
+				} else {
+					slack.SendBlocksResponse(payload.ResponseURL, result.Message, "in_channel", result.Blocks)
+				}
+				commands.MirrorAnnouncement(ctx, transfer.Channel, result.Message)
+
+			case commands.ActionCancelTransfer:
+				result := commands.CancelTransfer(ctx, action.Value, payload.User.ID)
+				if !result.Success {
+					slack.ReplaceOriginal(payload.ResponseURL, "❌ "+result.Message)
+					continue
+				}
+				slack.ReplaceOriginal(payload.ResponseURL, result.Message)
+
+			case commands.ActionUndoTransfer:
+				result := commands.UndoTransfer(ctx, action.Value, payload.User.ID)
+				if !result.Success {
+					slack.SendErrorResponse(payload.ResponseURL, result.Message, payload.User.ID)
+					continue
+				}
+
+				// Mark the original announcement as reverted, falling back to chat.update
+				if err := slack.ReplaceOriginal(payload.ResponseURL, result.Message); err != nil {
+					log.Printf("Error replacing original message, trying chat.update: %v", err)
+					if err := slack.UpdateMessage(payload.Container.ChannelID, payload.Container.MessageTS, result.Message, nil); err != nil {
+						log.Printf("Error updating reverted transfer message: %v", err)
+					}
+				}
+
+			case commands.ActionBuyItem:
+				result := commands.HandleBuy(ctx, payload.User.ID, payload.User.Username, action.Value)
+				if !result.Success {
+					slack.SendErrorResponse(payload.ResponseURL, result.Message, payload.User.ID)
+					continue
+				}
+				slack.SendResponse(payload.ResponseURL, result.Message, "ephemeral")
+
+			case commands.ActionDeliverOrder, commands.ActionRefundOrder:
+				handle := commands.DeliverOrder
+				if action.ActionID == commands.ActionRefundOrder {
+					handle = commands.RefundOrder
+				}
+				result := handle(ctx, action.Value, payload.User.ID)
+				if !result.Success {
+					slack.SendErrorResponse(payload.ResponseURL, result.Message, payload.User.ID)
+					continue
+				}
+				// Replace the request so its buttons can't be used again
+				slack.ReplaceOriginal(payload.ResponseURL, result.Message)
+
+			case commands.ActionAcceptLoan, commands.ActionDeclineLoan:
+				handle := commands.AcceptLoan
+				if action.ActionID == commands.ActionDeclineLoan {
+					handle = commands.DeclineLoan
+				}
+				result := handle(ctx, action.Value, payload.User.ID)
+				if !result.Success {
+					slack.SendErrorResponse(payload.ResponseURL, result.Message, payload.User.ID)
+					continue
+				}
+				// Replace the offer so its buttons can't be used again
+				slack.ReplaceOriginal(payload.ResponseURL, result.Message)
+
+			default:
+				log.Printf("Unknown interaction action: %s", action.ActionID)
+			}
+		}
+	}()
+}
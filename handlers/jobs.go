@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/unacorbatanegra/corbacoin-bot/commands"
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+)
+
+// ScheduledJobs maps the job names accepted by ScheduledJob to their implementation
+var ScheduledJobs = map[string]func(context.Context) error{
+	"notification-summary": commands.SendNotificationSummaries,
+	"weekly-digest":        commands.PostWeeklyDigest,
+	"demurrage":            commands.ApplyDemurrage,
+	"ledger-open":          commands.OpenLedger,
+	"ledger-check":         commands.CheckLedger,
+	"raffle-draw":          commands.DrawDueRaffles,
+	"streak-warning":       commands.WarnBreakingStreaks,
+	"pot-refund":           commands.RefundExpiredPots,
+	"loan-reminders":       commands.SendLoanReminders,
+	"payroll":              commands.RunPayrolls,
+}
+
+// ScheduledJob runs a periodic job, triggered by Cloud Scheduler
+// The job is selected with the "job" query parameter and the caller must present
+// config.SchedulerToken in the X-Scheduler-Token header
+func ScheduledJob(c *gin.Context) {
+	token := c.GetHeader("X-Scheduler-Token")
+	if config.SchedulerToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.SchedulerToken)) != 1 {
+		log.Println("Unauthorized: invalid scheduler token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	name := c.Query("job")
+	job, ok := ScheduledJobs[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown job"})
+		return
+	}
+
+	// Run synchronously so the function stays alive until the job is done
+	log.Printf("Running scheduled job: %s", name)
+	if err := job(c.Request.Context()); err != nil {
+		log.Printf("Scheduled job %s failed: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("Scheduled job %s finished", name)
+	c.JSON(http.StatusOK, gin.H{"job": name, "status": "ok"})
+}
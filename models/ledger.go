@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// Ledger entry types that have no matching transfer or admin action type
+const (
+	// LedgerEntryIssue grants a new wallet its initial coins from the treasury
+	LedgerEntryIssue = "issue"
+	// LedgerEntryOpening records the balances that existed before the ledger was introduced
+	LedgerEntryOpening = "opening"
+	// LedgerEntrySeasonReset resets wallets to the starting balance of a new season
+	LedgerEntrySeasonReset = "season-reset"
+	// LedgerEntryPurchase pays the treasury for a shop item
+	LedgerEntryPurchase = "purchase"
+	// LedgerEntryRefund returns the price of a shop order to its buyer
+	LedgerEntryRefund = "refund"
+	// LedgerEntryStake puts a user's stake on a prediction market in escrow
+	LedgerEntryStake = "stake"
+	// LedgerEntryPayout pays a resolved market's pot from escrow to its winners
+	LedgerEntryPayout = "payout"
+	// LedgerEntryStakeRefund returns the stakes of a cancelled market from escrow
+	LedgerEntryStakeRefund = "stake-refund"
+	// LedgerEntryTicket puts the price of raffle tickets in escrow
+	LedgerEntryTicket = "ticket"
+	// LedgerEntryRafflePayout pays a raffle's pot from escrow to its winner, minus the treasury's cut
+	LedgerEntryRafflePayout = "raffle-payout"
+	// LedgerEntryTicketRefund returns the price of the tickets of a cancelled raffle from escrow
+	LedgerEntryTicketRefund = "ticket-refund"
+	// LedgerEntryStreakBonus pays the bonus of a giving streak milestone from the treasury
+	LedgerEntryStreakBonus = "streak-bonus"
+	// LedgerEntryStreakBonusReversal returns a streak bonus to the treasury when the transfer that earned it is undone
+	LedgerEntryStreakBonusReversal = "streak-bonus-reversal"
+	// LedgerEntryContribution puts a contribution to a pot in escrow
+	LedgerEntryContribution = "contribution"
+	// LedgerEntryPotPayout pays a funded pot from escrow to its beneficiary, or to the treasury when redeemed
+	LedgerEntryPotPayout = "pot-payout"
+	// LedgerEntryContributionRefund returns the contributions of an unfunded pot from escrow
+	LedgerEntryContributionRefund = "contribution-refund"
+	// LedgerEntryLoan moves the principal of an accepted loan from the lender to the borrower
+	LedgerEntryLoan = "loan"
+	// LedgerEntryRepayment moves a loan repayment from the borrower to the lender
+	LedgerEntryRepayment = "repayment"
+	// LedgerEntryPayroll mints a batch of payroll stipends from the treasury
+	LedgerEntryPayroll = "payroll"
+)
+
+// LedgerEntry is a double-entry record of a balance change
+// Its postings always sum to zero: every coin credited to an account is debited from another
+type LedgerEntry struct {
+	ID        string    `firestore:"-"`
+	Type      string    `firestore:"type"`
+	Reference string    `firestore:"reference,omitempty"`
+	Postings  []Posting `firestore:"postings"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
+
+// Posting is the change of one account's balance within a ledger entry
+type Posting struct {
+	AccountID string `firestore:"account_id"`
+	Amount    int    `firestore:"amount"`
+}
+
+// Sum returns the sum of the entry's postings, which is zero for a balanced entry
+func (e LedgerEntry) Sum() int {
+	sum := 0
+	for _, posting := range e.Postings {
+		sum += posting.Amount
+	}
+	return sum
+}
+
+// LedgerReport is the result of checking the ledger against the wallets
+type LedgerReport struct {
+	Opened      bool
+	Entries     int
+	Unbalanced  []string
+	Mismatches  []LedgerMismatch
+	TotalSupply int
+	CheckedAt   time.Time
+}
+
+// LedgerMismatch is an account whose balance differs from the sum of its postings
+type LedgerMismatch struct {
+	AccountID string
+	Balance   int
+	Posted    int
+}
+
+// OK reports whether every entry is balanced and every balance matches its postings
+func (r LedgerReport) OK() bool {
+	return r.Opened && len(r.Unbalanced) == 0 && len(r.Mismatches) == 0
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+const (
+	// LoanStatusOffered is a loan waiting for the borrower to accept it
+	LoanStatusOffered = "offered"
+
+	// LoanStatusDeclined is a loan offer the borrower turned down
+	LoanStatusDeclined = "declined"
+
+	// LoanStatusActive is an accepted loan that is still being repaid
+	LoanStatusActive = "active"
+
+	// LoanStatusDefaulted is a loan that was not repaid by its due date; it can still be repaid
+	LoanStatusDefaulted = "defaulted"
+
+	// LoanStatusRepaid is a loan that was repaid in full
+	LoanStatusRepaid = "repaid"
+)
+
+// Loan is an amount lent by one user to another, repaid with flat interest by a due date
+type Loan struct {
+	ID              string    `firestore:"-"`
+	WorkspaceID     string    `firestore:"workspace_id"`
+	LenderID        string    `firestore:"lender_id"`
+	BorrowerID      string    `firestore:"borrower_id"`
+	Principal       int       `firestore:"principal"`
+	InterestPercent int       `firestore:"interest_percent"`
+	Owed            int       `firestore:"owed"`
+	Repaid          int       `firestore:"repaid"`
+	Status          string    `firestore:"status"`
+	DueAt           time.Time `firestore:"due_at"`
+	RemindedAt      time.Time `firestore:"reminded_at,omitzero"`
+	AcceptedAt      time.Time `firestore:"accepted_at,omitzero"`
+	ClosedAt        time.Time `firestore:"closed_at,omitzero"`
+	CreatedAt       time.Time `firestore:"created_at"`
+}
+
+// Outstanding returns the coins the borrower still owes
+func (l *Loan) Outstanding() int {
+	return max(l.Owed-l.Repaid, 0)
+}
+
+// IsOpen reports whether the loan was accepted and is not repaid yet
+func (l *Loan) IsOpen() bool {
+	return l.Status == LoanStatusActive || l.Status == LoanStatusDefaulted
+}
+
+// LoanOwed returns what a borrower owes for a principal with flat interest, rounded down
+func LoanOwed(principal, interestPercent int) int {
+	return principal + principal*interestPercent/100
+}
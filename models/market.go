@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+const (
+	// MarketStatusOpen is a market accepting stakes until it closes
+	MarketStatusOpen = "open"
+
+	// MarketStatusResolved is a market whose winning option was paid out
+	MarketStatusResolved = "resolved"
+
+	// MarketStatusCancelled is a market whose stakes were refunded
+	MarketStatusCancelled = "cancelled"
+)
+
+// Market is a prediction market where users stake coins on the outcome of a question
+// Stakes are held in escrow and the winners share the whole pot pro-rata to their stake
+type Market struct {
+	ID            string    `firestore:"-"`
+	WorkspaceID   string    `firestore:"workspace_id"`
+	Question      string    `firestore:"question"`
+	Options       []string  `firestore:"options"`
+	Pools         []int     `firestore:"pools"`
+	CreatorID     string    `firestore:"creator_id"`
+	Channel       string    `firestore:"channel"`
+	Status        string    `firestore:"status"`
+	WinningOption int       `firestore:"winning_option"`
+	ClosesAt      time.Time `firestore:"closes_at,omitzero"`
+	SettledBy     string    `firestore:"settled_by,omitempty"`
+	SettledAt     time.Time `firestore:"settled_at,omitzero"`
+	CreatedAt     time.Time `firestore:"created_at"`
+}
+
+// Total returns the coins staked on every option of the market
+func (m Market) Total() int {
+	total := 0
+	for _, pool := range m.Pools {
+		total += pool
+	}
+	return total
+}
+
+// IsClosed reports whether the market no longer accepts stakes at the given time
+func (m Market) IsClosed(now time.Time) bool {
+	return m.Status != MarketStatusOpen || (!m.ClosesAt.IsZero() && now.After(m.ClosesAt))
+}
+
+// Stake is the coins a user put on an option of a market
+type Stake struct {
+	UserID    string    `firestore:"user_id"`
+	Option    int       `firestore:"option"`
+	Amount    int       `firestore:"amount"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
@@ -1,10 +1,78 @@
 package models
 
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
 // User represents a user in the system with their coin balance
 type User struct {
-	UserID   string `firestore:"user_id"`
-	Username string `firestore:"user_name"`
-	Coins    int    `firestore:"coins"`
+	UserID           string    `firestore:"user_id"`
+	Username         string    `firestore:"user_name"`
+	Coins            int       `firestore:"coins"`
+	NotificationMode string    `firestore:"notification_mode,omitempty"`
+	Status           string    `firestore:"status,omitempty"`
+	System           bool      `firestore:"system,omitempty"`
+	CreatedAt        time.Time `firestore:"created_at,omitzero"`
+	LastSentAt       time.Time `firestore:"last_sent_at,omitzero"`
+	LastDemurrageAt  time.Time `firestore:"last_demurrage_at,omitzero"`
+	IdleSince        time.Time `firestore:"idle_since,omitzero"`
+	Badges           []string  `firestore:"badges,omitempty"`
+	WeeklyPodiums    int       `firestore:"weekly_podiums,omitempty"`
+	TimeZone         string    `firestore:"time_zone,omitempty"`
+	StreakDays       int       `firestore:"streak_days,omitempty"`
+	StreakLastDay    string    `firestore:"streak_last_day,omitempty"`
+	StreakWarnedDay  string    `firestore:"streak_warned_day,omitempty"`
+	// The transfer that counted the last streak day, and what undoing it rolls back
+	StreakTransferID      string `firestore:"streak_transfer_id,omitempty"`
+	StreakPreviousDays    int    `firestore:"streak_previous_days,omitempty"`
+	StreakPreviousLastDay string `firestore:"streak_previous_last_day,omitempty"`
+	StreakBonus           int    `firestore:"streak_bonus,omitempty"`
+	// Badge counters of transfers that moved coins between two people, kept once ActivityCounted is set
+	ActivityCounted    bool `firestore:"activity_counted,omitempty"`
+	TransfersSent      int  `firestore:"transfers_sent,omitempty"`
+	DistinctRecipients int  `firestore:"distinct_recipients,omitempty"`
+	DistinctSenders    int  `firestore:"distinct_senders,omitempty"`
+}
+
+const (
+	// UserStatusActive is the status of a regular wallet; wallets without a status are active
+	UserStatusActive = "active"
+
+	// UserStatusFrozen is the status of a wallet that can't send or receive coins
+	UserStatusFrozen = "frozen"
+)
+
+// IsFrozen reports whether the user's wallet is frozen
+func (u *User) IsFrozen() bool {
+	return u.Status == UserStatusFrozen
+}
+
+// HasBadge reports whether the user was awarded the badge
+func (u *User) HasBadge(badgeID string) bool {
+	return slices.Contains(u.Badges, badgeID)
+}
+
+const (
+	// NotificationModeInstant sends a direct message for every received transfer
+	NotificationModeInstant = "instant"
+
+	// NotificationModeDaily batches received transfers into a daily summary
+	NotificationModeDaily = "daily"
+
+	// NotificationModeMute disables transfer notifications
+	NotificationModeMute = "mute"
+)
+
+// QueuedNotification represents a received transfer waiting for the recipient's daily summary
+type QueuedNotification struct {
+	ID          string    `firestore:"-"`
+	RecipientID string    `firestore:"recipient_id"`
+	SenderID    string    `firestore:"sender_id"`
+	Amount      int       `firestore:"amount"`
+	Memo        string    `firestore:"memo,omitempty"`
+	CreatedAt   time.Time `firestore:"created_at"`
 }
 
 // SlackCommandRequest represents an incoming Slack slash command
@@ -19,20 +87,122 @@ type SlackCommandRequest struct {
 
 // SlackResponse represents a response to a Slack command
 type SlackResponse struct {
-	Text         string `json:"text"`
-	ResponseType string `json:"response_type"`
+	Text            string  `json:"text"`
+	ResponseType    string  `json:"response_type,omitempty"`
+	Blocks          []Block `json:"blocks,omitempty"`
+	ReplaceOriginal bool    `json:"replace_original,omitempty"`
+	DeleteOriginal  bool    `json:"delete_original,omitempty"`
 }
 
 // SlackMessage represents a message to post to Slack
 type SlackMessage struct {
-	Channel  string `json:"channel"`
-	Text     string `json:"text"`
-	ThreadTS string `json:"thread_ts,omitempty"`
+	Channel  string  `json:"channel"`
+	Text     string  `json:"text"`
+	Blocks   []Block `json:"blocks,omitempty"`
+	ThreadTS string  `json:"thread_ts,omitempty"`
+}
+
+// SlackPostMessageResponse represents the response from Slack's chat.postMessage API
+type SlackPostMessageResponse struct {
+	Ok      bool   `json:"ok"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SlackMessageUpdate represents an edit of an existing Slack message
+type SlackMessageUpdate struct {
+	Channel string  `json:"channel"`
+	TS      string  `json:"ts"`
+	Text    string  `json:"text"`
+	Blocks  []Block `json:"blocks"`
+}
+
+// SlackEphemeralMessage represents a message only visible to a single user
+type SlackEphemeralMessage struct {
+	Channel  string  `json:"channel"`
+	User     string  `json:"user"`
+	Text     string  `json:"text"`
+	Blocks   []Block `json:"blocks,omitempty"`
+	ThreadTS string  `json:"thread_ts,omitempty"`
+}
+
+// SlackAPIResponse represents the common envelope returned by Slack Web API methods
+type SlackAPIResponse struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Block represents a Block Kit layout block
+type Block struct {
+	Type     string         `json:"type"`
+	BlockID  string         `json:"block_id,omitempty"`
+	Text     *TextObject    `json:"text,omitempty"`
+	Fields   []TextObject   `json:"fields,omitempty"`
+	Elements []BlockElement `json:"elements,omitempty"`
+}
+
+// TextObject represents a Block Kit text object
+type TextObject struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// BlockElement represents an interactive Block Kit element such as a button
+type BlockElement struct {
+	Type     string      `json:"type"`
+	Text     *TextObject `json:"text,omitempty"`
+	ActionID string      `json:"action_id,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	Style    string      `json:"style,omitempty"`
+}
+
+// SlackInteractionPayload represents an incoming Slack interactive component callback
+type SlackInteractionPayload struct {
+	Type        string                  `json:"type"`
+	Team        SlackInteractionTeam    `json:"team"`
+	User        SlackInteractionUser    `json:"user"`
+	Channel     SlackInteractionChannel `json:"channel"`
+	Container   SlackContainer          `json:"container"`
+	ResponseURL string                  `json:"response_url"`
+	Actions     []SlackAction           `json:"actions"`
+}
+
+// SlackContainer identifies the message an interaction originated from
+type SlackContainer struct {
+	Type        string `json:"type"`
+	MessageTS   string `json:"message_ts"`
+	ChannelID   string `json:"channel_id"`
+	IsEphemeral bool   `json:"is_ephemeral"`
+}
+
+// SlackInteractionTeam represents the workspace where an interaction happened
+type SlackInteractionTeam struct {
+	ID string `json:"id"`
+}
+
+// SlackInteractionUser represents the user who triggered an interaction
+type SlackInteractionUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// SlackInteractionChannel represents the channel where an interaction happened
+type SlackInteractionChannel struct {
+	ID string `json:"id"`
+}
+
+// SlackAction represents a single action within an interaction payload
+type SlackAction struct {
+	ActionID string `json:"action_id"`
+	BlockID  string `json:"block_id"`
+	Value    string `json:"value"`
 }
 
 // SlackEventPayload represents an incoming Slack event
 type SlackEventPayload struct {
 	Type      string          `json:"type"`
+	TeamID    string          `json:"team_id"`
 	Challenge string          `json:"challenge,omitempty"`
 	Event     SlackEventInner `json:"event,omitempty"`
 }
@@ -45,12 +215,145 @@ type SlackEventInner struct {
 	Text     string `json:"text"`
 	TS       string `json:"ts"`
 	ThreadTS string `json:"thread_ts,omitempty"`
+	BotID    string `json:"bot_id,omitempty"`
+
+	// Member is the full profile sent by team_join events, whose user field is an object
+	Member *SlackUserInfo `json:"-"`
+}
+
+// UnmarshalJSON decodes an event whose user field is either a user ID or, for team_join, a full profile
+func (e *SlackEventInner) UnmarshalJSON(data []byte) error {
+	type plain SlackEventInner
+	var raw struct {
+		plain
+		User json.RawMessage `json:"user"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*e = SlackEventInner(raw.plain)
+	if len(raw.User) == 0 || string(raw.User) == "null" {
+		return nil
+	}
+	if raw.User[0] == '{' {
+		e.Member = &SlackUserInfo{}
+		if err := json.Unmarshal(raw.User, e.Member); err != nil {
+			return err
+		}
+		e.User = e.Member.ID
+		return nil
+	}
+	return json.Unmarshal(raw.User, &e.User)
 }
 
 // CommandResult represents the result of executing a command
 type CommandResult struct {
-	Success bool
-	Message string
+	Success   bool
+	Message   string
+	Blocks    []Block
+	Ephemeral bool
+}
+
+// TransferRequest describes a transfer of coins from one user to another
+type TransferRequest struct {
+	SenderID      string `firestore:"sender_id"`
+	SenderName    string `firestore:"sender_name"`
+	RecipientID   string `firestore:"recipient_id"`
+	RecipientName string `firestore:"recipient_name"`
+	Amount        int    `firestore:"amount"`
+	Memo          string `firestore:"memo"`
+	Channel       string `firestore:"channel"`
+	ThreadTS      string `firestore:"thread_ts"`
+}
+
+const (
+	// TransferTypeTransfer is a regular transfer between two users
+	TransferTypeTransfer = "transfer"
+
+	// TransferTypeReversal is a transfer that undoes an earlier one
+	TransferTypeReversal = "reversal"
+
+	// TransferTypeDemurrage moves decayed coins from an idle wallet to the treasury
+	TransferTypeDemurrage = "demurrage"
+
+	// TransferTypeContribution records a contribution to a pot paying another user, so that the
+	// transfer limits count it
+	TransferTypeContribution = "contribution"
+
+	// TransferTypeLoan records the principal of an accepted loan, from the lender to the borrower
+	TransferTypeLoan = "loan"
+
+	// TransferTypeRepayment records a loan repayment, from the borrower to the lender
+	TransferTypeRepayment = "repayment"
+)
+
+// Transfer represents a recorded movement of coins between two users
+type Transfer struct {
+	ID          string    `firestore:"-"`
+	Type        string    `firestore:"type"`
+	SenderID    string    `firestore:"sender_id"`
+	RecipientID string    `firestore:"recipient_id"`
+	Amount      int       `firestore:"amount"`
+	Memo        string    `firestore:"memo,omitempty"`
+	ReversalOf  string    `firestore:"reversal_of,omitempty"`
+	ReversedBy  string    `firestore:"reversed_by,omitempty"`
+	CreatedAt   time.Time `firestore:"created_at"`
+}
+
+// Counts reports whether a transfer moved coins between two people for badges: it was not undone
+// and was not sent to its own sender
+func (t *Transfer) Counts() bool {
+	return t.Type == TransferTypeTransfer && t.ReversedBy == "" && t.SenderID != t.RecipientID
+}
+
+// GivingPair counts the transfers from one user to another that were not undone
+type GivingPair struct {
+	SenderID    string `firestore:"sender_id"`
+	RecipientID string `firestore:"recipient_id"`
+	Transfers   int    `firestore:"transfers"`
+}
+
+const (
+	// AdminActionMint creates coins and adds them to a user's balance
+	AdminActionMint = "mint"
+
+	// AdminActionBurn destroys coins from a user's balance
+	AdminActionBurn = "burn"
+
+	// AdminActionSetBalance overrides a user's balance
+	AdminActionSetBalance = "set-balance"
+
+	// AdminActionFreeze freezes a user's wallet
+	AdminActionFreeze = "freeze"
+
+	// AdminActionUnfreeze unfreezes a user's wallet
+	AdminActionUnfreeze = "unfreeze"
+)
+
+// AdminAction represents a balance adjustment performed by an admin
+type AdminAction struct {
+	ID              string    `firestore:"-"`
+	Action          string    `firestore:"action"`
+	AdminID         string    `firestore:"admin_id"`
+	UserID          string    `firestore:"user_id"`
+	Amount          int       `firestore:"amount"`
+	Reason          string    `firestore:"reason"`
+	PreviousBalance int       `firestore:"previous_balance"`
+	NewBalance      int       `firestore:"new_balance"`
+	CreatedAt       time.Time `firestore:"created_at"`
+}
+
+// PendingTransfer represents a large transfer awaiting confirmation by the sender
+// Sending to a user group or making it rain holds one transfer per recipient in Batch; GroupID is
+// only set for user groups
+type PendingTransfer struct {
+	ID        string            `firestore:"-"`
+	Transfer  TransferRequest   `firestore:"transfer"`
+	GroupID   string            `firestore:"group_id,omitempty"`
+	Batch     []TransferRequest `firestore:"batch,omitempty"`
+	CreatedAt time.Time         `firestore:"created_at"`
+	ExpiresAt time.Time         `firestore:"expires_at"`
 }
 
 // SlackUserInfoResponse represents the response from Slack's users.info API
@@ -65,6 +368,9 @@ type SlackUserInfo struct {
 	ID       string            `json:"id"`
 	Name     string            `json:"name"`
 	RealName string            `json:"real_name"`
+	IsBot    bool              `json:"is_bot"`
+	TZ       string            `json:"tz"`
+	Deleted  bool              `json:"deleted"`
 	Profile  SlackUserProfile  `json:"profile"`
 }
 
@@ -78,8 +384,70 @@ type SlackUserProfile struct {
 
 // SlackUsersListResponse represents the response from Slack's users.list API
 type SlackUsersListResponse struct {
-	Ok      bool            `json:"ok"`
-	Members []SlackUserInfo `json:"members"`
-	Error   string          `json:"error,omitempty"`
+	Ok               bool                  `json:"ok"`
+	Members          []SlackUserInfo       `json:"members"`
+	ResponseMetadata SlackResponseMetadata `json:"response_metadata"`
+	Error            string                `json:"error,omitempty"`
+}
+
+// SlackConversationsMembersResponse represents the response from Slack's conversations.members API
+type SlackConversationsMembersResponse struct {
+	Ok               bool                  `json:"ok"`
+	Members          []string              `json:"members"`
+	ResponseMetadata SlackResponseMetadata `json:"response_metadata"`
+	Error            string                `json:"error,omitempty"`
 }
 
+// SlackConversationsHistoryResponse represents the response from Slack's conversations.history API
+type SlackConversationsHistoryResponse struct {
+	Ok               bool                  `json:"ok"`
+	Messages         []SlackHistoryMessage `json:"messages"`
+	ResponseMetadata SlackResponseMetadata `json:"response_metadata"`
+	Error            string                `json:"error,omitempty"`
+}
+
+// SlackHistoryMessage represents a message of a channel's history
+type SlackHistoryMessage struct {
+	User    string `json:"user"`
+	BotID   string `json:"bot_id,omitempty"`
+	SubType string `json:"subtype,omitempty"`
+	TS      string `json:"ts"`
+}
+
+// SlackResponseMetadata holds the cursor of the next page of a paginated Slack API response
+type SlackResponseMetadata struct {
+	NextCursor string `json:"next_cursor"`
+}
+
+// SlackUserGroup represents a Slack user group such as @backend-team
+type SlackUserGroup struct {
+	ID     string `json:"id"`
+	Handle string `json:"handle"`
+	Name   string `json:"name"`
+}
+
+// SlackUserGroupsListResponse represents the response from Slack's usergroups.list API
+type SlackUserGroupsListResponse struct {
+	Ok         bool             `json:"ok"`
+	UserGroups []SlackUserGroup `json:"usergroups"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// SlackUserGroupUsersResponse represents the response from Slack's usergroups.users.list API
+type SlackUserGroupUsersResponse struct {
+	Ok    bool     `json:"ok"`
+	Users []string `json:"users"`
+	Error string   `json:"error,omitempty"`
+}
+
+// SlackConversationsOpenResponse represents the response from Slack's conversations.open API
+type SlackConversationsOpenResponse struct {
+	Ok      bool                          `json:"ok"`
+	Channel SlackConversationsOpenChannel `json:"channel"`
+	Error   string                        `json:"error,omitempty"`
+}
+
+// SlackConversationsOpenChannel represents the direct message channel opened with a user
+type SlackConversationsOpenChannel struct {
+	ID string `json:"id"`
+}
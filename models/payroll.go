@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// PayrollPeriodLayout formats the monthly period a payroll run pays for, e.g. 2026-10
+const PayrollPeriodLayout = "2006-01"
+
+// Payroll is a monthly stipend minted from the treasury for every active member, or only for the
+// members of some channels and user groups
+type Payroll struct {
+	ID          string    `firestore:"-"`
+	WorkspaceID string    `firestore:"workspace_id"`
+	Amount      int       `firestore:"amount"`
+	Channels    []string  `firestore:"channels,omitempty"`
+	Groups      []string  `firestore:"groups,omitempty"`
+	CreatedBy   string    `firestore:"created_by"`
+	CreatedAt   time.Time `firestore:"created_at"`
+}
+
+// PayrollRun is the report of a payroll's grants for one period
+// Its grants subcollection holds one PayrollGrant per paid member, so nobody is paid twice
+// Paid and Minted add up over every run of the period, while the other counts describe the latest run
+type PayrollRun struct {
+	ID          string    `firestore:"-"`
+	PayrollID   string    `firestore:"payroll_id"`
+	WorkspaceID string    `firestore:"workspace_id"`
+	Period      string    `firestore:"period"`
+	Members     int       `firestore:"members"`
+	Paid        int       `firestore:"paid"`
+	AlreadyPaid int       `firestore:"already_paid"`
+	Skipped     int       `firestore:"skipped"`
+	Minted      int       `firestore:"minted"`
+	Failed      int       `firestore:"failed"`
+	Unpaid      []string  `firestore:"unpaid,omitempty"`
+	StartedAt   time.Time `firestore:"started_at"`
+	FinishedAt  time.Time `firestore:"finished_at,omitzero"`
+}
+
+// Complete reports whether every member of the run was handled
+func (r *PayrollRun) Complete() bool {
+	return !r.FinishedAt.IsZero() && r.Failed == 0
+}
+
+// PayrollGrant records the stipend paid to one member within a payroll run
+type PayrollGrant struct {
+	UserID    string    `firestore:"user_id"`
+	Amount    int       `firestore:"amount"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
+
+// PayrollBatchResult counts what happened to the members of one batch of a payroll run
+type PayrollBatchResult struct {
+	Paid        []string
+	AlreadyPaid int
+	Skipped     int
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	// PotStatusOpen is a pot collecting contributions until its goal or deadline
+	PotStatusOpen = "open"
+
+	// PotStatusPaid is a pot that reached its goal and was paid to its beneficiary
+	PotStatusPaid = "paid"
+
+	// PotStatusRedeemed is a pot without beneficiary that reached its goal and was spent through the treasury
+	PotStatusRedeemed = "redeemed"
+
+	// PotStatusRefunded is a pot that missed its goal or was cancelled, and whose contributions were refunded
+	PotStatusRefunded = "refunded"
+)
+
+// Pot is a crowdfunding goal users contribute coins to
+// Contributions are held in escrow until the goal is reached, then paid to the beneficiary,
+// or to the treasury when the pot is redeemed for something bought outside the bot
+type Pot struct {
+	ID            string    `firestore:"-"`
+	WorkspaceID   string    `firestore:"workspace_id"`
+	CreatorID     string    `firestore:"creator_id"`
+	Title         string    `firestore:"title"`
+	Goal          int       `firestore:"goal"`
+	Raised        int       `firestore:"raised"`
+	BeneficiaryID string    `firestore:"beneficiary_id,omitempty"`
+	Status        string    `firestore:"status"`
+	Channel       string    `firestore:"channel"`
+	MessageTS     string    `firestore:"message_ts,omitempty"`
+	Deadline      time.Time `firestore:"deadline"`
+	ClosedAt      time.Time `firestore:"closed_at,omitzero"`
+	CreatedAt     time.Time `firestore:"created_at"`
+}
+
+// Remaining returns the coins still missing to reach the goal
+func (p *Pot) Remaining() int {
+	return max(p.Goal-p.Raised, 0)
+}
+
+// PotContribution is a user's contribution to a pot
+type PotContribution struct {
+	UserID    string    `firestore:"user_id"`
+	Amount    int       `firestore:"amount"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	// RaffleStatusOpen is a raffle selling tickets until it ends
+	RaffleStatusOpen = "open"
+
+	// RaffleStatusDrawn is a raffle whose winner was drawn and paid
+	RaffleStatusDrawn = "drawn"
+
+	// RaffleStatusCancelled is a raffle whose tickets were refunded
+	RaffleStatusCancelled = "cancelled"
+)
+
+// Raffle is a lottery where users buy numbered tickets into a pot and one ticket wins it
+// The draw is verifiable: SeedHash is published when the raffle starts and Seed is revealed at the draw
+type Raffle struct {
+	ID            string    `firestore:"-"`
+	WorkspaceID   string    `firestore:"workspace_id"`
+	CreatorID     string    `firestore:"creator_id"`
+	Channel       string    `firestore:"channel"`
+	TicketPrice   int       `firestore:"ticket_price"`
+	Tickets       int       `firestore:"tickets"`
+	Pot           int       `firestore:"pot"`
+	CutPercent    int       `firestore:"cut_percent"`
+	Status        string    `firestore:"status"`
+	Seed          string    `firestore:"seed"`
+	SeedHash      string    `firestore:"seed_hash"`
+	WinningTicket int       `firestore:"winning_ticket,omitempty"`
+	WinnerID      string    `firestore:"winner_id,omitempty"`
+	Payout        int       `firestore:"payout,omitempty"`
+	EndsAt        time.Time `firestore:"ends_at"`
+	DrawnAt       time.Time `firestore:"drawn_at,omitzero"`
+	CreatedAt     time.Time `firestore:"created_at"`
+}
+
+// RaffleTickets is a purchase of consecutive tickets, numbered First to First+Count-1
+type RaffleTickets struct {
+	UserID    string    `firestore:"user_id"`
+	First     int       `firestore:"first"`
+	Count     int       `firestore:"count"`
+	CreatedAt time.Time `firestore:"created_at"`
+}
+
+// HashSeed returns the commitment published for a raffle seed: its hex-encoded SHA-256
+func HashSeed(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// DrawTicket returns the winning ticket number, from 1 to tickets, for a revealed seed
+// Anyone can recompute it: the first 8 bytes of SHA-256(seed + ":" + raffle ID), as a big-endian
+// integer, modulo the number of tickets, plus one
+func DrawTicket(seed, raffleID string, tickets int) int {
+	sum := sha256.Sum256([]byte(seed + ":" + raffleID))
+	return int(binary.BigEndian.Uint64(sum[:8])%uint64(tickets)) + 1
+}
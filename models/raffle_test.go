@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestDrawTicket(t *testing.T) {
+	tests := []struct {
+		name     string
+		seed     string
+		raffleID string
+		tickets  int
+		want     int
+	}{
+		{name: "ten tickets", seed: "seed", raffleID: "abc123", tickets: 10, want: 6},
+		{name: "raffle ID changes the draw", seed: "seed", raffleID: "abc124", tickets: 10, want: 2},
+		{name: "many tickets", seed: "seed", raffleID: "abc123", tickets: 1000, want: 616},
+		{name: "few tickets", seed: "5f2b9c", raffleID: "r7k2", tickets: 3, want: 1},
+		{name: "single ticket always wins", seed: "anything", raffleID: "r1", tickets: 1, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DrawTicket(tt.seed, tt.raffleID, tt.tickets); got != tt.want {
+				t.Errorf("DrawTicket(%q, %q, %d) = %d, want %d", tt.seed, tt.raffleID, tt.tickets, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrawTicketInRange(t *testing.T) {
+	for tickets := 1; tickets <= 50; tickets++ {
+		if got := DrawTicket("seed", "raffle", tickets); got < 1 || got > tickets {
+			t.Errorf("DrawTicket with %d tickets = %d, want between 1 and %d", tickets, got, tickets)
+		}
+	}
+}
+
+func TestHashSeed(t *testing.T) {
+	tests := []struct {
+		name string
+		seed string
+		want string
+	}{
+		{name: "known SHA-256 vector", seed: "abc", want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "empty seed", seed: "", want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashSeed(tt.seed); got != tt.want {
+				t.Errorf("HashSeed(%q) = %q, want %q", tt.seed, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Season is the archived final ranking of a closed leaderboard season
+type Season struct {
+	Number          int              `firestore:"number"`
+	WorkspaceID     string           `firestore:"workspace_id"`
+	StartedAt       time.Time        `firestore:"started_at,omitzero"`
+	ClosedAt        time.Time        `firestore:"closed_at"`
+	ClosedBy        string           `firestore:"closed_by"`
+	StartingBalance int              `firestore:"starting_balance"`
+	Standings       []SeasonStanding `firestore:"standings"`
+}
+
+// SeasonStanding is a user's final position in a season and the prize they were awarded
+type SeasonStanding struct {
+	Rank     int    `firestore:"rank"`
+	UserID   string `firestore:"user_id"`
+	Username string `firestore:"username"`
+	Coins    int    `firestore:"coins"`
+	Prize    int    `firestore:"prize,omitempty"`
+}
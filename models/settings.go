@@ -0,0 +1,239 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+)
+
+// Settings holds the runtime-tunable settings of a workspace
+type Settings struct {
+	InitialCoins              int               `firestore:"initial_coins"`
+	LeaderboardLimit          int               `firestore:"leaderboard_limit"`
+	RequestTimestampTolerance int               `firestore:"request_timestamp_tolerance"`
+	LargeTransferThreshold    int               `firestore:"large_transfer_threshold"`
+	UndoWindowMinutes         int               `firestore:"undo_window_minutes"`
+	AllowSelfSends            int               `firestore:"allow_self_sends"`
+	AllowBotRecipients        int               `firestore:"allow_bot_recipients"`
+	MaxTransferAmount         int               `firestore:"max_transfer_amount"`
+	DailySendCap              int               `firestore:"daily_send_cap"`
+	PairCap                   int               `firestore:"pair_cap"`
+	PairCapPeriodHours        int               `firestore:"pair_cap_period_hours"`
+	SendCooldownSeconds       int               `firestore:"send_cooldown_seconds"`
+	DemurrageEnabled          int               `firestore:"demurrage_enabled"`
+	DemurrageThreshold        int               `firestore:"demurrage_threshold"`
+	DemurrageRatePercent      int               `firestore:"demurrage_rate_percent"`
+	DemurragePeriodDays       int               `firestore:"demurrage_period_days"`
+	DemurrageIdleDays         int               `firestore:"demurrage_idle_days"`
+	SeasonStartingBalance     int               `firestore:"season_starting_balance"`
+	RaffleCutPercent          int               `firestore:"raffle_cut_percent"`
+	RainWindowMinutes         int               `firestore:"rain_window_minutes"`
+	RainMinShare              int               `firestore:"rain_min_share"`
+	SeasonPrizes              []int             `firestore:"season_prizes"`
+	StreakMilestones          []StreakMilestone `firestore:"streak_milestones"`
+	CurrentSeason             int               `firestore:"current_season"`
+	SeasonStartedAt           time.Time         `firestore:"season_started_at,omitzero"`
+	AllowedChannels           []string          `firestore:"allowed_channels"`
+	QuietChannels             []string          `firestore:"quiet_channels"`
+	AnnouncementChannel       string            `firestore:"announcement_channel"`
+	IntroChannel              string            `firestore:"intro_channel"`
+	UpdatedBy                 string            `firestore:"updated_by,omitempty"`
+	UpdatedAt                 time.Time         `firestore:"updated_at,omitzero"`
+}
+
+// SettingDefinition describes a setting admins can change and its valid range
+type SettingDefinition struct {
+	Key         string
+	Description string
+	Min         int
+	Max         int
+	Field       func(*Settings) *int
+}
+
+// SettingDefinitions lists the settings admins can view and change at runtime
+var SettingDefinitions = []SettingDefinition{
+	{
+		Key:         "initial_coins",
+		Description: "Coins granted to a new wallet",
+		Min:         0,
+		Max:         1000,
+		Field:       func(s *Settings) *int { return &s.InitialCoins },
+	},
+	{
+		Key:         "leaderboard_limit",
+		Description: "Number of users shown in the leaderboard",
+		Min:         1,
+		Max:         50,
+		Field:       func(s *Settings) *int { return &s.LeaderboardLimit },
+	},
+	{
+		Key:         "request_timestamp_tolerance",
+		Description: "Maximum age of a Slack request in seconds",
+		Min:         30,
+		Max:         config.MaxRequestTimestampTolerance,
+		Field:       func(s *Settings) *int { return &s.RequestTimestampTolerance },
+	},
+	{
+		Key:         "large_transfer_threshold",
+		Description: "Transfers above this amount must be confirmed",
+		Min:         1,
+		Max:         1000000,
+		Field:       func(s *Settings) *int { return &s.LargeTransferThreshold },
+	},
+	{
+		Key:         "undo_window_minutes",
+		Description: "Minutes during which a sender can undo a transfer",
+		Min:         1,
+		Max:         60,
+		Field:       func(s *Settings) *int { return &s.UndoWindowMinutes },
+	},
+	{
+		Key:         "allow_self_sends",
+		Description: "Whether users may send coins to themselves (0 = no, 1 = yes)",
+		Min:         0,
+		Max:         1,
+		Field:       func(s *Settings) *int { return &s.AllowSelfSends },
+	},
+	{
+		Key:         "allow_bot_recipients",
+		Description: "Whether bots may receive coins (0 = no, 1 = yes)",
+		Min:         0,
+		Max:         1,
+		Field:       func(s *Settings) *int { return &s.AllowBotRecipients },
+	},
+	{
+		Key:         "max_transfer_amount",
+		Description: "Largest amount allowed in a single transfer (0 = no limit)",
+		Min:         0,
+		Max:         1000000,
+		Field:       func(s *Settings) *int { return &s.MaxTransferAmount },
+	},
+	{
+		Key:         "daily_send_cap",
+		Description: "Coins a user may send in 24 hours (0 = no limit)",
+		Min:         0,
+		Max:         1000000,
+		Field:       func(s *Settings) *int { return &s.DailySendCap },
+	},
+	{
+		Key:         "pair_cap",
+		Description: "Coins a user may send to the same person per period (0 = no limit)",
+		Min:         0,
+		Max:         1000000,
+		Field:       func(s *Settings) *int { return &s.PairCap },
+	},
+	{
+		Key:         "pair_cap_period_hours",
+		Description: "Length of the period for pair_cap in hours",
+		Min:         1,
+		Max:         720,
+		Field:       func(s *Settings) *int { return &s.PairCapPeriodHours },
+	},
+	{
+		Key:         "send_cooldown_seconds",
+		Description: "Minimum time between two transfers by the same user (0 = no cool-down)",
+		Min:         0,
+		Max:         86400,
+		Field:       func(s *Settings) *int { return &s.SendCooldownSeconds },
+	},
+	{
+		Key:         "demurrage_enabled",
+		Description: "Whether idle balances decay over time (0 = no, 1 = yes)",
+		Min:         0,
+		Max:         1,
+		Field:       func(s *Settings) *int { return &s.DemurrageEnabled },
+	},
+	{
+		Key:         "demurrage_threshold",
+		Description: "Only the part of a balance above this amount decays",
+		Min:         0,
+		Max:         1000000,
+		Field:       func(s *Settings) *int { return &s.DemurrageThreshold },
+	},
+	{
+		Key:         "demurrage_rate_percent",
+		Description: "Percentage of the balance above the threshold lost per period",
+		Min:         1,
+		Max:         50,
+		Field:       func(s *Settings) *int { return &s.DemurrageRatePercent },
+	},
+	{
+		Key:         "demurrage_period_days",
+		Description: "Days between two decays of the same wallet",
+		Min:         1,
+		Max:         90,
+		Field:       func(s *Settings) *int { return &s.DemurragePeriodDays },
+	},
+	{
+		Key:         "demurrage_idle_days",
+		Description: "Days without sending coins before a wallet starts to decay",
+		Min:         1,
+		Max:         365,
+		Field:       func(s *Settings) *int { return &s.DemurrageIdleDays },
+	},
+	{
+		Key:         "season_starting_balance",
+		Description: "Balance every wallet is reset to when a season closes",
+		Min:         0,
+		Max:         1000,
+		Field:       func(s *Settings) *int { return &s.SeasonStartingBalance },
+	},
+	{
+		Key:         "raffle_cut_percent",
+		Description: "Percentage of each raffle pot kept by the treasury",
+		Min:         0,
+		Max:         50,
+		Field:       func(s *Settings) *int { return &s.RaffleCutPercent },
+	},
+	{
+		Key:         "rain_window_minutes",
+		Description: "Minutes within which channel members must have posted to share a rain",
+		Min:         1,
+		Max:         1440,
+		Field:       func(s *Settings) *int { return &s.RainWindowMinutes },
+	},
+	{
+		Key:         "rain_min_share",
+		Description: "Smallest amount each member sharing a rain gets",
+		Min:         1,
+		Max:         1000,
+		Field:       func(s *Settings) *int { return &s.RainMinShare },
+	},
+}
+
+// IsChannelAllowed reports whether the bot may be used in the channel
+// Every channel is allowed while the allowlist is empty, and direct messages always are
+func (s Settings) IsChannelAllowed(channelID string) bool {
+	if len(s.AllowedChannels) == 0 || strings.HasPrefix(channelID, "D") {
+		return true
+	}
+	return slices.Contains(s.AllowedChannels, channelID)
+}
+
+// IsQuietChannel reports whether the bot should only answer privately or in threads in the channel
+func (s Settings) IsQuietChannel(channelID string) bool {
+	return slices.Contains(s.QuietChannels, channelID)
+}
+
+// FindSettingDefinition returns the definition of the setting with the given key
+func FindSettingDefinition(key string) (SettingDefinition, bool) {
+	for _, definition := range SettingDefinitions {
+		if definition.Key == key {
+			return definition, true
+		}
+	}
+	return SettingDefinition{}, false
+}
+
+// SettingChange represents a change of a setting made by an admin
+type SettingChange struct {
+	WorkspaceID string    `firestore:"workspace_id"`
+	Key         string    `firestore:"key"`
+	OldValue    int       `firestore:"old_value"`
+	NewValue    int       `firestore:"new_value"`
+	Detail      string    `firestore:"detail,omitempty"`
+	AdminID     string    `firestore:"admin_id"`
+	CreatedAt   time.Time `firestore:"created_at"`
+}
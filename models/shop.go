@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// ShopItem is something users can buy with their coins
+type ShopItem struct {
+	ID          string    `firestore:"-"`
+	Name        string    `firestore:"name"`
+	Description string    `firestore:"description,omitempty"`
+	Price       int       `firestore:"price"`
+	Stock       int       `firestore:"stock"`
+	ApproverID  string    `firestore:"approver_id,omitempty"`
+	CreatedBy   string    `firestore:"created_by"`
+	CreatedAt   time.Time `firestore:"created_at"`
+}
+
+const (
+	// OrderStatusPending is an order waiting to be delivered
+	OrderStatusPending = "pending"
+
+	// OrderStatusDelivered is an order that was handed over to the buyer
+	OrderStatusDelivered = "delivered"
+
+	// OrderStatusRefunded is an order whose price was returned to the buyer
+	OrderStatusRefunded = "refunded"
+)
+
+// Order is the purchase of a shop item and the state of its fulfilment
+type Order struct {
+	ID          string    `firestore:"-"`
+	WorkspaceID string    `firestore:"workspace_id"`
+	ItemID      string    `firestore:"item_id"`
+	ItemName    string    `firestore:"item_name"`
+	BuyerID     string    `firestore:"buyer_id"`
+	Price       int       `firestore:"price"`
+	ApproverID  string    `firestore:"approver_id,omitempty"`
+	Status      string    `firestore:"status"`
+	HandledBy   string    `firestore:"handled_by,omitempty"`
+	HandledAt   time.Time `firestore:"handled_at,omitzero"`
+	CreatedAt   time.Time `firestore:"created_at"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	// Embedded so time zones from Slack resolve even where the system has no zoneinfo
+	_ "time/tzdata"
+)
+
+// StreakDayLayout is the format of the local dates a giving streak is counted in
+const StreakDayLayout = "2006-01-02"
+
+// StreakMilestone awards a bonus once a giving streak reaches a number of days
+type StreakMilestone struct {
+	Days  int `firestore:"days"`
+	Bonus int `firestore:"bonus"`
+}
+
+// String formats the milestone the way admins enter it, as days:bonus
+func (m StreakMilestone) String() string {
+	return fmt.Sprintf("%d:%d", m.Days, m.Bonus)
+}
+
+// Location returns the user's Slack time zone, or UTC when it is unknown
+func (u *User) Location() *time.Location {
+	if u.TimeZone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// StreakDay returns the user's local date at the given time
+func (u *User) StreakDay(t time.Time) string {
+	return t.In(u.Location()).Format(StreakDayLayout)
+}
+
+// previousStreakDay returns the local date of the day before the given time
+func (u *User) previousStreakDay(t time.Time) string {
+	return t.In(u.Location()).AddDate(0, 0, -1).Format(StreakDayLayout)
+}
+
+// CurrentStreak returns the number of consecutive days the user sent coins,
+// or 0 once a full local day went by without sending
+func (u *User) CurrentStreak(now time.Time) int {
+	if u.StreakLastDay == u.StreakDay(now) || u.StreakLastDay == u.previousStreakDay(now) {
+		return u.StreakDays
+	}
+	return 0
+}
+
+// StreakAtRisk reports whether the streak breaks at the end of the user's local day unless they send coins
+func (u *User) StreakAtRisk(now time.Time) bool {
+	return u.StreakDays > 0 && u.StreakLastDay == u.previousStreakDay(now)
+}
+
+// ExtendStreak returns the streak after sending coins at the given time
+func (u *User) ExtendStreak(now time.Time) int {
+	switch u.StreakLastDay {
+	case u.StreakDay(now):
+		return u.StreakDays
+	case u.previousStreakDay(now):
+		return u.StreakDays + 1
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExtendStreak(t *testing.T) {
+	// 2026-10-18 10:30 UTC is still 2026-10-17 in Pago Pago and already 2026-10-19 in Kiritimati
+	now := time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		user User
+		want int
+	}{
+		{
+			name: "first giving day",
+			user: User{},
+			want: 1,
+		},
+		{
+			name: "already counted today",
+			user: User{StreakDays: 4, StreakLastDay: "2026-10-18"},
+			want: 4,
+		},
+		{
+			name: "sent yesterday",
+			user: User{StreakDays: 4, StreakLastDay: "2026-10-17"},
+			want: 5,
+		},
+		{
+			name: "broken streak starts over",
+			user: User{StreakDays: 4, StreakLastDay: "2026-10-16"},
+			want: 1,
+		},
+		{
+			name: "yesterday in the user's time zone",
+			user: User{StreakDays: 2, StreakLastDay: "2026-10-16", TimeZone: "Pacific/Pago_Pago"},
+			want: 3,
+		},
+		{
+			name: "today in the user's time zone",
+			user: User{StreakDays: 2, StreakLastDay: "2026-10-19", TimeZone: "Pacific/Kiritimati"},
+			want: 2,
+		},
+		{
+			name: "unknown time zone falls back to UTC",
+			user: User{StreakDays: 2, StreakLastDay: "2026-10-17", TimeZone: "Nowhere/Special"},
+			want: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.ExtendStreak(now); got != tt.want {
+				t.Errorf("ExtendStreak() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
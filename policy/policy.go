@@ -0,0 +1,164 @@
+// Package policy decides whether a transfer is allowed before it is executed
+package policy
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/database"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+	"github.com/unacorbatanegra/corbacoin-bot/slack"
+)
+
+// Input holds everything rules need to decide on a transfer
+type Input struct {
+	Request  models.TransferRequest
+	Settings models.Settings
+	Now      time.Time
+
+	// Recipient is the recipient's Slack profile, or nil if it could not be fetched
+	Recipient *models.SlackUserInfo
+
+	// Recent are the coins the sender gave within the longest period any rule looks at: transfers,
+	// pot contributions, loans and repayments, excluding transfers that were undone
+	Recent []models.Transfer
+
+	// Received are the coins the sender was given within the pair cap period, counted like Recent
+	Received []models.Transfer
+
+	// Batch are the transfers checked before this one that are executed together with it
+	Batch []models.TransferRequest
+}
+
+// Rule is a single check evaluated before every transfer
+type Rule interface {
+	// Name identifies the rule in logs
+	Name() string
+
+	// Check returns an empty string to allow the transfer, or the reason shown to the sender
+	Check(in *Input) string
+}
+
+// rules are evaluated in order and the first rule that blocks a transfer wins
+var rules = []Rule{
+	selfSendRule{},
+	recipientAccountRule{},
+	maxAmountRule{},
+	cooldownRule{},
+	dailyCapRule{},
+	pairCapRule{},
+}
+
+// Register adds a rule evaluated after the built-in rules
+func Register(rule Rule) {
+	rules = append(rules, rule)
+}
+
+// Evaluate checks a transfer against every rule
+// It returns the reason the transfer is blocked, or an empty string if it is allowed
+// Rules run before the transfer's transaction, so concurrent transfers by the same sender can each pass
+// a cap the two of them exceed together. The caps bound farming over hours, not a burst of requests
+func Evaluate(ctx context.Context, req models.TransferRequest) (string, error) {
+	return EvaluateBatch(ctx, []models.TransferRequest{req}, nil)
+}
+
+// EvaluateBatch checks transfers from the same sender that are executed together, such as a
+// payment to every member of a user group
+// Each transfer is checked as if the ones before it in the batch were already sent. recipients holds
+// the Slack profiles the caller already fetched, by user ID; the others are fetched from Slack
+func EvaluateBatch(ctx context.Context, reqs []models.TransferRequest, recipients map[string]*models.SlackUserInfo) (string, error) {
+	if len(reqs) == 0 {
+		return "", nil
+	}
+
+	in, err := buildInput(ctx, reqs[0], recipientProfile(recipients, reqs[0].RecipientID))
+	if err != nil {
+		return "", err
+	}
+
+	for i, req := range reqs {
+		if i > 0 {
+			in.Request = req
+			in.Recipient = recipientProfile(recipients, req.RecipientID)
+			in.Batch = reqs[:i]
+		}
+
+		for _, rule := range rules {
+			if reason := rule.Check(in); reason != "" {
+				log.Printf("Transfer of %d from %s to %s blocked by policy %s", req.Amount, req.SenderID, req.RecipientID, rule.Name())
+				return reason, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// buildInput gathers the settings and recent history used by the rules
+func buildInput(ctx context.Context, req models.TransferRequest, recipient *models.SlackUserInfo) (*Input, error) {
+	in := &Input{
+		Request:   req,
+		Settings:  database.GetSettings(ctx),
+		Now:       time.Now(),
+		Recipient: recipient,
+	}
+
+	lookback := 24 * time.Hour
+	if pairPeriod := time.Duration(in.Settings.PairCapPeriodHours) * time.Hour; in.Settings.PairCap > 0 && pairPeriod > lookback {
+		lookback = pairPeriod
+	}
+
+	transfers, err := database.GetTransfersBySenderSince(ctx, req.SenderID, in.Now.Add(-lookback))
+	if err != nil {
+		return nil, err
+	}
+	in.Recent = countedTransfers(transfers)
+
+	if in.Settings.PairCap > 0 {
+		period := time.Duration(in.Settings.PairCapPeriodHours) * time.Hour
+		received, err := database.GetTransfersByRecipientSince(ctx, req.SenderID, in.Now.Add(-period))
+		if err != nil {
+			return nil, err
+		}
+		in.Received = countedTransfers(received)
+	}
+
+	return in, nil
+}
+
+// countedTransfers keeps the coins users gave each other: transfers that were not undone,
+// contributions to pots paying another user, loan principals and repayments
+func countedTransfers(transfers []models.Transfer) []models.Transfer {
+	var counted []models.Transfer
+	for _, transfer := range transfers {
+		switch transfer.Type {
+		case models.TransferTypeTransfer:
+			if transfer.ReversedBy == "" {
+				counted = append(counted, transfer)
+			}
+		case models.TransferTypeContribution, models.TransferTypeLoan, models.TransferTypeRepayment:
+			counted = append(counted, transfer)
+		}
+	}
+	return counted
+}
+
+// recipientProfile returns the recipient's Slack profile from recipients, fetching it when it is missing
+func recipientProfile(recipients map[string]*models.SlackUserInfo, recipientID string) *models.SlackUserInfo {
+	if recipient, ok := recipients[recipientID]; ok {
+		return recipient
+	}
+	return fetchRecipient(recipientID)
+}
+
+// fetchRecipient returns the recipient's Slack profile, or nil if it could not be fetched
+func fetchRecipient(recipientID string) *models.SlackUserInfo {
+	recipient, err := slack.GetUserInfo(recipientID)
+	if err != nil {
+		// Don't block transfers because Slack is unavailable; rules treat nil as unknown
+		log.Printf("Error fetching recipient %s for policy checks: %v", recipientID, err)
+		return nil
+	}
+	return recipient
+}
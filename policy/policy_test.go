@@ -0,0 +1,24 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+func TestCountedTransfers(t *testing.T) {
+	transfer := models.Transfer{ID: "t1", Type: models.TransferTypeTransfer, Amount: 5}
+	undone := models.Transfer{ID: "t2", Type: models.TransferTypeTransfer, Amount: 5, ReversedBy: "t3"}
+	reversal := models.Transfer{ID: "t3", Type: models.TransferTypeReversal, Amount: 5, ReversalOf: "t2"}
+	demurrage := models.Transfer{ID: "t4", Type: models.TransferTypeDemurrage, Amount: 2}
+	contribution := models.Transfer{ID: "t5", Type: models.TransferTypeContribution, Amount: 20}
+	loan := models.Transfer{ID: "t6", Type: models.TransferTypeLoan, Amount: 50}
+	repayment := models.Transfer{ID: "t7", Type: models.TransferTypeRepayment, Amount: 10}
+
+	got := countedTransfers([]models.Transfer{transfer, undone, reversal, demurrage, contribution, loan, repayment})
+	want := []models.Transfer{transfer, contribution, loan, repayment}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("countedTransfers() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"fmt"
+	"time"
+)
+
+// selfSendRule blocks sending coins to yourself unless allow_self_sends is enabled
+type selfSendRule struct{}
+
+func (selfSendRule) Name() string { return "self-send" }
+
+func (selfSendRule) Check(in *Input) string {
+	if in.Settings.AllowSelfSends == 0 && in.Request.SenderID == in.Request.RecipientID {
+		return "You can't send coins to yourself."
+	}
+	return ""
+}
+
+// recipientAccountRule blocks transfers to deactivated users and, unless allowed, to bots
+type recipientAccountRule struct{}
+
+func (recipientAccountRule) Name() string { return "recipient-account" }
+
+func (recipientAccountRule) Check(in *Input) string {
+	if in.Recipient == nil {
+		return ""
+	}
+	if in.Recipient.Deleted {
+		return fmt.Sprintf("<@%s> has left the workspace and can't receive coins.", in.Request.RecipientID)
+	}
+	if in.Recipient.IsBot && in.Settings.AllowBotRecipients == 0 {
+		return fmt.Sprintf("<@%s> is a bot and can't receive coins.", in.Request.RecipientID)
+	}
+	return ""
+}
+
+// maxAmountRule caps the amount of a single transfer
+type maxAmountRule struct{}
+
+func (maxAmountRule) Name() string { return "max-amount" }
+
+func (maxAmountRule) Check(in *Input) string {
+	if limit := in.Settings.MaxTransferAmount; limit > 0 && in.Request.Amount > limit {
+		return fmt.Sprintf("A single transfer can't exceed %d :corbacoin:.", limit)
+	}
+	return ""
+}
+
+// cooldownRule enforces a minimum time between two transfers by the same sender
+type cooldownRule struct{}
+
+func (cooldownRule) Name() string { return "cooldown" }
+
+func (cooldownRule) Check(in *Input) string {
+	cooldown := time.Duration(in.Settings.SendCooldownSeconds) * time.Second
+	if cooldown <= 0 || len(in.Recent) == 0 {
+		return ""
+	}
+
+	last := in.Recent[len(in.Recent)-1]
+	if wait := last.CreatedAt.Add(cooldown).Sub(in.Now); wait > 0 {
+		return fmt.Sprintf("Slow down! You can send coins again in %s.", wait.Round(time.Second))
+	}
+	return ""
+}
+
+// dailyCapRule caps the coins a sender can send within 24 hours
+type dailyCapRule struct{}
+
+func (dailyCapRule) Name() string { return "daily-cap" }
+
+func (dailyCapRule) Check(in *Input) string {
+	limit := in.Settings.DailySendCap
+	if limit <= 0 {
+		return ""
+	}
+
+	sent := sentSince(in, "", in.Now.Add(-24*time.Hour))
+	if sent+in.Request.Amount > limit {
+		return fmt.Sprintf("You can send up to %d :corbacoin: per 24 hours and have already sent %d.", limit, sent)
+	}
+	return ""
+}
+
+// pairCapRule caps the coins two users can exchange within a period, in both directions together,
+// so a pair can't farm the leaderboard by sending the same coins back and forth
+type pairCapRule struct{}
+
+func (pairCapRule) Name() string { return "pair-cap" }
+
+func (pairCapRule) Check(in *Input) string {
+	limit := in.Settings.PairCap
+	if limit <= 0 {
+		return ""
+	}
+
+	since := in.Now.Add(-time.Duration(in.Settings.PairCapPeriodHours) * time.Hour)
+	exchanged := sentSince(in, in.Request.RecipientID, since)
+	for _, transfer := range in.Received {
+		if transfer.SenderID == in.Request.RecipientID && !transfer.CreatedAt.Before(since) {
+			exchanged += transfer.Amount
+		}
+	}
+	if exchanged+in.Request.Amount > limit {
+		return fmt.Sprintf("You and <@%s> can exchange up to %d :corbacoin: every %d hours and have already exchanged %d.",
+			in.Request.RecipientID, limit, in.Settings.PairCapPeriodHours, exchanged)
+	}
+	return ""
+}
+
+// sentSince sums the sender's recent transfers after the given time, optionally to a single recipient
+// Transfers earlier in the same batch count as sent now
+func sentSince(in *Input, recipientID string, since time.Time) int {
+	total := 0
+	for _, req := range in.Batch {
+		if recipientID == "" || req.RecipientID == recipientID {
+			total += req.Amount
+		}
+	}
+	for _, transfer := range in.Recent {
+		if transfer.CreatedAt.Before(since) {
+			continue
+		}
+		if recipientID != "" && transfer.RecipientID != recipientID {
+			continue
+		}
+		total += transfer.Amount
+	}
+	return total
+}
@@ -0,0 +1,212 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+func TestRules(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	send := func(amount int) models.TransferRequest {
+		return models.TransferRequest{SenderID: "alice", RecipientID: "bob", Amount: amount}
+	}
+	sent := func(recipientID string, amount int, ago time.Duration) models.Transfer {
+		return models.Transfer{SenderID: "alice", RecipientID: recipientID, Amount: amount, CreatedAt: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		in      Input
+		blocked bool
+	}{
+		{
+			name:    "self-send is blocked",
+			rule:    selfSendRule{},
+			in:      Input{Request: models.TransferRequest{SenderID: "alice", RecipientID: "alice", Amount: 1}},
+			blocked: true,
+		},
+		{
+			name: "self-send is allowed by settings",
+			rule: selfSendRule{},
+			in: Input{
+				Request:  models.TransferRequest{SenderID: "alice", RecipientID: "alice", Amount: 1},
+				Settings: models.Settings{AllowSelfSends: 1},
+			},
+		},
+		{
+			name: "send to someone else",
+			rule: selfSendRule{},
+			in:   Input{Request: send(1)},
+		},
+		{
+			name: "unknown recipient profile is allowed",
+			rule: recipientAccountRule{},
+			in:   Input{Request: send(1)},
+		},
+		{
+			name:    "deactivated recipient is blocked",
+			rule:    recipientAccountRule{},
+			in:      Input{Request: send(1), Recipient: &models.SlackUserInfo{ID: "bob", Deleted: true}},
+			blocked: true,
+		},
+		{
+			name:    "bot recipient is blocked",
+			rule:    recipientAccountRule{},
+			in:      Input{Request: send(1), Recipient: &models.SlackUserInfo{ID: "bob", IsBot: true}},
+			blocked: true,
+		},
+		{
+			name: "bot recipient is allowed by settings",
+			rule: recipientAccountRule{},
+			in: Input{
+				Request:   send(1),
+				Settings:  models.Settings{AllowBotRecipients: 1},
+				Recipient: &models.SlackUserInfo{ID: "bob", IsBot: true},
+			},
+		},
+		{
+			name: "amount at the limit",
+			rule: maxAmountRule{},
+			in:   Input{Request: send(50), Settings: models.Settings{MaxTransferAmount: 50}},
+		},
+		{
+			name:    "amount over the limit",
+			rule:    maxAmountRule{},
+			in:      Input{Request: send(51), Settings: models.Settings{MaxTransferAmount: 50}},
+			blocked: true,
+		},
+		{
+			name: "no amount limit",
+			rule: maxAmountRule{},
+			in:   Input{Request: send(1000)},
+		},
+		{
+			name: "cooldown elapsed",
+			rule: cooldownRule{},
+			in: Input{
+				Request:  send(1),
+				Settings: models.Settings{SendCooldownSeconds: 60},
+				Now:      now,
+				Recent:   []models.Transfer{sent("carol", 1, 2*time.Minute)},
+			},
+		},
+		{
+			name: "cooldown still running",
+			rule: cooldownRule{},
+			in: Input{
+				Request:  send(1),
+				Settings: models.Settings{SendCooldownSeconds: 60},
+				Now:      now,
+				Recent:   []models.Transfer{sent("carol", 1, 2*time.Minute), sent("carol", 1, 30*time.Second)},
+			},
+			blocked: true,
+		},
+		{
+			name: "daily cap not reached",
+			rule: dailyCapRule{},
+			in: Input{
+				Request:  send(40),
+				Settings: models.Settings{DailySendCap: 100},
+				Now:      now,
+				Recent:   []models.Transfer{sent("carol", 60, time.Hour)},
+			},
+		},
+		{
+			name: "daily cap exceeded",
+			rule: dailyCapRule{},
+			in: Input{
+				Request:  send(41),
+				Settings: models.Settings{DailySendCap: 100},
+				Now:      now,
+				Recent:   []models.Transfer{sent("carol", 60, time.Hour)},
+			},
+			blocked: true,
+		},
+		{
+			name: "daily cap ignores transfers older than a day",
+			rule: dailyCapRule{},
+			in: Input{
+				Request:  send(50),
+				Settings: models.Settings{DailySendCap: 100},
+				Now:      now,
+				Recent:   []models.Transfer{sent("carol", 60, 25*time.Hour)},
+			},
+		},
+		{
+			name: "pair cap only counts the same recipient",
+			rule: pairCapRule{},
+			in: Input{
+				Request:  send(20),
+				Settings: models.Settings{PairCap: 30, PairCapPeriodHours: 24},
+				Now:      now,
+				Recent:   []models.Transfer{sent("carol", 20, time.Hour)},
+			},
+		},
+		{
+			name: "pair cap exceeded",
+			rule: pairCapRule{},
+			in: Input{
+				Request:  send(20),
+				Settings: models.Settings{PairCap: 30, PairCapPeriodHours: 24},
+				Now:      now,
+				Recent:   []models.Transfer{sent("bob", 20, time.Hour)},
+			},
+			blocked: true,
+		},
+		{
+			name: "daily cap counts earlier transfers of the batch",
+			rule: dailyCapRule{},
+			in: Input{
+				Request:  send(50),
+				Settings: models.Settings{DailySendCap: 100},
+				Now:      now,
+				Batch:    []models.TransferRequest{{SenderID: "alice", RecipientID: "carol", Amount: 60}},
+			},
+			blocked: true,
+		},
+		{
+			name: "pair cap counts coins sent back by the recipient",
+			rule: pairCapRule{},
+			in: Input{
+				Request:  send(20),
+				Settings: models.Settings{PairCap: 30, PairCapPeriodHours: 24},
+				Now:      now,
+				Recent:   []models.Transfer{sent("bob", 5, 2*time.Hour)},
+				Received: []models.Transfer{{SenderID: "bob", RecipientID: "alice", Amount: 10, CreatedAt: now.Add(-time.Hour)}},
+			},
+			blocked: true,
+		},
+		{
+			name: "pair cap ignores coins received from others",
+			rule: pairCapRule{},
+			in: Input{
+				Request:  send(20),
+				Settings: models.Settings{PairCap: 30, PairCapPeriodHours: 24},
+				Now:      now,
+				Received: []models.Transfer{{SenderID: "carol", RecipientID: "alice", Amount: 20, CreatedAt: now.Add(-time.Hour)}},
+			},
+		},
+		{
+			name: "pair cap ignores transfers before the period",
+			rule: pairCapRule{},
+			in: Input{
+				Request:  send(20),
+				Settings: models.Settings{PairCap: 30, PairCapPeriodHours: 24},
+				Now:      now,
+				Recent:   []models.Transfer{sent("bob", 20, 25*time.Hour)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.rule.Check(&tt.in)
+			if blocked := reason != ""; blocked != tt.blocked {
+				t.Errorf("%s.Check() = %q, want blocked %v", tt.rule.Name(), reason, tt.blocked)
+			}
+		})
+	}
+}
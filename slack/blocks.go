@@ -0,0 +1,41 @@
+package slack
+
+import "github.com/unacorbatanegra/corbacoin-bot/models"
+
+// SectionBlock returns a Block Kit section block with markdown text
+func SectionBlock(text string) models.Block {
+	return models.Block{
+		Type: "section",
+		Text: &models.TextObject{Type: "mrkdwn", Text: text},
+	}
+}
+
+// FieldsBlock returns a Block Kit section block laying out markdown fields in two columns
+func FieldsBlock(fields ...string) models.Block {
+	block := models.Block{Type: "section"}
+	for _, field := range fields {
+		block.Fields = append(block.Fields, models.TextObject{Type: "mrkdwn", Text: field})
+	}
+	return block
+}
+
+// ActionsBlock returns a Block Kit actions block containing the given elements
+func ActionsBlock(blockID string, elements ...models.BlockElement) models.Block {
+	return models.Block{
+		Type:     "actions",
+		BlockID:  blockID,
+		Elements: elements,
+	}
+}
+
+// Button returns a Block Kit button element
+// Style may be empty, "primary" or "danger"
+func Button(text, actionID, value, style string) models.BlockElement {
+	return models.BlockElement{
+		Type:     "button",
+		Text:     &models.TextObject{Type: "plain_text", Text: text},
+		ActionID: actionID,
+		Value:    value,
+		Style:    style,
+	}
+}
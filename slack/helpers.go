@@ -2,6 +2,7 @@ package slack
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/unacorbatanegra/corbacoin-bot/models"
 )
@@ -25,3 +26,49 @@ func GetOrFindUser(identifier string) (*models.SlackUserInfo, error) {
 	return userInfo, nil
 }
 
+
+// Responder answers a slash command by replacing its "⏳" acknowledgment with the outcome
+type Responder struct {
+	ResponseURL string
+	ChannelID   string
+	UserID      string
+}
+
+// Respond replaces the acknowledgment with the result
+// Public results delete the private acknowledgment and are posted to the channel, private results
+// replace it in place. When the response URL has expired the message is sent with the Web API instead
+func (r Responder) Respond(text string, blocks []models.Block, public bool) error {
+	if public {
+		if err := DeleteOriginal(r.ResponseURL); err != nil {
+			log.Printf("Error deleting acknowledgment: %v", err)
+		}
+
+		err := PostResponse(r.ResponseURL, models.SlackResponse{
+			Text:         text,
+			ResponseType: "in_channel",
+			Blocks:       blocks,
+		})
+		if err != nil {
+			log.Printf("Response URL failed, falling back to chat.postMessage: %v", err)
+			return SendBlocksMessage(r.ChannelID, text, "", blocks)
+		}
+		return nil
+	}
+
+	err := PostResponse(r.ResponseURL, models.SlackResponse{
+		Text:            text,
+		ResponseType:    "ephemeral",
+		Blocks:          blocks,
+		ReplaceOriginal: true,
+	})
+	if err != nil {
+		log.Printf("Response URL failed, falling back to chat.postEphemeral: %v", err)
+		return SendEphemeral(r.ChannelID, r.UserID, text, "", blocks)
+	}
+	return nil
+}
+
+// RespondError replaces the acknowledgment with a private error message
+func (r Responder) RespondError(errorMessage string) error {
+	return r.Respond(fmt.Sprintf("❌ <@%s> %s", r.UserID, errorMessage), nil, false)
+}
@@ -0,0 +1,73 @@
+package slack
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+// ListUsers retrieves every user of the workspace, including bots and deactivated users
+func ListUsers() ([]models.SlackUserInfo, error) {
+	var users []models.SlackUserInfo
+	cursor := ""
+	for {
+		var result models.SlackUsersListResponse
+		if err := getAPI("users.list", url.Values{"limit": {"200"}, "cursor": {cursor}}, &result); err != nil {
+			return nil, err
+		}
+		if !result.Ok {
+			return nil, fmt.Errorf("slack API error: %s", result.Error)
+		}
+
+		users = append(users, result.Members...)
+		if cursor = result.ResponseMetadata.NextCursor; cursor == "" {
+			return users, nil
+		}
+	}
+}
+
+// GetChannelMembers retrieves the user IDs of a channel's members
+func GetChannelMembers(channelID string) ([]string, error) {
+	var members []string
+	cursor := ""
+	for {
+		var result models.SlackConversationsMembersResponse
+		if err := getAPI("conversations.members", url.Values{"channel": {channelID}, "limit": {"200"}, "cursor": {cursor}}, &result); err != nil {
+			return nil, err
+		}
+		if !result.Ok {
+			return nil, fmt.Errorf("slack API error: %s", result.Error)
+		}
+
+		members = append(members, result.Members...)
+		if cursor = result.ResponseMetadata.NextCursor; cursor == "" {
+			return members, nil
+		}
+	}
+}
+
+// GetChannelHistory retrieves the messages posted to a channel since the given time, newest first
+// Thread replies are not included
+func GetChannelHistory(channelID string, since time.Time) ([]models.SlackHistoryMessage, error) {
+	oldest := strconv.FormatInt(since.Unix(), 10)
+
+	var messages []models.SlackHistoryMessage
+	cursor := ""
+	for {
+		var result models.SlackConversationsHistoryResponse
+		if err := getAPI("conversations.history", url.Values{"channel": {channelID}, "oldest": {oldest}, "limit": {"200"}, "cursor": {cursor}}, &result); err != nil {
+			return nil, err
+		}
+		if !result.Ok {
+			return nil, fmt.Errorf("slack API error: %s", result.Error)
+		}
+
+		messages = append(messages, result.Messages...)
+		if cursor = result.ResponseMetadata.NextCursor; cursor == "" {
+			return messages, nil
+		}
+	}
+}
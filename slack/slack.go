@@ -18,11 +18,38 @@ import (
 
 // SendResponse sends a response to Slack using a response URL
 func SendResponse(responseURL, text, responseType string) error {
-	response := models.SlackResponse{
+	return PostResponse(responseURL, models.SlackResponse{
 		Text:         text,
 		ResponseType: responseType,
-	}
+	})
+}
+
+// SendBlocksResponse sends a Block Kit response to Slack using a response URL
+func SendBlocksResponse(responseURL, text, responseType string, blocks []models.Block) error {
+	return PostResponse(responseURL, models.SlackResponse{
+		Text:         text,
+		ResponseType: responseType,
+		Blocks:       blocks,
+	})
+}
 
+// ReplaceOriginal replaces the message an interaction originated from with the given text
+func ReplaceOriginal(responseURL, text string) error {
+	return PostResponse(responseURL, models.SlackResponse{
+		Text:            text,
+		ReplaceOriginal: true,
+	})
+}
+
+// DeleteOriginal deletes the message an interaction originated from
+func DeleteOriginal(responseURL string) error {
+	return PostResponse(responseURL, models.SlackResponse{
+		DeleteOriginal: true,
+	})
+}
+
+// PostResponse posts a response payload to a Slack response URL
+func PostResponse(responseURL string, response models.SlackResponse) error {
 	payload, err := json.Marshal(response)
 	if err != nil {
 		return err
@@ -34,6 +61,10 @@ func SendResponse(responseURL, text, responseType string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response URL returned status %d", resp.StatusCode)
+	}
+
 	return nil
 }
 
@@ -48,6 +79,12 @@ func SendErrorResponse(responseURL, errorMessage, username string) error {
 
 // SendMessage sends a message to a Slack channel or thread
 func SendMessage(channel, text, threadTS string) error {
+	return SendBlocksMessage(channel, text, threadTS, nil)
+}
+
+// SendBlocksMessage sends a Block Kit message to a Slack channel or thread
+// The text is used as a fallback for notifications
+func SendBlocksMessage(channel, text, threadTS string, blocks []models.Block) error {
 	if config.SlackBotToken == "" {
 		return fmt.Errorf("SLACK_BOT_TOKEN is not set")
 	}
@@ -55,6 +92,7 @@ func SendMessage(channel, text, threadTS string) error {
 	message := models.SlackMessage{
 		Channel:  channel,
 		Text:     text,
+		Blocks:   blocks,
 		ThreadTS: threadTS,
 	}
 
@@ -81,6 +119,122 @@ func SendMessage(channel, text, threadTS string) error {
 	return nil
 }
 
+// PostBlocksMessage sends a Block Kit message to a Slack channel and returns its timestamp,
+// so the message can be edited later with UpdateMessage
+func PostBlocksMessage(channel, text string, blocks []models.Block) (string, error) {
+	message := models.SlackMessage{
+		Channel: channel,
+		Text:    text,
+		Blocks:  blocks,
+	}
+
+	var result models.SlackPostMessageResponse
+	if err := callAPI("chat.postMessage", message, &result); err != nil {
+		return "", err
+	}
+
+	if !result.Ok {
+		return "", fmt.Errorf("slack API error: %s", result.Error)
+	}
+
+	return result.TS, nil
+}
+
+// SendDirectMessage opens a direct message conversation with a user and posts the text to it
+func SendDirectMessage(userID, text string) error {
+	return SendDirectBlocksMessage(userID, text, nil)
+}
+
+// SendDirectBlocksMessage opens a direct message conversation with a user and posts a Block Kit message to it
+func SendDirectBlocksMessage(userID, text string, blocks []models.Block) error {
+	var conversation models.SlackConversationsOpenResponse
+	if err := callAPI("conversations.open", map[string]string{"users": userID}, &conversation); err != nil {
+		return err
+	}
+
+	if !conversation.Ok {
+		return fmt.Errorf("slack API error: %s", conversation.Error)
+	}
+
+	return SendBlocksMessage(conversation.Channel.ID, text, "", blocks)
+}
+
+// UpdateMessage replaces the text and blocks of a message previously posted by the bot
+func UpdateMessage(channel, ts, text string, blocks []models.Block) error {
+	update := models.SlackMessageUpdate{
+		Channel: channel,
+		TS:      ts,
+		Text:    text,
+		Blocks:  blocks,
+	}
+	if update.Blocks == nil {
+		// An empty list removes the previous blocks instead of keeping them
+		update.Blocks = []models.Block{}
+	}
+
+	var result models.SlackAPIResponse
+	if err := callAPI("chat.update", update, &result); err != nil {
+		return err
+	}
+
+	if !result.Ok {
+		return fmt.Errorf("slack API error: %s", result.Error)
+	}
+
+	return nil
+}
+
+// SendEphemeral sends a message to a channel or thread that only the given user can see
+func SendEphemeral(channel, userID, text, threadTS string, blocks []models.Block) error {
+	message := models.SlackEphemeralMessage{
+		Channel:  channel,
+		User:     userID,
+		Text:     text,
+		Blocks:   blocks,
+		ThreadTS: threadTS,
+	}
+
+	var result models.SlackAPIResponse
+	if err := callAPI("chat.postEphemeral", message, &result); err != nil {
+		return err
+	}
+
+	if !result.Ok {
+		return fmt.Errorf("slack API error: %s", result.Error)
+	}
+
+	return nil
+}
+
+// callAPI posts a JSON payload to a Slack Web API method and decodes the response into result
+func callAPI(method string, payload interface{}, result interface{}) error {
+	if config.SlackBotToken == "" {
+		return fmt.Errorf("SLACK_BOT_TOKEN is not set")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", "https://slack.com/api/"+method, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.SlackBotToken))
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
 // GetUserInfo retrieves user information from Slack by user_id
 func GetUserInfo(userID string) (*models.SlackUserInfo, error) {
 	if config.SlackBotToken == "" {
@@ -159,8 +313,17 @@ func FindUserByUsername(username string) (*models.SlackUserInfo, error) {
 	return nil, fmt.Errorf("user not found: %s", username)
 }
 
-// VerifySignature verifies that a request came from Slack
-func VerifySignature(r *http.Request, body []byte) bool {
+// RequestAge returns how many seconds ago Slack sent a request, according to its timestamp header
+func RequestAge(r *http.Request) int64 {
+	ts, err := strconv.ParseInt(r.Header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return time.Now().Unix() - ts
+}
+
+// VerifySignature verifies that a request came from Slack within tolerance seconds
+func VerifySignature(r *http.Request, body []byte, tolerance int) bool {
 	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
 	signature := r.Header.Get("X-Slack-Signature")
 
@@ -176,7 +339,7 @@ func VerifySignature(r *http.Request, body []byte) bool {
 		return false
 	}
 
-	if time.Now().Unix()-ts > config.RequestTimestampTolerance {
+	if time.Now().Unix()-ts > int64(tolerance) {
 		log.Println("Request timestamp is too old")
 		return false
 	}
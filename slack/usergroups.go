@@ -0,0 +1,68 @@
+package slack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/unacorbatanegra/corbacoin-bot/config"
+	"github.com/unacorbatanegra/corbacoin-bot/models"
+)
+
+// GetUserGroupMembers retrieves the user IDs of a user group's members
+func GetUserGroupMembers(groupID string) ([]string, error) {
+	var result models.SlackUserGroupUsersResponse
+	if err := getAPI("usergroups.users.list", url.Values{"usergroup": {groupID}}, &result); err != nil {
+		return nil, err
+	}
+
+	if !result.Ok {
+		return nil, fmt.Errorf("slack API error: %s", result.Error)
+	}
+
+	return result.Users, nil
+}
+
+// FindUserGroupByHandle searches the workspace's user groups for the given handle, with or without "@"
+func FindUserGroupByHandle(handle string) (*models.SlackUserGroup, error) {
+	var result models.SlackUserGroupsListResponse
+	if err := getAPI("usergroups.list", nil, &result); err != nil {
+		return nil, err
+	}
+
+	if !result.Ok {
+		return nil, fmt.Errorf("slack API error: %s", result.Error)
+	}
+
+	handle = strings.TrimPrefix(handle, "@")
+	for _, group := range result.UserGroups {
+		if strings.EqualFold(group.Handle, handle) {
+			return &group, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user group not found: %s", handle)
+}
+
+// getAPI calls a Slack Web API method that only accepts query parameters and decodes the response into result
+func getAPI(method string, params url.Values, result interface{}) error {
+	if config.SlackBotToken == "" {
+		return fmt.Errorf("SLACK_BOT_TOKEN is not set")
+	}
+
+	req, err := http.NewRequest("GET", "https://slack.com/api/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.SlackBotToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}